@@ -6,13 +6,25 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	gosync "sync"
 	"syscall"
 	"time"
 
+	_ "github.com/eslutz/forwardarr/internal/aria2"
+	"github.com/eslutz/forwardarr/internal/command"
 	"github.com/eslutz/forwardarr/internal/config"
-	"github.com/eslutz/forwardarr/internal/qbit"
+	_ "github.com/eslutz/forwardarr/internal/deluge"
+	_ "github.com/eslutz/forwardarr/internal/exectarget"
+	"github.com/eslutz/forwardarr/internal/gluetun"
+	_ "github.com/eslutz/forwardarr/internal/httptarget"
+	"github.com/eslutz/forwardarr/internal/natpmp"
+	_ "github.com/eslutz/forwardarr/internal/qbit"
+	"github.com/eslutz/forwardarr/internal/retry"
+	_ "github.com/eslutz/forwardarr/internal/rtorrent"
 	"github.com/eslutz/forwardarr/internal/server"
 	"github.com/eslutz/forwardarr/internal/sync"
+	"github.com/eslutz/forwardarr/internal/torrent"
+	_ "github.com/eslutz/forwardarr/internal/transmission"
 	"github.com/eslutz/forwardarr/internal/webhook"
 	_ "github.com/eslutz/forwardarr/pkg/version"
 )
@@ -21,23 +33,72 @@ func main() {
 	cfg := config.Load()
 	setupLogging(cfg.LogLevel)
 
+	// Cancelling ctx on a signal aborts startup retries, in-flight client
+	// requests and retry sleeps.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	startupRetryDelay, startupTimeout := normalizeStartupSettings(cfg)
-	startupMaxAttempts := calculateMaxAttempts(startupRetryDelay, startupTimeout)
+	startupMaxAttempts := retry.MaxAttempts(startupRetryDelay, startupTimeout)
+
+	retryPolicy := retry.Policy{
+		Attempts:  cfg.RetryAttempts,
+		BaseDelay: cfg.RetryBaseDelay,
+		MaxDelay:  cfg.RetryMaxDelay,
+		Factor:    cfg.RetryFactor,
+		Jitter:    cfg.RetryJitter,
+	}
+	if err := retryPolicy.Validate(); err != nil {
+		slog.Error("invalid retry configuration", "error", err)
+		os.Exit(1)
+	}
+
+	portSource, err := newPortSource(cfg)
+	if err != nil {
+		slog.Error("invalid port source configuration", "error", err)
+		os.Exit(1)
+	}
+	portFileParser, err := sync.NewPortFileParser(cfg.PortFileFormat, cfg.PortFileField, cfg.PortFileRegex)
+	if err != nil {
+		slog.Error("invalid port file format", "error", err)
+		os.Exit(1)
+	}
+	portSelection, err := sync.ParsePortSelection(cfg.PortSelection)
+	if err != nil {
+		slog.Error("invalid port selection", "error", err)
+		os.Exit(1)
+	}
+	if err := validatePortIndexes(cfg.Targets); err != nil {
+		slog.Error("invalid target configuration", "error", err)
+		os.Exit(1)
+	}
 
 	slog.Info("starting forwardarr",
+		"port_source", cfg.PortSource,
+		"port_selection", portSelection,
 		"gluetun_port_file", cfg.GluetunPortFile,
-		"qbit_addr", cfg.QbitAddr,
+		"port_file_format", portFileParser.Format(),
+		"targets", targetNames(cfg.Targets),
 		"startup_retry_delay", startupRetryDelay,
 		"startup_timeout", startupTimeout,
 		"startup_max_attempts", startupMaxAttempts,
 		"sync_interval", cfg.SyncInterval,
+		"retry_attempts", retryPolicy.Attempts,
+		"retry_base_delay", retryPolicy.BaseDelay,
+		"retry_max_delay", retryPolicy.MaxDelay,
+		"firewalled_timeout", cfg.FirewalledTimeout,
+		"connection_check_interval", cfg.ConnectionCheckInterval,
 		"metrics_port", cfg.MetricsPort,
 		"webhook_enabled", cfg.WebhookEnabled,
 	)
 
-	qbitClient, err := createQbitClientWithRetry(cfg, startupRetryDelay, startupTimeout, startupMaxAttempts)
-	if err != nil {
-		slog.Error("failed to create qBittorrent client", "error", err)
+	targets := connectTargets(ctx, cfg.Targets, retryPolicy, startupRetryDelay, startupTimeout, startupMaxAttempts)
+	if ctx.Err() != nil {
+		slog.Info("received shutdown signal during startup, exiting")
+		return
+	}
+	if len(targets) == 0 {
+		slog.Error("failed to connect to any torrent client target")
 		os.Exit(1)
 	}
 
@@ -49,6 +110,7 @@ func main() {
 			webhook.Template(cfg.WebhookTemplate),
 			cfg.WebhookEvents,
 		)
+		webhookClient.SetRetryPolicy(retryPolicy)
 		slog.Info("webhook notifications enabled",
 			"url", cfg.WebhookURL,
 			"timeout", cfg.WebhookTimeout,
@@ -57,13 +119,27 @@ func main() {
 		)
 	}
 
-	watcher, err := sync.NewWatcher(cfg.GluetunPortFile, qbitClient, webhookClient, cfg.SyncInterval)
+	var watcher *sync.Watcher
+	if portSource != nil {
+		watcher, err = sync.NewSourceWatcher(portSource, cfg.PortPollInterval, targets, webhookClient, cfg.SyncInterval)
+	} else {
+		watcher, err = sync.NewWatcher(cfg.GluetunPortFile, targets, webhookClient, cfg.SyncInterval)
+	}
 	if err != nil {
 		slog.Error("failed to create file watcher", "error", err)
 		os.Exit(1)
 	}
+	watcher.SetPortFileParser(portFileParser)
+	watcher.SetPortSelection(portSelection)
+	watcher.SetFirewalledTimeout(cfg.FirewalledTimeout)
+	watcher.SetConnectionCheckInterval(cfg.ConnectionCheckInterval)
+	watcher.SetRetryPolicy(retryPolicy)
+	if err := watcher.EnableKillSwitch(cfg.KillSwitchDelay, cfg.KillSwitchStateFile); err != nil {
+		slog.Error("failed to enable kill switch", "error", err)
+		os.Exit(1)
+	}
 
-	srv := server.NewServer(cfg.MetricsPort, qbitClient)
+	srv := server.NewServer(cfg.MetricsPort, watcher)
 
 	// Start HTTP server in goroutine
 	go func() {
@@ -73,14 +149,10 @@ func main() {
 		}
 	}()
 
-	// Setup graceful shutdown
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
-
 	// Start watcher in goroutine
 	watcherDone := make(chan error, 1)
 	go func() {
-		watcherDone <- watcher.Start()
+		watcherDone <- watcher.Start(ctx)
 	}()
 
 	// Wait for shutdown signal or watcher error
@@ -92,6 +164,17 @@ func main() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
+		// The watcher sees the same cancellation; wait for it to finish any
+		// sync and background work it was in the middle of.
+		select {
+		case err := <-watcherDone:
+			if err != nil {
+				slog.Error("watcher stopped with error", "error", err)
+			}
+		case <-shutdownCtx.Done():
+			slog.Warn("timed out waiting for watcher to stop")
+		}
+
 		if err := srv.Shutdown(shutdownCtx); err != nil {
 			slog.Error("server shutdown error", "error", err)
 		}
@@ -128,23 +211,132 @@ func setupLogging(level string) {
 	slog.SetDefault(slog.New(handler))
 }
 
-func createQbitClientWithRetry(cfg *config.Config, retryDelay, startupTimeout time.Duration, maxAttempts int) (*qbit.Client, error) {
+// connectTargets connects to every configured target concurrently, each with
+// its own startup retry loop. Targets that cannot be reached within the
+// startup timeout are skipped so they do not block the others.
+func connectTargets(ctx context.Context, cfgTargets []config.Target, policy retry.Policy, retryDelay, startupTimeout time.Duration, maxAttempts int) []sync.Target {
+	clients := make([]torrent.Client, len(cfgTargets))
+	var wg gosync.WaitGroup
+	for i, target := range cfgTargets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := createTorrentClientWithRetry(ctx, target, policy, retryDelay, startupTimeout, maxAttempts)
+			if err != nil {
+				slog.Error("failed to create torrent client, skipping target",
+					"target", target.Name,
+					"type", target.Type,
+					"error", err,
+				)
+				return
+			}
+			clients[i] = client
+		}()
+	}
+	wg.Wait()
+
+	targets := make([]sync.Target, 0, len(cfgTargets))
+	for i, client := range clients {
+		if client != nil {
+			targets = append(targets, sync.Target{Name: cfgTargets[i].Name, Client: client, PortIndex: cfgTargets[i].PortIndex})
+		}
+	}
+	return targets
+}
+
+// newPortSource builds the polled source selected by PORT_SOURCE, or returns
+// nil for the port file.
+func newPortSource(cfg *config.Config) (sync.PortSource, error) {
+	switch cfg.PortSource {
+	case "", "file":
+		return nil, nil
+	case "gluetun":
+		source, err := gluetun.NewSource(gluetun.Config{
+			URL:      cfg.GluetunControlURL,
+			APIKey:   cfg.GluetunAPIKey,
+			Username: cfg.GluetunUser,
+			Password: cfg.GluetunPassword,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	case "command":
+		source, err := command.NewSource(command.Config{
+			Command: cfg.PortCommand,
+			Shell:   cfg.PortCommandShell,
+			Regex:   cfg.PortCommandRegex,
+			Timeout: cfg.PortCommandTimeout,
+			Env:     cfg.PortCommandEnv,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	case "natpmp":
+		source, err := natpmp.NewSource(natpmp.Config{
+			Gateway:      cfg.NATPMPGateway,
+			InternalPort: cfg.NATPMPInternalPort,
+			Lifetime:     cfg.NATPMPLifetime,
+			Timeout:      cfg.NATPMPTimeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	default:
+		return nil, fmt.Errorf("unknown PORT_SOURCE %q", cfg.PortSource)
+	}
+}
+
+// validatePortIndexes rejects negative PORT_INDEX values. Indexes beyond the
+// ports the source reports are only known at sync time.
+func validatePortIndexes(targets []config.Target) error {
+	for _, target := range targets {
+		if target.PortIndex < 0 {
+			return fmt.Errorf("target %s: PORT_INDEX must be at least 1, got %d", target.Name, target.PortIndex)
+		}
+	}
+	return nil
+}
+
+func targetNames(targets []config.Target) []string {
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, target.Name+"="+target.Type)
+	}
+	return names
+}
+
+func createTorrentClientWithRetry(ctx context.Context, target config.Target, policy retry.Policy, retryDelay, startupTimeout time.Duration, maxAttempts int) (torrent.Client, error) {
 	startTime := time.Now()
 	deadline := startTime.Add(startupTimeout)
+	opts := torrent.Options{
+		Name:     target.Name,
+		URL:      target.URL,
+		Username: target.User,
+		Password: target.Pass,
+		Settings: target.Settings,
+		Retry:    policy,
+	}
 
 	var lastErr error
 	attempt := 0
 	for time.Now().Before(deadline) {
 		attempt++
-		slog.Info("connecting to qBittorrent",
+		slog.Info("connecting to torrent client",
+			"target", target.Name,
 			"attempt", attempt,
 			"max_attempts", maxAttempts,
-			"qbit_addr", cfg.QbitAddr,
+			"type", target.Type,
+			"url", target.URL,
 		)
 
-		client, err := qbit.NewClient(cfg.QbitAddr, cfg.QbitUser, cfg.QbitPass)
+		client, err := torrent.New(ctx, target.Type, opts)
 		if err == nil {
-			slog.Info("connected to qBittorrent",
+			slog.Info("connected to torrent client",
+				"target", target.Name,
+				"type", client.Name(),
 				"attempt", attempt,
 				"elapsed", time.Since(startTime),
 			)
@@ -152,22 +344,35 @@ func createQbitClientWithRetry(cfg *config.Config, retryDelay, startupTimeout ti
 		}
 
 		lastErr = err
+		if torrent.IsPermanent(err) {
+			// Retrying bad credentials or a banned IP only extends the ban.
+			slog.Error("torrent client rejected credentials, not retrying",
+				"target", target.Name,
+				"type", target.Type,
+				"kind", torrent.KindOf(err),
+				"error", err,
+			)
+			break
+		}
+
 		remaining := max(time.Until(deadline), 0)
 		shouldRetry := remaining > 0
 		sleep := time.Duration(0)
 		if shouldRetry {
-			sleep = exponentialBackoffDelay(attempt, retryDelay, remaining)
+			sleep = retry.ExponentialBackoff(attempt, retryDelay, remaining)
 		}
 
-		logMsg := "qBittorrent connection failed"
+		logMsg := "torrent client connection failed"
 		if shouldRetry {
-			logMsg = "qBittorrent connection failed, will retry"
+			logMsg = "torrent client connection failed, will retry"
 		}
 
 		slog.Warn(logMsg,
+			"target", target.Name,
 			"attempt", attempt,
 			"max_attempts", maxAttempts,
-			"qbit_addr", cfg.QbitAddr,
+			"type", target.Type,
+			"url", target.URL,
 			"retry_delay", sleep,
 			"remaining_timeout", remaining,
 			"error", err,
@@ -177,10 +382,12 @@ func createQbitClientWithRetry(cfg *config.Config, retryDelay, startupTimeout ti
 			break
 		}
 
-		time.Sleep(sleep)
+		if err := retry.Sleep(ctx, sleep); err != nil {
+			return nil, fmt.Errorf("connecting to %s target %s cancelled: %w", target.Type, target.Name, err)
+		}
 	}
 
-	return nil, fmt.Errorf("failed to connect to qBittorrent after %d attempts within %s: %w", attempt, startupTimeout, lastErr)
+	return nil, fmt.Errorf("failed to connect to %s target %s after %d attempts within %s: %w", target.Type, target.Name, attempt, startupTimeout, lastErr)
 }
 
 func normalizeStartupSettings(cfg *config.Config) (time.Duration, time.Duration) {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/config"
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+func TestCreateTorrentClientWithRetry_StopsOnPermanentError(t *testing.T) {
+	attempts := 0
+	torrent.Register("test-banned", func(ctx context.Context, opts torrent.Options) (torrent.Client, error) {
+		attempts++
+		return nil, torrent.NewError(torrent.KindIPBanned, errors.New("banned"))
+	})
+
+	target := config.Target{Name: "default", Type: "test-banned"}
+	_, err := createTorrentClientWithRetry(context.Background(), target, retry.DefaultPolicy(), 10*time.Millisecond, time.Second, 5)
+	if err == nil {
+		t.Fatal("createTorrentClientWithRetry() error = nil, want error")
+	}
+	if torrent.KindOf(err) != torrent.KindIPBanned {
+		t.Errorf("KindOf() = %q, want %q", torrent.KindOf(err), torrent.KindIPBanned)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+func TestCreateTorrentClientWithRetry_PassesRetryPolicy(t *testing.T) {
+	var got retry.Policy
+	torrent.Register("test-policy", func(ctx context.Context, opts torrent.Options) (torrent.Client, error) {
+		got = opts.Retry
+		return nil, torrent.NewError(torrent.KindBadCredentials, errors.New("rejected"))
+	})
+
+	policy := retry.Policy{Attempts: 5, BaseDelay: time.Second, Factor: 3}
+	target := config.Target{Name: "default", Type: "test-policy"}
+	_, _ = createTorrentClientWithRetry(context.Background(), target, policy, 10*time.Millisecond, time.Second, 5)
+	if got.Attempts != policy.Attempts || got.BaseDelay != policy.BaseDelay || got.Factor != policy.Factor {
+		t.Errorf("Options.Retry = %+v, want %+v", got, policy)
+	}
+}
+
+func TestNewPortSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		command  string
+		gateway  string
+		wantName string
+		wantErr  bool
+	}{
+		{source: "file", wantName: ""},
+		{source: "gluetun", wantName: "gluetun"},
+		{source: "command", command: "echo 51413", wantName: "command"},
+		{source: "command", wantErr: true},
+		{source: "natpmp", gateway: "10.2.0.1", wantName: "natpmp"},
+		{source: "natpmp", wantErr: true},
+		{source: "carrier-pigeon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.Config{PortSource: tt.source, GluetunControlURL: "http://localhost:8000", PortCommand: tt.command, NATPMPGateway: tt.gateway}
+		source, err := newPortSource(cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newPortSource(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+			continue
+		}
+		name := ""
+		if source != nil {
+			name = source.Name()
+		}
+		if name != tt.wantName {
+			t.Errorf("newPortSource(%q) = %q, want %q", tt.source, name, tt.wantName)
+		}
+	}
+}
+
+func TestValidatePortIndexes(t *testing.T) {
+	valid := []config.Target{{Name: "public"}, {Name: "private", PortIndex: 2}}
+	if err := validatePortIndexes(valid); err != nil {
+		t.Errorf("validatePortIndexes() error = %v, want nil", err)
+	}
+
+	invalid := []config.Target{{Name: "private", PortIndex: -1}}
+	if err := validatePortIndexes(invalid); err == nil {
+		t.Error("validatePortIndexes() error = nil, want error for a negative index")
+	}
+}
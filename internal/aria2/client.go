@@ -0,0 +1,359 @@
+package aria2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// ClientType selects the aria2 JSON-RPC backend.
+const ClientType = "aria2"
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+	defaultRPCPath     = "/jsonrpc"
+)
+
+// transport sends one JSON-RPC request and returns the matching response.
+type transport interface {
+	call(ctx context.Context, id string, body []byte) ([]byte, error)
+	// reset drops any connection state so the next call starts fresh, the
+	// equivalent of re-authenticating for a token-based API.
+	reset()
+}
+
+// Client drives aria2 through its JSON-RPC interface over HTTP or WebSocket.
+type Client struct {
+	transport transport
+	secret    string
+	retry     retry.Policy
+
+	mu    gosync.Mutex
+	reqID int
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      string `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("aria2 error %d: %s", e.Code, e.Message)
+}
+
+var _ torrent.Client = (*Client)(nil)
+
+func init() {
+	torrent.Register(ClientType, func(ctx context.Context, opts torrent.Options) (torrent.Client, error) {
+		client, err := NewClient(ctx, opts.URL, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Retry.Attempts > 0 {
+			client.SetRetryPolicy(opts.Retry)
+		}
+		return client, nil
+	})
+}
+
+// NewClient creates an aria2 client for an http(s):// or ws(s):// RPC URL.
+// secret is the --rpc-secret value and may be empty.
+func NewClient(ctx context.Context, rpcURL, secret string) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(rpcURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid aria2 URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid aria2 URL %q: missing host", rpcURL)
+	}
+	if u.Path == "" {
+		u.Path = defaultRPCPath
+	}
+
+	var t transport
+	switch u.Scheme {
+	case "http", "https":
+		t = &httpTransport{url: u.String(), client: &http.Client{Timeout: defaultHTTPTimeout}}
+	case "ws", "wss":
+		t = &wsTransport{url: u.String(), timeout: defaultHTTPTimeout}
+	default:
+		return nil, fmt.Errorf("unsupported aria2 URL scheme %q (use http, https, ws or wss)", u.Scheme)
+	}
+
+	client := &Client{transport: t, secret: secret, retry: retry.DefaultPolicy()}
+	if err := client.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("initial connection failed: %w", err)
+	}
+
+	return client, nil
+}
+
+func (c *Client) Name() string {
+	return ClientType
+}
+
+// SetRetryPolicy replaces the policy for the aria2.getGlobalOption and
+// aria2.changeGlobalOption calls. A reconnect after a dropped connection
+// happens within one attempt.
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retry = policy
+}
+
+// GetPort returns the BitTorrent listen port, or 0 when listen-port and
+// dht-listen-port differ or are ranges, so the watcher resyncs them.
+func (c *Client) GetPort(ctx context.Context) (int, error) {
+	var options map[string]string
+	attempts, err := c.retry.Do(ctx, "get port", func(ctx context.Context) error {
+		if err := c.callWithReconnect(ctx, "aria2.getGlobalOption", nil, &options); err != nil {
+			return fmt.Errorf("failed to get global options: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get global options after %d attempts: %w", attempts, err)
+	}
+	return effectivePort(options["listen-port"], options["dht-listen-port"]), nil
+}
+
+func (c *Client) SetPort(ctx context.Context, port int) error {
+	options := map[string]string{
+		"listen-port":     strconv.Itoa(port),
+		"dht-listen-port": strconv.Itoa(port),
+	}
+
+	attempts, err := c.retry.Do(ctx, "set port", func(ctx context.Context) error {
+		var result string
+		err := c.callWithReconnect(ctx, "aria2.changeGlobalOption", []any{options}, &result)
+		if err == nil && result != "OK" {
+			err = fmt.Errorf("unexpected result %q", result)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to change global options: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set aria2 port after %d attempts: %w", attempts, err)
+	}
+
+	slog.Info("successfully updated aria2 listen ports", "port", port)
+	return nil
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.call(ctx, "aria2.getVersion", nil, nil); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
+// callWithReconnect mirrors qbit's re-login on 403: when the transport fails,
+// the connection is dropped and the call repeated once on a fresh one. A
+// cancelled or expired ctx is returned as is.
+func (c *Client) callWithReconnect(ctx context.Context, method string, params []any, result any) error {
+	err := c.call(ctx, method, params, result)
+
+	var rpcErr *rpcError
+	if err == nil || errors.As(err, &rpcErr) || ctx.Err() != nil {
+		return err
+	}
+
+	slog.Warn("aria2 request failed, reconnecting...", "error", err)
+	c.transport.reset()
+	return c.call(ctx, method, params, result)
+}
+
+func (c *Client) call(ctx context.Context, method string, params []any, result any) error {
+	c.mu.Lock()
+	c.reqID++
+	id := "forwardarr-" + strconv.Itoa(c.reqID)
+	c.mu.Unlock()
+
+	allParams := make([]any, 0, len(params)+1)
+	if c.secret != "" {
+		allParams = append(allParams, "token:"+c.secret)
+	}
+	allParams = append(allParams, params...)
+
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: id, Method: method, Params: allParams})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", method, err)
+	}
+
+	respBody, err := c.transport.call(ctx, id, body)
+	if err != nil {
+		return err
+	}
+
+	var resp rpcResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if resp.Error != nil {
+		// aria2 answers a wrong --rpc-secret with "Unauthorized"; retrying
+		// cannot fix that.
+		if resp.Error.Message == "Unauthorized" {
+			return torrent.NewError(torrent.KindBadCredentials, resp.Error)
+		}
+		return resp.Error
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("failed to decode %s result: %w", method, err)
+		}
+	}
+
+	return nil
+}
+
+// effectivePort returns the single port both options agree on, or 0.
+func effectivePort(listenPort, dhtListenPort string) int {
+	if listenPort != dhtListenPort {
+		return 0
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(listenPort))
+	if err != nil {
+		return 0
+	}
+	return port
+}
+
+type httpTransport struct {
+	url    string
+	client *http.Client
+}
+
+func (t *httpTransport) call(ctx context.Context, _ string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// aria2 reports JSON-RPC errors with 4xx/5xx codes but still sends a
+	// JSON body, so only treat non-JSON responses as transport failures.
+	if resp.StatusCode != http.StatusOK && !json.Valid(respBody) {
+		return nil, &retry.StatusError{Code: resp.StatusCode, Body: string(respBody)}
+	}
+
+	return respBody, nil
+}
+
+func (t *httpTransport) reset() {
+	t.client.CloseIdleConnections()
+}
+
+// wsTransport keeps one websocket open and serialises calls over it. aria2
+// pushes download notifications on the same socket; they are skipped.
+type wsTransport struct {
+	url     string
+	timeout time.Duration
+
+	mu   gosync.Mutex
+	conn *wsConn
+}
+
+func (t *wsTransport) call(ctx context.Context, id string, body []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		conn, err := dialWebsocket(ctx, t.url, t.timeout)
+		if err != nil {
+			return nil, err
+		}
+		t.conn = conn
+	}
+
+	resp, err := t.exchange(ctx, id, body)
+	if err != nil {
+		_ = t.conn.close()
+		t.conn = nil
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *wsTransport) exchange(ctx context.Context, id string, body []byte) ([]byte, error) {
+	deadline := time.Now().Add(t.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := t.conn.setDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+	// Expiring the deadline on cancel unblocks a pending read.
+	conn := t.conn
+	stop := context.AfterFunc(ctx, func() { _ = conn.setDeadline(time.Now()) })
+	defer stop()
+	if err := t.conn.writeMessage(body); err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, err := t.conn.readMessage()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read websocket message: %w", err)
+		}
+
+		var envelope struct {
+			ID     *string `json:"id"`
+			Method string  `json:"method"`
+		}
+		if err := json.Unmarshal(msg, &envelope); err != nil {
+			return nil, fmt.Errorf("failed to decode websocket message: %w", err)
+		}
+		if envelope.ID == nil || *envelope.ID != id {
+			slog.Debug("skipping aria2 websocket message", "method", envelope.Method)
+			continue
+		}
+		return msg, nil
+	}
+}
+
+func (t *wsTransport) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn != nil {
+		_ = t.conn.close()
+		t.conn = nil
+	}
+}
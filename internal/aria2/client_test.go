@@ -0,0 +1,343 @@
+package aria2
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+type fakeAria2 struct {
+	mu       gosync.Mutex
+	secret   string
+	options  map[string]string
+	changes  int
+	failures int
+	// stall makes the HTTP server hold requests until the client gives up.
+	stall    bool
+	requests int
+}
+
+func newFakeAria2(secret string) *fakeAria2 {
+	return &fakeAria2{
+		secret:  secret,
+		options: map[string]string{"listen-port": "6881-6999", "dht-listen-port": "6881-6999"},
+	}
+}
+
+// handle answers one JSON-RPC request the way aria2 does.
+func (f *fakeAria2) handle(t *testing.T, body []byte) []byte {
+	t.Helper()
+
+	var req struct {
+		ID     string            `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Errorf("failed to decode request: %v", err)
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	params := req.Params
+	if f.secret != "" {
+		var token string
+		if len(params) > 0 {
+			_ = json.Unmarshal(params[0], &token)
+		}
+		if token != "token:"+f.secret {
+			resp["error"] = map[string]any{"code": 1, "message": "Unauthorized"}
+			out, _ := json.Marshal(resp)
+			return out
+		}
+		params = params[1:]
+	}
+
+	switch req.Method {
+	case "aria2.getVersion":
+		resp["result"] = map[string]any{"version": "1.37.0"}
+	case "aria2.getGlobalOption":
+		resp["result"] = f.options
+	case "aria2.changeGlobalOption":
+		f.changes++
+		var options map[string]string
+		_ = json.Unmarshal(params[0], &options)
+		for k, v := range options {
+			f.options[k] = v
+		}
+		resp["result"] = "OK"
+	default:
+		resp["error"] = map[string]any{"code": 1, "message": "No such method: " + req.Method}
+	}
+
+	out, _ := json.Marshal(resp)
+	return out
+}
+
+func newHTTPServer(t *testing.T, fake *fakeAria2) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultRPCPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fake.mu.Lock()
+		fake.requests++
+		stall := fake.stall
+		fail := fake.failures > 0
+		if fail {
+			fake.failures--
+		}
+		fake.mu.Unlock()
+		if stall {
+			// The server only notices the client leaving once the body is read.
+			_, _ = io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+			return
+		}
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fake.handle(t, body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newWebsocketServer upgrades connections by hand and replies using the same
+// frame code as the client, unmasked as a server must. When dropAfter is
+// positive each connection is closed after that many responses.
+func newWebsocketServer(t *testing.T, fake *fakeAria2, dropAfter int) (*httptest.Server, *int) {
+	t.Helper()
+	connections := new(int)
+	var mu gosync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("response writer does not support hijacking")
+			return
+		}
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		mu.Lock()
+		*connections++
+		mu.Unlock()
+
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		_ = rw.Flush()
+
+		ws := &wsConn{conn: conn, reader: bufio.NewReader(rw), mask: false}
+		for served := 0; dropAfter <= 0 || served < dropAfter; served++ {
+			msg, err := ws.readMessage()
+			if err != nil {
+				return
+			}
+			// Interleave a notification, as aria2 does for download events.
+			_ = ws.writeFrame(opText, []byte(`{"jsonrpc":"2.0","method":"aria2.onDownloadStart","params":[{"gid":"1"}]}`))
+			_ = ws.writeFrame(opPing, []byte("ping"))
+			if err := ws.writeFrame(opText, fake.handle(t, msg)); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, connections
+}
+
+func TestClient_HTTP(t *testing.T) {
+	fake := newFakeAria2("s3cret")
+	server := newHTTPServer(t, fake)
+
+	client, err := NewClient(context.Background(), server.URL, "s3cret")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	port, err := client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if port != 0 {
+		t.Errorf("GetPort() with port range = %d, want 0", port)
+	}
+
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	if fake.options["listen-port"] != "51413" || fake.options["dht-listen-port"] != "51413" {
+		t.Errorf("options = %v, want both ports 51413", fake.options)
+	}
+
+	port, err = client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if port != 51413 {
+		t.Errorf("GetPort() = %d, want 51413", port)
+	}
+}
+
+func TestClient_HTTPWrongSecret(t *testing.T) {
+	server := newHTTPServer(t, newFakeAria2("s3cret"))
+
+	_, err := NewClient(context.Background(), server.URL, "wrong")
+	if err == nil {
+		t.Fatal("NewClient() error = nil, want error")
+	}
+	if kind := torrent.KindOf(err); kind != torrent.KindBadCredentials {
+		t.Errorf("KindOf() = %q, want %q", kind, torrent.KindBadCredentials)
+	}
+	if !torrent.IsPermanent(err) {
+		t.Error("IsPermanent() = false, want true for a wrong secret")
+	}
+}
+
+func TestClient_HTTPRetry(t *testing.T) {
+	fake := newFakeAria2("")
+	server := newHTTPServer(t, fake)
+
+	client, err := NewClient(context.Background(), server.URL+defaultRPCPath, "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+
+	fake.failures = 3
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	if fake.changes != 1 {
+		t.Errorf("changeGlobalOption calls = %d, want 1", fake.changes)
+	}
+}
+
+func TestClient_HTTPCancelled(t *testing.T) {
+	fake := newFakeAria2("")
+	server := newHTTPServer(t, fake)
+
+	client, err := NewClient(context.Background(), server.URL, "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	fake.mu.Lock()
+	fake.stall = true
+	fake.requests = 0
+	fake.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.GetPort(ctx); err == nil {
+		t.Fatal("GetPort() error = nil, want the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetPort() took %v, want it to stop at the deadline", elapsed)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.requests != 1 {
+		t.Errorf("requests = %d, want 1 without a reconnect after the deadline", fake.requests)
+	}
+}
+
+func TestClient_Websocket(t *testing.T) {
+	fake := newFakeAria2("s3cret")
+	server, connections := newWebsocketServer(t, fake, 0)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	client, err := NewClient(context.Background(), wsURL, "s3cret")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.SetPort(context.Background(), 40000); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	port, err := client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if port != 40000 {
+		t.Errorf("GetPort() = %d, want 40000", port)
+	}
+	if *connections != 1 {
+		t.Errorf("websocket connections = %d, want 1", *connections)
+	}
+}
+
+func TestClient_WebsocketReconnects(t *testing.T) {
+	fake := newFakeAria2("")
+	server, connections := newWebsocketServer(t, fake, 1)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	client, err := NewClient(context.Background(), wsURL, "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// The server drops the socket after the Ping, so this call has to
+	// reconnect before it can succeed.
+	if _, err := client.GetPort(context.Background()); err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if *connections < 2 {
+		t.Errorf("websocket connections = %d, want at least 2", *connections)
+	}
+}
+
+func TestNewClient_InvalidURL(t *testing.T) {
+	for _, rawURL := range []string{"ftp://aria2:6800", "aria2:6800", "http://"} {
+		if _, err := NewClient(context.Background(), rawURL, ""); err == nil {
+			t.Errorf("NewClient(context.Background(), %q) error = nil, want error", rawURL)
+		}
+	}
+}
+
+func TestEffectivePort(t *testing.T) {
+	tests := []struct {
+		listen, dht string
+		want        int
+	}{
+		{"51413", "51413", 51413},
+		{"51413", "6881", 0},
+		{"6881-6999", "6881-6999", 0},
+		{"", "", 0},
+	}
+
+	for _, tt := range tests {
+		if got := effectivePort(tt.listen, tt.dht); got != tt.want {
+			t.Errorf("effectivePort(%q, %q) = %d, want %d", tt.listen, tt.dht, got, tt.want)
+		}
+	}
+}
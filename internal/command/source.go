@@ -0,0 +1,121 @@
+// Package command reads the forwarded port from the output of a command, such
+// as a natpmpc wrapper or a VPN provider's CLI.
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/portlist"
+	"github.com/eslutz/forwardarr/internal/shellcmd"
+)
+
+// Config describes the command run on every poll.
+type Config struct {
+	// Command runs as "<Shell> -c <Command>".
+	Command string
+	Shell   string
+	// Regex finds the port in stdout. Its first capture group is used when
+	// it has one, otherwise the whole match. Without it stdout must hold
+	// only the port.
+	Regex   string
+	Timeout time.Duration
+	// Env names the environment variables passed on to the command besides
+	// PATH and HOME; see shellcmd.Environ.
+	Env []string
+}
+
+// Source runs the command and parses the port from its stdout.
+type Source struct {
+	cfg   Config
+	regex *regexp.Regexp
+}
+
+// NewSource validates the configuration and checks that the shell exists.
+func NewSource(cfg Config) (*Source, error) {
+	if strings.TrimSpace(cfg.Command) == "" {
+		return nil, errors.New("port command is required")
+	}
+	if cfg.Shell == "" {
+		cfg.Shell = shellcmd.DefaultShell
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = shellcmd.DefaultTimeout
+	}
+	if err := shellcmd.CheckShell(cfg.Shell); err != nil {
+		return nil, err
+	}
+
+	source := &Source{cfg: cfg}
+	if cfg.Regex != "" {
+		regex, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port command regex: %w", err)
+		}
+		source.regex = regex
+	}
+	return source, nil
+}
+
+func (s *Source) Name() string {
+	return "command"
+}
+
+// ReadPorts runs the command once. Like an empty port file, a non-zero exit or
+// output without a valid port is logged and returns no ports so the sync is
+// skipped. Only a command that cannot be started or times out is an error.
+func (s *Source) ReadPorts(ctx context.Context) ([]int, error) {
+	output, err := shellcmd.Run(ctx, shellcmd.Command{
+		Line:    s.cfg.Command,
+		Shell:   s.cfg.Shell,
+		Timeout: s.cfg.Timeout,
+		Env:     shellcmd.Environ(s.cfg.Env...),
+	})
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		slog.Warn("port command failed, skipping sync",
+			"status", exitErr.ExitCode(),
+			"stderr", strings.TrimSpace(output.Stderr),
+		)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("port command failed: %w", err)
+	}
+
+	return s.parsePorts(output.Stdout), nil
+}
+
+// parsePorts extracts the ports from the command output: every regex match,
+// or the whole output read as a port list.
+func (s *Source) parsePorts(output string) []int {
+	var ports []int
+	if s.regex != nil {
+		matches := s.regex.FindAllStringSubmatch(output, -1)
+		if matches == nil {
+			slog.Warn("port command output does not match regex, skipping sync", "output", strings.TrimSpace(output), "regex", s.cfg.Regex)
+			return nil
+		}
+		for _, match := range matches {
+			value := match[0]
+			if len(match) > 1 {
+				value = match[1]
+			}
+			ports = append(ports, portlist.Parse(value)...)
+		}
+	} else {
+		ports = portlist.Parse(output)
+	}
+
+	if len(ports) == 0 {
+		slog.Warn("no valid port in command output, skipping sync", "output", strings.TrimSpace(output))
+	}
+	return ports
+}
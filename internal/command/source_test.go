@@ -0,0 +1,80 @@
+package command
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSource_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "missing command", cfg: Config{}},
+		{name: "blank command", cfg: Config{Command: "  "}},
+		{name: "missing shell", cfg: Config{Command: "echo 1", Shell: "/nonexistent/shell"}},
+		{name: "invalid regex", cfg: Config{Command: "echo 1", Regex: "("}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSource(tt.cfg); err == nil {
+				t.Error("NewSource() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestReadPorts(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		regex   string
+		want    []int
+	}{
+		{name: "plain output", command: "echo 51413", want: []int{51413}},
+		{name: "capture group", command: `printf 'Mapped public port 6881 protocol UDP to local port 0 lifetime 60\n'`, regex: `Mapped public port (\d+)`, want: []int{6881}},
+		{name: "whole match", command: "echo port=40000", regex: `\d+`, want: []int{40000}},
+		{name: "list output", command: "echo 51413,6881", want: []int{51413, 6881}},
+		{name: "every regex match", command: `printf 'port 51413\nport 6881\n'`, regex: `port (\d+)`, want: []int{51413, 6881}},
+		{name: "no match", command: "echo waiting", regex: `port (\d+)`},
+		{name: "not a number", command: "echo unknown"},
+		{name: "out of range", command: "echo 70000"},
+		{name: "non-zero exit", command: "echo 51413; echo 'gateway timeout' >&2; exit 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewSource(Config{Command: tt.command, Regex: tt.regex})
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			ports, err := source.ReadPorts(context.Background())
+			if err != nil {
+				t.Fatalf("ReadPorts() error = %v", err)
+			}
+			if !slices.Equal(ports, tt.want) {
+				t.Errorf("ReadPorts() = %v, want %v", ports, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPorts_Timeout(t *testing.T) {
+	source, err := NewSource(Config{Command: "sleep 5", Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+
+	start := time.Now()
+	_, err = source.ReadPorts(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("ReadPorts() error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("ReadPorts() took %v, timeout not enforced", elapsed)
+	}
+}
@@ -0,0 +1,79 @@
+package command
+
+import (
+	"context"
+	"path/filepath"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/sync"
+)
+
+// recordingClient is an in-memory torrent.Client that records every port set.
+type recordingClient struct {
+	mu   gosync.Mutex
+	port int
+	set  []int
+}
+
+func (c *recordingClient) Name() string { return "fake" }
+
+func (c *recordingClient) GetPort(context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.port, nil
+}
+
+func (c *recordingClient) SetPort(_ context.Context, port int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.port = port
+	c.set = append(c.set, port)
+	return nil
+}
+
+func (c *recordingClient) Ping(context.Context) error { return nil }
+
+func (c *recordingClient) ports() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int(nil), c.set...)
+}
+
+func TestWatcherRunsCommandOncePerPoll(t *testing.T) {
+	// Every run reports the next port, so a poll that ran the command twice
+	// would skip one.
+	runs := filepath.Join(t.TempDir(), "runs")
+	source, err := NewSource(Config{Command: `echo run >> "` + runs + `"; echo $((50000 + $(wc -l < "` + runs + `")))`})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	client := &recordingClient{port: 1}
+	watcher, err := sync.NewSourceWatcher(source, 20*time.Millisecond, []sync.Target{{Name: "a", Client: client}}, nil, 0)
+	if err != nil {
+		t.Fatalf("NewSourceWatcher() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Start(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(client.ports()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	set := client.ports()
+	if len(set) < 3 {
+		t.Fatalf("ports set = %v, want at least 3", set)
+	}
+	for i, port := range set {
+		if want := 50001 + i; port != want {
+			t.Fatalf("ports set = %v, want consecutive ports from 50001", set)
+		}
+	}
+}
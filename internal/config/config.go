@@ -8,41 +8,199 @@ import (
 )
 
 type Config struct {
-	GluetunPortFile   string
-	QbitAddr          string
-	QbitUser          string
-	QbitPass          string
-	StartupRetryDelay time.Duration
-	StartupTimeout    time.Duration
-	SyncInterval      time.Duration
-	MetricsPort       string
-	LogLevel          string
-	WebhookURL        string
-	WebhookEnabled    bool
-	WebhookTimeout    time.Duration
-	WebhookTemplate   string
-	WebhookEvents     []string
+	GluetunPortFile string
+	// PortFileFormat is how GluetunPortFile is read: "plain", "json" (port
+	// at the PortFileField path), "env" (KEY=VALUE with the PortFileField
+	// key) or "regex" (PortFileRegex capture).
+	PortFileFormat string
+	PortFileField  string
+	PortFileRegex  string
+	// PortSource selects where the forwarded port is read from: "file"
+	// watches GluetunPortFile, "gluetun" polls the control server,
+	// "command" runs PortCommand and "natpmp" maps a port on NATPMPGateway,
+	// each every PortPollInterval.
+	PortSource       string
+	PortPollInterval time.Duration
+	// PortSelection picks the port for targets without a PortIndex when the
+	// source reports several: "first", "lowest" or a 1-based position.
+	PortSelection      string
+	GluetunControlURL  string
+	GluetunAPIKey      string
+	GluetunUser        string
+	GluetunPassword    string
+	PortCommand        string
+	PortCommandShell   string
+	PortCommandRegex   string
+	PortCommandTimeout time.Duration
+	// PortCommandEnv names the variables passed on to PortCommand besides
+	// PATH and HOME.
+	PortCommandEnv     []string
+	NATPMPGateway      string
+	NATPMPInternalPort int
+	NATPMPLifetime     time.Duration
+	NATPMPTimeout      time.Duration
+	Targets            []Target
+	TorrentClientType  string
+	QbitAddr           string
+	QbitUser           string
+	QbitPass           string
+	StartupRetryDelay  time.Duration
+	StartupTimeout     time.Duration
+	SyncInterval       time.Duration
+	// FirewalledTimeout is how long a target may report firewalled before a
+	// resync is forced; zero disables the resync. ConnectionCheckInterval is
+	// how often the status is read between syncs; zero reads it only during
+	// syncs.
+	FirewalledTimeout       time.Duration
+	ConnectionCheckInterval time.Duration
+	// KillSwitchDelay is how long the forwarded port may be unavailable
+	// before opted-in targets pause torrents; the paused set is kept in
+	// KillSwitchStateFile.
+	KillSwitchDelay     time.Duration
+	KillSwitchStateFile string
+	// RetryAttempts, RetryBaseDelay, RetryMaxDelay, RetryFactor and
+	// RetryJitter make up the retry policy for client requests and webhook
+	// deliveries.
+	RetryAttempts   int
+	RetryBaseDelay  time.Duration
+	RetryMaxDelay   time.Duration
+	RetryFactor     float64
+	RetryJitter     bool
+	MetricsPort     string
+	LogLevel        string
+	WebhookURL      string
+	WebhookEnabled  bool
+	WebhookTimeout  time.Duration
+	WebhookTemplate string
+	WebhookEvents   []string
 }
 
+// Target is one torrent client the forwarded port is pushed to.
+type Target struct {
+	Name string
+	Type string
+	URL  string
+	User string
+	Pass string
+	// PortIndex is the 1-based position of the forwarded port this target
+	// receives; zero uses PortSelection.
+	PortIndex int
+	// Settings holds every variable under the target's prefix with the prefix
+	// stripped (e.g. TARGET_HOOK_METHOD becomes "METHOD"). Backends read
+	// their own options from it.
+	Settings map[string]string
+}
+
+// DefaultTargetName names the single target built from TORRENT_CLIENT_*
+// when TARGETS is not set.
+const DefaultTargetName = "default"
+
 func Load() *Config {
 	webhookURL := getEnv("WEBHOOK_URL", "")
 	webhookEvents := getEnv("WEBHOOK_EVENTS", "port_changed")
-	return &Config{
-		GluetunPortFile:   getEnv("GLUETUN_PORT_FILE", "/tmp/gluetun/forwarded_port"),
-		QbitAddr:          getEnv("TORRENT_CLIENT_URL", "http://localhost:8080"),
-		QbitUser:          getEnv("TORRENT_CLIENT_USER", "admin"),
-		QbitPass:          getEnv("TORRENT_CLIENT_PASSWORD", "adminadmin"),
-		StartupRetryDelay: getDurationEnv("STARTUP_RETRY_DELAY", 5*time.Second),
-		StartupTimeout:    getDurationEnv("STARTUP_TIMEOUT", 120*time.Second),
-		SyncInterval:      getDurationEnv("SYNC_INTERVAL", 5*time.Minute),
-		MetricsPort:       getEnv("METRICS_PORT", "9090"),
-		LogLevel:          getEnv("LOG_LEVEL", "info"),
-		WebhookURL:        webhookURL,
-		WebhookEnabled:    webhookURL != "",
-		WebhookTimeout:    getDurationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
-		WebhookTemplate:   getEnv("WEBHOOK_TEMPLATE", "json"),
-		WebhookEvents:     parseEvents(webhookEvents),
+	cfg := &Config{
+		GluetunPortFile:         getEnv("GLUETUN_PORT_FILE", "/tmp/gluetun/forwarded_port"),
+		PortFileFormat:          strings.ToLower(getEnv("PORT_FILE_FORMAT", "plain")),
+		PortFileField:           getEnv("PORT_FILE_FIELD", ""),
+		PortFileRegex:           getEnv("PORT_FILE_REGEX", ""),
+		PortSource:              strings.ToLower(getEnv("PORT_SOURCE", "file")),
+		PortPollInterval:        getDurationEnv("PORT_POLL_INTERVAL", 30*time.Second),
+		PortSelection:           getEnv("PORT_SELECTION", "first"),
+		GluetunControlURL:       getEnv("GLUETUN_CONTROL_URL", "http://localhost:8000"),
+		GluetunAPIKey:           getEnv("GLUETUN_API_KEY", ""),
+		GluetunUser:             getEnv("GLUETUN_USER", ""),
+		GluetunPassword:         getEnv("GLUETUN_PASSWORD", ""),
+		PortCommand:             getEnv("PORT_COMMAND", ""),
+		PortCommandShell:        getEnv("PORT_COMMAND_SHELL", "/bin/sh"),
+		PortCommandRegex:        getEnv("PORT_COMMAND_REGEX", ""),
+		PortCommandTimeout:      getDurationEnv("PORT_COMMAND_TIMEOUT", 30*time.Second),
+		PortCommandEnv:          getListEnv("PORT_COMMAND_ENV"),
+		NATPMPGateway:           getEnv("NATPMP_GATEWAY", ""),
+		NATPMPInternalPort:      getIntEnv("NATPMP_INTERNAL_PORT", 1),
+		NATPMPLifetime:          getDurationEnv("NATPMP_LIFETIME", 60*time.Second),
+		NATPMPTimeout:           getDurationEnv("NATPMP_TIMEOUT", 5*time.Second),
+		TorrentClientType:       getEnv("TORRENT_CLIENT_TYPE", "qbittorrent"),
+		QbitAddr:                getEnv("TORRENT_CLIENT_URL", "http://localhost:8080"),
+		QbitUser:                getEnv("TORRENT_CLIENT_USER", "admin"),
+		QbitPass:                getEnv("TORRENT_CLIENT_PASSWORD", "adminadmin"),
+		StartupRetryDelay:       getDurationEnv("STARTUP_RETRY_DELAY", 5*time.Second),
+		StartupTimeout:          getDurationEnv("STARTUP_TIMEOUT", 120*time.Second),
+		SyncInterval:            getDurationEnv("SYNC_INTERVAL", 5*time.Minute),
+		FirewalledTimeout:       getDurationEnv("FIREWALLED_TIMEOUT", 15*time.Minute),
+		ConnectionCheckInterval: getDurationEnv("CONNECTION_CHECK_INTERVAL", time.Minute),
+		KillSwitchDelay:         getDurationEnv("KILL_SWITCH_DELAY", time.Minute),
+		KillSwitchStateFile:     getEnv("KILL_SWITCH_STATE_FILE", "/tmp/forwardarr/kill-switch.json"),
+		RetryAttempts:           getIntEnv("RETRY_ATTEMPTS", 3),
+		RetryBaseDelay:          getDurationEnv("RETRY_BASE_DELAY", 2*time.Second),
+		RetryMaxDelay:           getDurationEnv("RETRY_MAX_DELAY", 30*time.Second),
+		RetryFactor:             getFloatEnv("RETRY_FACTOR", 2),
+		RetryJitter:             getBoolEnv("RETRY_JITTER", true),
+		MetricsPort:             getEnv("METRICS_PORT", "9090"),
+		LogLevel:                getEnv("LOG_LEVEL", "info"),
+		WebhookURL:              webhookURL,
+		WebhookEnabled:          webhookURL != "",
+		WebhookTimeout:          getDurationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookTemplate:         getEnv("WEBHOOK_TEMPLATE", "json"),
+		WebhookEvents:           parseEvents(webhookEvents),
+	}
+	cfg.Targets = loadTargets(getEnv("TARGETS", ""), cfg)
+	return cfg
+}
+
+// loadTargets builds the target list from TARGETS, a comma-separated list of
+// names. Each name reads TARGET_<NAME>_TYPE, _URL, _USER and _PASSWORD and
+// falls back to the TORRENT_CLIENT_* values for anything left unset.
+// TARGET_<NAME>_PORT_INDEX is per target and has no fallback.
+func loadTargets(names string, cfg *Config) []Target {
+	defaults := Target{
+		Name:     DefaultTargetName,
+		Type:     cfg.TorrentClientType,
+		URL:      cfg.QbitAddr,
+		User:     cfg.QbitUser,
+		Pass:     cfg.QbitPass,
+		Settings: getPrefixedEnv("TORRENT_CLIENT_"),
+	}
+
+	var targets []Target
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		prefix := targetEnvPrefix(name)
+		targets = append(targets, Target{
+			Name:      name,
+			Type:      getEnv(prefix+"TYPE", defaults.Type),
+			URL:       getEnv(prefix+"URL", defaults.URL),
+			User:      getEnv(prefix+"USER", defaults.User),
+			Pass:      getEnv(prefix+"PASSWORD", defaults.Pass),
+			PortIndex: getIntEnv(prefix+"PORT_INDEX", 0),
+			Settings:  getPrefixedEnv(prefix),
+		})
+	}
+
+	if len(targets) == 0 {
+		return []Target{defaults}
 	}
+	return targets
+}
+
+// targetEnvPrefix maps a target name to its environment variable prefix,
+// e.g. "private-1" becomes "TARGET_PRIVATE_1_".
+func targetEnvPrefix(name string) string {
+	key := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	return "TARGET_" + key + "_"
 }
 
 func parseEvents(events string) []string {
@@ -59,6 +217,22 @@ func parseEvents(events string) []string {
 	return result
 }
 
+// getPrefixedEnv returns all non-empty variables starting with prefix, keyed
+// by the remainder of their name.
+func getPrefixedEnv(prefix string) map[string]string {
+	values := make(map[string]string)
+	for _, entry := range os.Environ() {
+		key, value, found := strings.Cut(entry, "=")
+		if !found || value == "" || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if name := strings.TrimPrefix(key, prefix); name != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -66,6 +240,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getListEnv splits a comma-separated variable, dropping empty entries.
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if seconds, err := strconv.Atoi(value); err == nil {
@@ -74,3 +259,30 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -16,48 +17,122 @@ func TestLoad(t *testing.T) {
 			name:    "default values",
 			envVars: map[string]string{},
 			expected: &Config{
-				GluetunPortFile: "/tmp/gluetun/forwarded_port",
-				QbitAddr:        "http://localhost:8080",
-				QbitUser:        "admin",
-				QbitPass:        "adminadmin",
-				SyncInterval:    5 * time.Minute,
-				MetricsPort:     "9090",
-				LogLevel:        "info",
-				WebhookURL:      "",
-				WebhookEnabled:  false,
-				WebhookTimeout:  10 * time.Second,
-				WebhookTemplate: "json",
-				WebhookEvents:   []string{"port_changed"},
+				GluetunPortFile:         "/tmp/gluetun/forwarded_port",
+				PortFileFormat:          "plain",
+				PortSource:              "file",
+				PortPollInterval:        30 * time.Second,
+				PortSelection:           "first",
+				GluetunControlURL:       "http://localhost:8000",
+				PortCommandShell:        "/bin/sh",
+				PortCommandTimeout:      30 * time.Second,
+				NATPMPInternalPort:      1,
+				NATPMPLifetime:          60 * time.Second,
+				NATPMPTimeout:           5 * time.Second,
+				TorrentClientType:       "qbittorrent",
+				QbitAddr:                "http://localhost:8080",
+				QbitUser:                "admin",
+				QbitPass:                "adminadmin",
+				SyncInterval:            5 * time.Minute,
+				FirewalledTimeout:       15 * time.Minute,
+				ConnectionCheckInterval: time.Minute,
+				KillSwitchDelay:         time.Minute,
+				KillSwitchStateFile:     "/tmp/forwardarr/kill-switch.json",
+				RetryAttempts:           3,
+				RetryBaseDelay:          2 * time.Second,
+				RetryMaxDelay:           30 * time.Second,
+				RetryFactor:             2,
+				RetryJitter:             true,
+				MetricsPort:             "9090",
+				LogLevel:                "info",
+				WebhookURL:              "",
+				WebhookEnabled:          false,
+				WebhookTimeout:          10 * time.Second,
+				WebhookTemplate:         "json",
+				WebhookEvents:           []string{"port_changed"},
 			},
 		},
 		{
 			name: "custom values",
 			envVars: map[string]string{
-				"GLUETUN_PORT_FILE":       "/custom/path/port",
-				"TORRENT_CLIENT_URL":      "http://custom:9090",
-				"TORRENT_CLIENT_USER":     "testuser",
-				"TORRENT_CLIENT_PASSWORD": "testpass",
-				"SYNC_INTERVAL":           "120",
-				"METRICS_PORT":            "8080",
-				"LOG_LEVEL":               "debug",
-				"WEBHOOK_URL":             "http://example.com/webhook",
-				"WEBHOOK_TIMEOUT":         "30",
-				"WEBHOOK_TEMPLATE":        "discord",
-				"WEBHOOK_EVENTS":          "port_changed,sync_error",
+				"GLUETUN_PORT_FILE":         "/custom/path/port",
+				"PORT_FILE_FORMAT":          "JSON",
+				"PORT_FILE_FIELD":           "data.port",
+				"PORT_FILE_REGEX":           `port=(\d+)`,
+				"PORT_SOURCE":               "Gluetun",
+				"PORT_POLL_INTERVAL":        "10",
+				"PORT_SELECTION":            "lowest",
+				"GLUETUN_CONTROL_URL":       "http://gluetun:8000",
+				"GLUETUN_API_KEY":           "secret",
+				"PORT_COMMAND":              "natpmpc -g 10.2.0.1",
+				"PORT_COMMAND_SHELL":        "/bin/bash",
+				"PORT_COMMAND_REGEX":        `port (\d+)`,
+				"PORT_COMMAND_TIMEOUT":      "5",
+				"PORT_COMMAND_ENV":          "PROTON_USER, PROTON_PASS",
+				"NATPMP_GATEWAY":            "10.2.0.1",
+				"NATPMP_INTERNAL_PORT":      "1",
+				"NATPMP_LIFETIME":           "120",
+				"NATPMP_TIMEOUT":            "2",
+				"TORRENT_CLIENT_TYPE":       "transmission",
+				"TORRENT_CLIENT_URL":        "http://custom:9090",
+				"TORRENT_CLIENT_USER":       "testuser",
+				"TORRENT_CLIENT_PASSWORD":   "testpass",
+				"SYNC_INTERVAL":             "120",
+				"FIREWALLED_TIMEOUT":        "600",
+				"CONNECTION_CHECK_INTERVAL": "120",
+				"KILL_SWITCH_DELAY":         "30",
+				"KILL_SWITCH_STATE_FILE":    "/data/kill-switch.json",
+				"RETRY_ATTEMPTS":            "5",
+				"RETRY_BASE_DELAY":          "1",
+				"RETRY_MAX_DELAY":           "10",
+				"RETRY_FACTOR":              "1.5",
+				"RETRY_JITTER":              "false",
+				"METRICS_PORT":              "8080",
+				"LOG_LEVEL":                 "debug",
+				"WEBHOOK_URL":               "http://example.com/webhook",
+				"WEBHOOK_TIMEOUT":           "30",
+				"WEBHOOK_TEMPLATE":          "discord",
+				"WEBHOOK_EVENTS":            "port_changed,sync_error",
 			},
 			expected: &Config{
-				GluetunPortFile: "/custom/path/port",
-				QbitAddr:        "http://custom:9090",
-				QbitUser:        "testuser",
-				QbitPass:        "testpass",
-				SyncInterval:    120 * time.Second,
-				MetricsPort:     "8080",
-				LogLevel:        "debug",
-				WebhookURL:      "http://example.com/webhook",
-				WebhookEnabled:  true,
-				WebhookTimeout:  30 * time.Second,
-				WebhookTemplate: "discord",
-				WebhookEvents:   []string{"port_changed", "sync_error"},
+				GluetunPortFile:         "/custom/path/port",
+				PortFileFormat:          "json",
+				PortFileField:           "data.port",
+				PortFileRegex:           `port=(\d+)`,
+				PortSource:              "gluetun",
+				PortPollInterval:        10 * time.Second,
+				PortSelection:           "lowest",
+				GluetunControlURL:       "http://gluetun:8000",
+				GluetunAPIKey:           "secret",
+				PortCommand:             "natpmpc -g 10.2.0.1",
+				PortCommandShell:        "/bin/bash",
+				PortCommandRegex:        `port (\d+)`,
+				PortCommandTimeout:      5 * time.Second,
+				PortCommandEnv:          []string{"PROTON_USER", "PROTON_PASS"},
+				NATPMPGateway:           "10.2.0.1",
+				NATPMPInternalPort:      1,
+				NATPMPLifetime:          120 * time.Second,
+				NATPMPTimeout:           2 * time.Second,
+				TorrentClientType:       "transmission",
+				QbitAddr:                "http://custom:9090",
+				QbitUser:                "testuser",
+				QbitPass:                "testpass",
+				SyncInterval:            120 * time.Second,
+				FirewalledTimeout:       10 * time.Minute,
+				ConnectionCheckInterval: 2 * time.Minute,
+				KillSwitchDelay:         30 * time.Second,
+				KillSwitchStateFile:     "/data/kill-switch.json",
+				RetryAttempts:           5,
+				RetryBaseDelay:          time.Second,
+				RetryMaxDelay:           10 * time.Second,
+				RetryFactor:             1.5,
+				RetryJitter:             false,
+				MetricsPort:             "8080",
+				LogLevel:                "debug",
+				WebhookURL:              "http://example.com/webhook",
+				WebhookEnabled:          true,
+				WebhookTimeout:          30 * time.Second,
+				WebhookTemplate:         "discord",
+				WebhookEvents:           []string{"port_changed", "sync_error"},
 			},
 		},
 		{
@@ -67,18 +142,38 @@ func TestLoad(t *testing.T) {
 				"LOG_LEVEL":           "warn",
 			},
 			expected: &Config{
-				GluetunPortFile: "/tmp/gluetun/forwarded_port",
-				QbitAddr:        "http://localhost:8080",
-				QbitUser:        "myuser",
-				QbitPass:        "adminadmin",
-				SyncInterval:    5 * time.Minute,
-				MetricsPort:     "9090",
-				LogLevel:        "warn",
-				WebhookURL:      "",
-				WebhookEnabled:  false,
-				WebhookTimeout:  10 * time.Second,
-				WebhookTemplate: "json",
-				WebhookEvents:   []string{"port_changed"},
+				GluetunPortFile:         "/tmp/gluetun/forwarded_port",
+				PortFileFormat:          "plain",
+				PortSource:              "file",
+				PortPollInterval:        30 * time.Second,
+				PortSelection:           "first",
+				GluetunControlURL:       "http://localhost:8000",
+				PortCommandShell:        "/bin/sh",
+				PortCommandTimeout:      30 * time.Second,
+				NATPMPInternalPort:      1,
+				NATPMPLifetime:          60 * time.Second,
+				NATPMPTimeout:           5 * time.Second,
+				TorrentClientType:       "qbittorrent",
+				QbitAddr:                "http://localhost:8080",
+				QbitUser:                "myuser",
+				QbitPass:                "adminadmin",
+				SyncInterval:            5 * time.Minute,
+				FirewalledTimeout:       15 * time.Minute,
+				ConnectionCheckInterval: time.Minute,
+				KillSwitchDelay:         time.Minute,
+				KillSwitchStateFile:     "/tmp/forwardarr/kill-switch.json",
+				RetryAttempts:           3,
+				RetryBaseDelay:          2 * time.Second,
+				RetryMaxDelay:           30 * time.Second,
+				RetryFactor:             2,
+				RetryJitter:             true,
+				MetricsPort:             "9090",
+				LogLevel:                "warn",
+				WebhookURL:              "",
+				WebhookEnabled:          false,
+				WebhookTimeout:          10 * time.Second,
+				WebhookTemplate:         "json",
+				WebhookEvents:           []string{"port_changed"},
 			},
 		},
 		{
@@ -87,18 +182,38 @@ func TestLoad(t *testing.T) {
 				"SYNC_INTERVAL": "invalid",
 			},
 			expected: &Config{
-				GluetunPortFile: "/tmp/gluetun/forwarded_port",
-				QbitAddr:        "http://localhost:8080",
-				QbitUser:        "admin",
-				QbitPass:        "adminadmin",
-				SyncInterval:    5 * time.Minute,
-				MetricsPort:     "9090",
-				LogLevel:        "info",
-				WebhookURL:      "",
-				WebhookEnabled:  false,
-				WebhookTimeout:  10 * time.Second,
-				WebhookTemplate: "json",
-				WebhookEvents:   []string{"port_changed"},
+				GluetunPortFile:         "/tmp/gluetun/forwarded_port",
+				PortFileFormat:          "plain",
+				PortSource:              "file",
+				PortPollInterval:        30 * time.Second,
+				PortSelection:           "first",
+				GluetunControlURL:       "http://localhost:8000",
+				PortCommandShell:        "/bin/sh",
+				PortCommandTimeout:      30 * time.Second,
+				NATPMPInternalPort:      1,
+				NATPMPLifetime:          60 * time.Second,
+				NATPMPTimeout:           5 * time.Second,
+				TorrentClientType:       "qbittorrent",
+				QbitAddr:                "http://localhost:8080",
+				QbitUser:                "admin",
+				QbitPass:                "adminadmin",
+				SyncInterval:            5 * time.Minute,
+				FirewalledTimeout:       15 * time.Minute,
+				ConnectionCheckInterval: time.Minute,
+				KillSwitchDelay:         time.Minute,
+				KillSwitchStateFile:     "/tmp/forwardarr/kill-switch.json",
+				RetryAttempts:           3,
+				RetryBaseDelay:          2 * time.Second,
+				RetryMaxDelay:           30 * time.Second,
+				RetryFactor:             2,
+				RetryJitter:             true,
+				MetricsPort:             "9090",
+				LogLevel:                "info",
+				WebhookURL:              "",
+				WebhookEnabled:          false,
+				WebhookTimeout:          10 * time.Second,
+				WebhookTemplate:         "json",
+				WebhookEvents:           []string{"port_changed"},
 			},
 		},
 	}
@@ -120,6 +235,44 @@ func TestLoad(t *testing.T) {
 			if cfg.GluetunPortFile != tt.expected.GluetunPortFile {
 				t.Errorf("GluetunPortFile = %v, want %v", cfg.GluetunPortFile, tt.expected.GluetunPortFile)
 			}
+			if cfg.PortFileFormat != tt.expected.PortFileFormat || cfg.PortFileField != tt.expected.PortFileField || cfg.PortFileRegex != tt.expected.PortFileRegex {
+				t.Errorf("PortFile format/field/regex = %v/%v/%v, want %v/%v/%v",
+					cfg.PortFileFormat, cfg.PortFileField, cfg.PortFileRegex,
+					tt.expected.PortFileFormat, tt.expected.PortFileField, tt.expected.PortFileRegex)
+			}
+			if cfg.NATPMPGateway != tt.expected.NATPMPGateway || cfg.NATPMPInternalPort != tt.expected.NATPMPInternalPort ||
+				cfg.NATPMPLifetime != tt.expected.NATPMPLifetime || cfg.NATPMPTimeout != tt.expected.NATPMPTimeout {
+				t.Errorf("NATPMP = %v/%v/%v/%v, want %v/%v/%v/%v",
+					cfg.NATPMPGateway, cfg.NATPMPInternalPort, cfg.NATPMPLifetime, cfg.NATPMPTimeout,
+					tt.expected.NATPMPGateway, tt.expected.NATPMPInternalPort, tt.expected.NATPMPLifetime, tt.expected.NATPMPTimeout)
+			}
+			if cfg.PortSource != tt.expected.PortSource {
+				t.Errorf("PortSource = %v, want %v", cfg.PortSource, tt.expected.PortSource)
+			}
+			if cfg.PortSelection != tt.expected.PortSelection {
+				t.Errorf("PortSelection = %v, want %v", cfg.PortSelection, tt.expected.PortSelection)
+			}
+			if cfg.PortPollInterval != tt.expected.PortPollInterval {
+				t.Errorf("PortPollInterval = %v, want %v", cfg.PortPollInterval, tt.expected.PortPollInterval)
+			}
+			if cfg.GluetunControlURL != tt.expected.GluetunControlURL {
+				t.Errorf("GluetunControlURL = %v, want %v", cfg.GluetunControlURL, tt.expected.GluetunControlURL)
+			}
+			if cfg.GluetunAPIKey != tt.expected.GluetunAPIKey {
+				t.Errorf("GluetunAPIKey = %v, want %v", cfg.GluetunAPIKey, tt.expected.GluetunAPIKey)
+			}
+			if cfg.PortCommand != tt.expected.PortCommand || cfg.PortCommandShell != tt.expected.PortCommandShell ||
+				cfg.PortCommandRegex != tt.expected.PortCommandRegex || cfg.PortCommandTimeout != tt.expected.PortCommandTimeout {
+				t.Errorf("PortCommand settings = %q, %q, %q, %v, want %q, %q, %q, %v",
+					cfg.PortCommand, cfg.PortCommandShell, cfg.PortCommandRegex, cfg.PortCommandTimeout,
+					tt.expected.PortCommand, tt.expected.PortCommandShell, tt.expected.PortCommandRegex, tt.expected.PortCommandTimeout)
+			}
+			if !reflect.DeepEqual(cfg.PortCommandEnv, tt.expected.PortCommandEnv) {
+				t.Errorf("PortCommandEnv = %v, want %v", cfg.PortCommandEnv, tt.expected.PortCommandEnv)
+			}
+			if cfg.TorrentClientType != tt.expected.TorrentClientType {
+				t.Errorf("TorrentClientType = %v, want %v", cfg.TorrentClientType, tt.expected.TorrentClientType)
+			}
 			if cfg.QbitAddr != tt.expected.QbitAddr {
 				t.Errorf("QbitAddr = %v, want %v", cfg.QbitAddr, tt.expected.QbitAddr)
 			}
@@ -132,6 +285,33 @@ func TestLoad(t *testing.T) {
 			if cfg.SyncInterval != tt.expected.SyncInterval {
 				t.Errorf("SyncInterval = %v, want %v", cfg.SyncInterval, tt.expected.SyncInterval)
 			}
+			if cfg.FirewalledTimeout != tt.expected.FirewalledTimeout {
+				t.Errorf("FirewalledTimeout = %v, want %v", cfg.FirewalledTimeout, tt.expected.FirewalledTimeout)
+			}
+			if cfg.ConnectionCheckInterval != tt.expected.ConnectionCheckInterval {
+				t.Errorf("ConnectionCheckInterval = %v, want %v", cfg.ConnectionCheckInterval, tt.expected.ConnectionCheckInterval)
+			}
+			if cfg.KillSwitchDelay != tt.expected.KillSwitchDelay {
+				t.Errorf("KillSwitchDelay = %v, want %v", cfg.KillSwitchDelay, tt.expected.KillSwitchDelay)
+			}
+			if cfg.KillSwitchStateFile != tt.expected.KillSwitchStateFile {
+				t.Errorf("KillSwitchStateFile = %v, want %v", cfg.KillSwitchStateFile, tt.expected.KillSwitchStateFile)
+			}
+			if cfg.RetryAttempts != tt.expected.RetryAttempts {
+				t.Errorf("RetryAttempts = %v, want %v", cfg.RetryAttempts, tt.expected.RetryAttempts)
+			}
+			if cfg.RetryBaseDelay != tt.expected.RetryBaseDelay {
+				t.Errorf("RetryBaseDelay = %v, want %v", cfg.RetryBaseDelay, tt.expected.RetryBaseDelay)
+			}
+			if cfg.RetryMaxDelay != tt.expected.RetryMaxDelay {
+				t.Errorf("RetryMaxDelay = %v, want %v", cfg.RetryMaxDelay, tt.expected.RetryMaxDelay)
+			}
+			if cfg.RetryFactor != tt.expected.RetryFactor {
+				t.Errorf("RetryFactor = %v, want %v", cfg.RetryFactor, tt.expected.RetryFactor)
+			}
+			if cfg.RetryJitter != tt.expected.RetryJitter {
+				t.Errorf("RetryJitter = %v, want %v", cfg.RetryJitter, tt.expected.RetryJitter)
+			}
 			if cfg.MetricsPort != tt.expected.MetricsPort {
 				t.Errorf("MetricsPort = %v, want %v", cfg.MetricsPort, tt.expected.MetricsPort)
 			}
@@ -251,3 +431,106 @@ func TestGetDurationEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRetryEnv(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("TEST_INT", "7")
+	t.Setenv("TEST_FLOAT", "2.5")
+	t.Setenv("TEST_BOOL", "false")
+	t.Setenv("TEST_INVALID", "invalid")
+
+	if got := getIntEnv("TEST_INT", 3); got != 7 {
+		t.Errorf("getIntEnv() = %d, want 7", got)
+	}
+	if got := getIntEnv("TEST_INVALID", 3); got != 3 {
+		t.Errorf("getIntEnv() with invalid value = %d, want 3", got)
+	}
+	if got := getFloatEnv("TEST_FLOAT", 2); got != 2.5 {
+		t.Errorf("getFloatEnv() = %v, want 2.5", got)
+	}
+	if got := getFloatEnv("TEST_INVALID", 2); got != 2 {
+		t.Errorf("getFloatEnv() with invalid value = %v, want 2", got)
+	}
+	if got := getBoolEnv("TEST_BOOL", true); got {
+		t.Error("getBoolEnv() = true, want false")
+	}
+	if got := getBoolEnv("TEST_INVALID", true); !got {
+		t.Error("getBoolEnv() with invalid value = false, want true")
+	}
+}
+
+func TestLoadTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		envVars  map[string]string
+		expected []Target
+	}{
+		{
+			name: "single default target from TORRENT_CLIENT_*",
+			envVars: map[string]string{
+				"TORRENT_CLIENT_TYPE": "transmission",
+				"TORRENT_CLIENT_URL":  "http://transmission:9091",
+			},
+			expected: []Target{
+				{
+					Name: DefaultTargetName, Type: "transmission", URL: "http://transmission:9091", User: "admin", Pass: "adminadmin",
+					Settings: map[string]string{"TYPE": "transmission", "URL": "http://transmission:9091"},
+				},
+			},
+		},
+		{
+			name: "named targets with shared defaults",
+			envVars: map[string]string{
+				"TARGETS":                     "public, Private-1,public,",
+				"TORRENT_CLIENT_USER":         "shared",
+				"TORRENT_CLIENT_PASSWORD":     "sharedpass",
+				"TARGET_PUBLIC_URL":           "http://qbit-public:8080",
+				"TARGET_PRIVATE_1_URL":        "http://qbit-private:8080",
+				"TARGET_PRIVATE_1_USER":       "private",
+				"TARGET_PRIVATE_1_TYPE":       "deluge",
+				"TARGET_PRIVATE_1_PORT_INDEX": "2",
+				"TARGET_PUBLIC_HEADER_X":      "1",
+			},
+			expected: []Target{
+				{
+					Name: "public", Type: "qbittorrent", URL: "http://qbit-public:8080", User: "shared", Pass: "sharedpass",
+					Settings: map[string]string{"URL": "http://qbit-public:8080", "HEADER_X": "1"},
+				},
+				{
+					Name: "private-1", Type: "deluge", URL: "http://qbit-private:8080", User: "private", Pass: "sharedpass", PortIndex: 2,
+					Settings: map[string]string{"URL": "http://qbit-private:8080", "USER": "private", "TYPE": "deluge", "PORT_INDEX": "2"},
+				},
+			},
+		},
+		{
+			name: "blank TARGETS falls back to default",
+			envVars: map[string]string{
+				"TARGETS": " , ",
+			},
+			expected: []Target{
+				{Name: DefaultTargetName, Type: "qbittorrent", URL: "http://localhost:8080", User: "admin", Pass: "adminadmin", Settings: map[string]string{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			for k, v := range tt.envVars {
+				if err := os.Setenv(k, v); err != nil {
+					t.Fatalf("failed to set env var %s: %v", k, err)
+				}
+			}
+
+			cfg := Load()
+			if len(cfg.Targets) != len(tt.expected) {
+				t.Fatalf("Targets = %+v, want %+v", cfg.Targets, tt.expected)
+			}
+			for i := range tt.expected {
+				if !reflect.DeepEqual(cfg.Targets[i], tt.expected[i]) {
+					t.Errorf("Targets[%d] = %+v, want %+v", i, cfg.Targets[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
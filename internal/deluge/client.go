@@ -0,0 +1,290 @@
+package deluge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// ClientType selects the Deluge Web UI backend, which talks to the daemon the
+// Web UI is connected to.
+const ClientType = "deluge"
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+
+	// errCodeNotAuthenticated is returned by the Web UI when the session
+	// cookie is missing or expired.
+	errCodeNotAuthenticated = 1
+)
+
+// Client talks to the Deluge Web UI JSON-RPC endpoint.
+type Client struct {
+	rpcURL string
+	pass   string
+	client *http.Client
+	retry  retry.Policy
+
+	mu    gosync.Mutex
+	reqID int
+}
+
+type rpcRequest struct {
+	Method string `json:"method"`
+	Params []any  `json:"params"`
+	ID     int    `json:"id"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+	ID     int             `json:"id"`
+}
+
+type rpcError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("deluge error %d: %s", e.Code, e.Message)
+}
+
+type portConfig struct {
+	ListenPorts []int `json:"listen_ports"`
+	RandomPort  bool  `json:"random_port"`
+}
+
+var _ torrent.Client = (*Client)(nil)
+
+func init() {
+	torrent.Register(ClientType, func(ctx context.Context, opts torrent.Options) (torrent.Client, error) {
+		client, err := NewClient(ctx, opts.URL, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Retry.Attempts > 0 {
+			client.SetRetryPolicy(opts.Retry)
+		}
+		return client, nil
+	})
+}
+
+// NewClient logs in to the Deluge Web UI and makes sure it is connected to a
+// daemon. The Web UI only uses a password, so there is no username.
+func NewClient(ctx context.Context, baseURL, pass string) (*Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie jar: %w", err)
+	}
+
+	client := &Client{
+		rpcURL: strings.TrimRight(baseURL, "/") + "/json",
+		pass:   pass,
+		client: &http.Client{
+			Jar:     jar,
+			Timeout: defaultHTTPTimeout,
+		},
+		retry: retry.DefaultPolicy(),
+	}
+
+	if err := client.Login(ctx); err != nil {
+		return nil, fmt.Errorf("initial login failed: %w", err)
+	}
+
+	return client, nil
+}
+
+func (c *Client) Name() string {
+	return ClientType
+}
+
+// Login authenticates with auth.login and connects the Web UI to the first
+// known daemon through web.connect if it is not connected yet.
+func (c *Client) Login(ctx context.Context) error {
+	var ok bool
+	if err := c.call(ctx, "auth.login", []any{c.pass}, &ok); err != nil {
+		return fmt.Errorf("login request failed: %w", err)
+	}
+	if !ok {
+		// Retrying cannot fix a rejected password, so the error is permanent.
+		return torrent.NewError(torrent.KindBadCredentials, errors.New("login failed: invalid password"))
+	}
+	slog.Debug("successfully authenticated with Deluge")
+
+	return c.ensureConnected(ctx)
+}
+
+// SetRetryPolicy replaces the policy for the core.get_config_values and
+// core.set_config calls behind GetPort and SetPort.
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retry = policy
+}
+
+func (c *Client) GetPort(ctx context.Context) (int, error) {
+	var cfg portConfig
+	attempts, err := c.retry.Do(ctx, "get port", func(ctx context.Context) error {
+		if err := c.callWithReauth(ctx, "core.get_config_values", []any{[]string{"listen_ports", "random_port"}}, &cfg); err != nil {
+			return fmt.Errorf("failed to get config values: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get config values after %d attempts: %w", attempts, err)
+	}
+	return effectivePort(cfg), nil
+}
+
+func (c *Client) SetPort(ctx context.Context, port int) error {
+	settings := map[string]any{
+		"listen_ports": []int{port, port},
+		"random_port":  false,
+	}
+
+	attempts, err := c.retry.Do(ctx, "set port", func(ctx context.Context) error {
+		if err := c.callWithReauth(ctx, "core.set_config", []any{settings}, nil); err != nil {
+			return fmt.Errorf("failed to set config: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set Deluge port after %d attempts: %w", attempts, err)
+	}
+
+	slog.Info("successfully updated Deluge listening port", "port", port)
+	return nil
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	var connected bool
+	if err := c.callWithReauth(ctx, "web.connected", nil, &connected); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	if !connected {
+		return errors.New("ping failed: Deluge Web UI is not connected to a daemon")
+	}
+	return nil
+}
+
+func (c *Client) ensureConnected(ctx context.Context) error {
+	var connected bool
+	if err := c.call(ctx, "web.connected", nil, &connected); err != nil {
+		return fmt.Errorf("failed to check daemon connection: %w", err)
+	}
+	if connected {
+		return nil
+	}
+
+	var hosts [][]any
+	if err := c.call(ctx, "web.get_hosts", nil, &hosts); err != nil {
+		return fmt.Errorf("failed to list daemon hosts: %w", err)
+	}
+	if len(hosts) == 0 || len(hosts[0]) == 0 {
+		return errors.New("no Deluge daemon hosts configured in the Web UI")
+	}
+
+	hostID, ok := hosts[0][0].(string)
+	if !ok {
+		return fmt.Errorf("unexpected daemon host id %v", hosts[0][0])
+	}
+
+	slog.Info("connecting Deluge Web UI to daemon", "host_id", hostID)
+	if err := c.call(ctx, "web.connect", []any{hostID}, nil); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+
+	return nil
+}
+
+// callWithReauth performs an RPC call and logs in again once when the Web UI
+// reports that the session is no longer authenticated.
+func (c *Client) callWithReauth(ctx context.Context, method string, params []any, result any) error {
+	err := c.call(ctx, method, params, result)
+
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != errCodeNotAuthenticated {
+		return err
+	}
+
+	slog.Warn("Deluge session expired, re-authenticating...")
+	if err := c.Login(ctx); err != nil {
+		return fmt.Errorf("re-authentication failed: %w", err)
+	}
+
+	return c.call(ctx, method, params, result)
+}
+
+func (c *Client) call(ctx context.Context, method string, params []any, result any) error {
+	if params == nil {
+		params = []any{}
+	}
+
+	c.mu.Lock()
+	c.reqID++
+	id := c.reqID
+	c.mu.Unlock()
+
+	body, err := json.Marshal(rpcRequest{Method: method, Params: params, ID: id})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.rpcURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &retry.StatusError{Code: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var rpcResp rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+			return fmt.Errorf("failed to decode %s result: %w", method, err)
+		}
+	}
+
+	return nil
+}
+
+// effectivePort reports the configured port, or 0 when Deluge would not
+// listen on it: a random port or a port range both count as out of sync.
+func effectivePort(cfg portConfig) int {
+	if cfg.RandomPort || len(cfg.ListenPorts) == 0 {
+		return 0
+	}
+	for _, port := range cfg.ListenPorts[1:] {
+		if port != cfg.ListenPorts[0] {
+			return 0
+		}
+	}
+	return cfg.ListenPorts[0]
+}
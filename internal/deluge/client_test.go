@@ -0,0 +1,263 @@
+package deluge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+type testServer struct {
+	server      *httptest.Server
+	password    string
+	session     string
+	connected   bool
+	listenPorts []int
+	randomPort  bool
+	logins      int
+	connects    int
+	setCalls    int
+	failMethods map[string]int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	ts := &testServer{
+		password:    "deluge",
+		session:     "abc",
+		listenPorts: []int{6881, 6891},
+		randomPort:  true,
+		failMethods: map[string]int{},
+	}
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+			ID     int               `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if ts.failMethods[req.Method] > 0 {
+			ts.failMethods[req.Method]--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		resp := map[string]any{"id": req.ID, "error": nil, "result": nil}
+		reply := func() {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+		}
+
+		if req.Method == "auth.login" {
+			ts.logins++
+			var pass string
+			_ = json.Unmarshal(req.Params[0], &pass)
+			ok := pass == ts.password
+			if ok {
+				http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: ts.session, Path: "/"})
+			}
+			resp["result"] = ok
+			reply()
+			return
+		}
+
+		cookie, err := r.Cookie("_session_id")
+		if err != nil || cookie.Value != ts.session {
+			resp["error"] = map[string]any{"message": "Not authenticated", "code": errCodeNotAuthenticated}
+			reply()
+			return
+		}
+
+		switch req.Method {
+		case "web.connected":
+			resp["result"] = ts.connected
+		case "web.get_hosts":
+			resp["result"] = [][]any{{"host-1", "127.0.0.1", 58846, "localclient"}}
+		case "web.connect":
+			ts.connects++
+			var hostID string
+			_ = json.Unmarshal(req.Params[0], &hostID)
+			if hostID != "host-1" {
+				t.Errorf("web.connect host = %q, want host-1", hostID)
+			}
+			ts.connected = true
+		case "core.get_config_values":
+			resp["result"] = map[string]any{"listen_ports": ts.listenPorts, "random_port": ts.randomPort}
+		case "core.set_config":
+			ts.setCalls++
+			var cfg portConfig
+			if err := json.Unmarshal(req.Params[0], &cfg); err != nil {
+				t.Errorf("failed to decode set_config params: %v", err)
+			}
+			ts.listenPorts = cfg.ListenPorts
+			ts.randomPort = cfg.RandomPort
+		default:
+			resp["error"] = map[string]any{"message": "Unknown method", "code": 2}
+		}
+		reply()
+	}))
+
+	return ts
+}
+
+func TestNewClient_LoginAndConnect(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "deluge")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v, want nil", err)
+	}
+	if ts.connects != 1 {
+		t.Errorf("web.connect calls = %d, want 1", ts.connects)
+	}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v, want nil", err)
+	}
+}
+
+func TestNewClient_AlreadyConnected(t *testing.T) {
+	ts := newTestServer(t)
+	ts.connected = true
+	defer ts.server.Close()
+
+	if _, err := NewClient(context.Background(), ts.server.URL, "deluge"); err != nil {
+		t.Fatalf("NewClient() error = %v, want nil", err)
+	}
+	if ts.connects != 0 {
+		t.Errorf("web.connect calls = %d, want 0", ts.connects)
+	}
+}
+
+func TestNewClient_WrongPassword(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.server.Close()
+
+	_, err := NewClient(context.Background(), ts.server.URL, "wrong")
+	if torrent.KindOf(err) != torrent.KindBadCredentials {
+		t.Fatalf("NewClient() error = %v, want bad_credentials", err)
+	}
+	if retry.IsRetryable(err) {
+		t.Error("NewClient() error is retryable, want a rejected password to be permanent")
+	}
+	if ts.logins != 1 {
+		t.Errorf("auth.login calls = %d, want 1", ts.logins)
+	}
+}
+
+func TestGetPort(t *testing.T) {
+	tests := []struct {
+		name        string
+		listenPorts []int
+		randomPort  bool
+		want        int
+	}{
+		{"fixed port", []int{51413, 51413}, false, 51413},
+		{"random port enabled", []int{51413, 51413}, true, 0},
+		{"port range", []int{6881, 6891}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			defer ts.server.Close()
+			ts.listenPorts = tt.listenPorts
+			ts.randomPort = tt.randomPort
+
+			client, err := NewClient(context.Background(), ts.server.URL, "deluge")
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			port, err := client.GetPort(context.Background())
+			if err != nil {
+				t.Fatalf("GetPort() error = %v, want nil", err)
+			}
+			if port != tt.want {
+				t.Errorf("GetPort() = %d, want %d", port, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPort_Reauthentication(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "deluge")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// Rotate the server-side session so the stored cookie is rejected.
+	ts.session = "rotated"
+	if _, err := client.GetPort(context.Background()); err != nil {
+		t.Fatalf("GetPort() error = %v, want nil", err)
+	}
+	if ts.logins != 2 {
+		t.Errorf("auth.login calls = %d, want 2", ts.logins)
+	}
+}
+
+func TestSetPort_Success(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "deluge")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v, want nil", err)
+	}
+	if len(ts.listenPorts) != 2 || ts.listenPorts[0] != 51413 || ts.listenPorts[1] != 51413 {
+		t.Errorf("listen_ports = %v, want [51413 51413]", ts.listenPorts)
+	}
+	if ts.randomPort {
+		t.Error("random_port = true, want false")
+	}
+
+	port, err := client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if port != 51413 {
+		t.Errorf("GetPort() after SetPort = %d, want 51413", port)
+	}
+}
+
+func TestSetPort_RetryOnServerError(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "deluge")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+
+	ts.failMethods["core.set_config"] = 1
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v, want nil", err)
+	}
+	if ts.setCalls != 1 {
+		t.Errorf("successful set_config calls = %d, want 1", ts.setCalls)
+	}
+}
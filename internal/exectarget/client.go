@@ -0,0 +1,192 @@
+package exectarget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/shellcmd"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// ClientType selects the backend that runs a shell command on each port
+// change.
+const ClientType = "exec"
+
+// Config describes the command run on each port change.
+type Config struct {
+	Name    string
+	Command string
+	// Shell runs Command as "<Shell> -c <Command>".
+	Shell   string
+	Timeout time.Duration
+	// Env names the forwardarr environment variables passed on to the
+	// command besides PATH and HOME; see shellcmd.Environ.
+	Env []string
+}
+
+// Client runs a shell command with FORWARDED_PORT, OLD_PORT and TARGET_NAME
+// set in its environment.
+type Client struct {
+	cfg   Config
+	retry retry.Policy
+
+	mu       gosync.Mutex
+	lastPort int
+}
+
+var _ torrent.Client = (*Client)(nil)
+
+func init() {
+	torrent.Register(ClientType, func(ctx context.Context, opts torrent.Options) (torrent.Client, error) {
+		cfg, err := ConfigFromSettings(opts.Name, opts.Settings)
+		if err != nil {
+			return nil, err
+		}
+		client, err := NewClient(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Retry.Attempts > 0 {
+			client.SetRetryPolicy(opts.Retry)
+		}
+		return client, nil
+	})
+}
+
+// ConfigFromSettings builds a Config from the COMMAND, SHELL, TIMEOUT
+// (seconds) and ENV (comma-separated variable names) per-target settings.
+func ConfigFromSettings(name string, settings map[string]string) (Config, error) {
+	cfg := Config{
+		Name:    name,
+		Command: settings["COMMAND"],
+		Shell:   settings["SHELL"],
+	}
+	for _, env := range strings.Split(settings["ENV"], ",") {
+		if env = strings.TrimSpace(env); env != "" {
+			cfg.Env = append(cfg.Env, env)
+		}
+	}
+
+	if timeout := settings["TIMEOUT"]; timeout != "" {
+		seconds, err := strconv.Atoi(timeout)
+		if err != nil || seconds <= 0 {
+			return Config{}, fmt.Errorf("invalid timeout %q", timeout)
+		}
+		cfg.Timeout = time.Duration(seconds) * time.Second
+	}
+
+	return cfg, nil
+}
+
+// NewClient validates the configuration and checks that the shell exists.
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	if strings.TrimSpace(cfg.Command) == "" {
+		return nil, fmt.Errorf("exec target command is required")
+	}
+	if cfg.Shell == "" {
+		cfg.Shell = shellcmd.DefaultShell
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = shellcmd.DefaultTimeout
+	}
+
+	client := &Client{cfg: cfg, retry: retry.DefaultPolicy()}
+	if err := client.Ping(ctx); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// SetRetryPolicy replaces the policy for running the command in SetPort.
+// GetPort only reports the last successful port and is not retried.
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retry = policy
+}
+
+func (c *Client) Name() string {
+	return ClientType
+}
+
+// GetPort returns the port of the last successful run. It is 0 until the
+// command first succeeds, so the watcher runs it once after startup and keeps
+// retrying on later syncs while it fails.
+func (c *Client) GetPort(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastPort, nil
+}
+
+func (c *Client) SetPort(ctx context.Context, port int) error {
+	c.mu.Lock()
+	oldPort := c.lastPort
+	c.mu.Unlock()
+
+	attempts, err := c.retry.Do(ctx, "set port", func(ctx context.Context) error {
+		return c.run(ctx, port, oldPort)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to run command after %d attempts: %w", attempts, err)
+	}
+
+	c.mu.Lock()
+	c.lastPort = port
+	c.mu.Unlock()
+	slog.Info("successfully ran exec target command", "target", c.cfg.Name, "port", port)
+	return nil
+}
+
+// Ping checks that the configured shell can be found.
+func (c *Client) Ping(ctx context.Context) error {
+	return shellcmd.CheckShell(c.cfg.Shell)
+}
+
+func (c *Client) run(ctx context.Context, port, oldPort int) error {
+	start := time.Now()
+	output, err := shellcmd.Run(ctx, shellcmd.Command{
+		Line:    c.cfg.Command,
+		Shell:   c.cfg.Shell,
+		Timeout: c.cfg.Timeout,
+		Env: append(shellcmd.Environ(c.cfg.Env...),
+			"FORWARDED_PORT="+strconv.Itoa(port),
+			"OLD_PORT="+strconv.Itoa(oldPort),
+			"TARGET_NAME="+c.cfg.Name,
+		),
+	})
+	logOutput(c.cfg.Name, output)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("command exited with status %d: %s", exitErr.ExitCode(), lastLine(output.Stderr))
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("exec target command finished", "target", c.cfg.Name, "duration", time.Since(start))
+	return nil
+}
+
+func logOutput(target string, output shellcmd.Output) {
+	if out := strings.TrimSpace(output.Stdout); out != "" {
+		slog.Info("exec target stdout", "target", target, "output", out)
+	}
+	if out := strings.TrimSpace(output.Stderr); out != "" {
+		slog.Warn("exec target stderr", "target", target, "output", out)
+	}
+}
+
+// lastLine returns the final non-empty line of output, which is usually the
+// most useful part of an error message.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,197 @@
+package exectarget
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+)
+
+func TestConfigFromSettings(t *testing.T) {
+	cfg, err := ConfigFromSettings("fw", map[string]string{
+		"COMMAND": "echo $FORWARDED_PORT",
+		"SHELL":   "/bin/bash",
+		"TIMEOUT": "5",
+		"ENV":     "TZ, PUID ,",
+	})
+	if err != nil {
+		t.Fatalf("ConfigFromSettings() error = %v", err)
+	}
+	if cfg.Name != "fw" || cfg.Command != "echo $FORWARDED_PORT" || cfg.Shell != "/bin/bash" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if cfg.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", cfg.Timeout)
+	}
+	if strings.Join(cfg.Env, ",") != "TZ,PUID" {
+		t.Errorf("Env = %v, want [TZ PUID]", cfg.Env)
+	}
+
+	if _, err := ConfigFromSettings("fw", map[string]string{"TIMEOUT": "soon"}); err == nil {
+		t.Error("expected error for invalid timeout")
+	}
+}
+
+func TestNewClient_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "missing command", cfg: Config{}},
+		{name: "blank command", cfg: Config{Command: "  "}},
+		{name: "missing shell", cfg: Config{Command: "true", Shell: "/nonexistent/sh"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(context.Background(), tt.cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestSetPort_Environment(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	client, err := NewClient(context.Background(), Config{
+		Name:    "fw",
+		Command: `echo "$FORWARDED_PORT $OLD_PORT $TARGET_NAME" >> "` + out + `"`,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if port, _ := client.GetPort(context.Background()); port != 0 {
+		t.Errorf("GetPort() before run = %d, want 0", port)
+	}
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	if err := client.SetPort(context.Background(), 6881); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	if port, _ := client.GetPort(context.Background()); port != 6881 {
+		t.Errorf("GetPort() after run = %d, want 6881", port)
+	}
+
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	want := "51413 0 fw\n6881 51413 fw\n"
+	if string(content) != want {
+		t.Errorf("output = %q, want %q", content, want)
+	}
+}
+
+func TestSetPort_MinimalEnvironment(t *testing.T) {
+	t.Setenv("QBIT_PASS", "secret")
+	t.Setenv("FORWARDARR_TEST_ALLOWED", "yes")
+
+	out := filepath.Join(t.TempDir(), "out")
+	client, err := NewClient(context.Background(), Config{
+		Name:    "fw",
+		Command: `echo "${QBIT_PASS:-unset} ${FORWARDARR_TEST_ALLOWED:-unset} ${PATH:+path}" > "` + out + `"`,
+		Env:     []string{"FORWARDARR_TEST_ALLOWED"},
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if want := "unset yes path\n"; string(content) != want {
+		t.Errorf("output = %q, want %q", content, want)
+	}
+}
+
+func TestSetPort_NonZeroExit(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "count")
+	client, err := NewClient(context.Background(), Config{
+		Name:    "fw",
+		Command: `echo run >> "` + counter + `"; echo "rule rejected" >&2; exit 3`,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+
+	err = client.SetPort(context.Background(), 51413)
+	if err == nil {
+		t.Fatal("expected error for non-zero exit")
+	}
+	if !strings.Contains(err.Error(), "status 3") || !strings.Contains(err.Error(), "rule rejected") {
+		t.Errorf("error = %v", err)
+	}
+
+	content, _ := os.ReadFile(counter)
+	if runs := strings.Count(string(content), "run"); runs != 3 {
+		t.Errorf("runs = %d, want 3", runs)
+	}
+	if port, _ := client.GetPort(context.Background()); port != 0 {
+		t.Errorf("GetPort() after failure = %d, want 0", port)
+	}
+}
+
+func TestSetPort_Timeout(t *testing.T) {
+	client, err := NewClient(context.Background(), Config{Command: "sleep 5", Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+
+	start := time.Now()
+	err = client.SetPort(context.Background(), 51413)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("SetPort() error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("SetPort() took %v, timeout not enforced", elapsed)
+	}
+}
+
+func TestSetPort_Cancelled(t *testing.T) {
+	client, err := NewClient(context.Background(), Config{Command: "sleep 5"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = client.SetPort(ctx, 51413)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("SetPort() error = %v, want context canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("SetPort() took %v, command not cancelled", elapsed)
+	}
+}
+
+func TestLastLine(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "", want: ""},
+		{input: "single", want: "single"},
+		{input: "first\nsecond\n\n", want: "second"},
+	}
+
+	for _, tt := range tests {
+		if got := lastLine(tt.input); got != tt.want {
+			t.Errorf("lastLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
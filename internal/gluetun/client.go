@@ -0,0 +1,157 @@
+// Package gluetun reads the forwarded port from Gluetun's HTTP control
+// server, so the port file does not have to be shared over a volume.
+package gluetun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// portForwardPath is served by Gluetun v3.40 and newer.
+	portForwardPath = "/v1/portforward"
+	// legacyPortForwardPath is the older, OpenVPN-only endpoint.
+	legacyPortForwardPath = "/v1/openvpn/portforwarded"
+	maxResponseBodyBytes  = 1 << 20
+)
+
+// Config describes how to reach the control server. APIKey and
+// Username/Password match the "apikey" and "basic" auth methods of Gluetun's
+// control server role configuration; both may be left empty for "none".
+type Config struct {
+	URL      string
+	APIKey   string
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// Source polls the control server for the forwarded port.
+type Source struct {
+	cfg    Config
+	client *http.Client
+
+	mu gosync.Mutex
+	// path is the endpoint that last answered, so older Gluetun versions
+	// are not asked for the newer one on every poll.
+	path string
+}
+
+// NewSource validates the configuration. It does not contact Gluetun, which
+// may still be starting.
+func NewSource(cfg Config) (*Source, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("gluetun control server URL is required")
+	}
+	if cfg.APIKey != "" && cfg.Username != "" {
+		return nil, errors.New("set either a gluetun API key or a username, not both")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+
+	return &Source{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		path:   portForwardPath,
+	}, nil
+}
+
+func (s *Source) Name() string {
+	return "gluetun"
+}
+
+// ReadPorts returns the forwarded port, or none while Gluetun has none.
+// Gluetun forwards a single port.
+func (s *Source) ReadPorts(ctx context.Context) ([]int, error) {
+	port, err := s.ReadPort(ctx)
+	if err != nil || port == 0 {
+		return nil, err
+	}
+	return []int{port}, nil
+}
+
+// ReadPort returns the forwarded port, or 0 while Gluetun has none. A 404
+// from the current endpoint falls back to the legacy one.
+func (s *Source) ReadPort(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	path := s.path
+	s.mu.Unlock()
+
+	port, err := s.readPort(ctx, path)
+	var status *retry.StatusError
+	if path == portForwardPath && errors.As(err, &status) && status.Code == http.StatusNotFound {
+		slog.Info("gluetun control server has no " + portForwardPath + ", using " + legacyPortForwardPath)
+		path = legacyPortForwardPath
+		port, err = s.readPort(ctx, path)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.path = path
+	s.mu.Unlock()
+	return port, nil
+}
+
+func (s *Source) readPort(ctx context.Context, path string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.URL+path, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	switch {
+	case s.cfg.APIKey != "":
+		req.Header.Set("X-API-Key", s.cfg.APIKey)
+	case s.cfg.Username != "":
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("gluetun control server request failed: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("failed to close response body", "error", err)
+		}
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read gluetun response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return 0, fmt.Errorf("gluetun control server rejected the request to %s, check the API key or credentials: %w",
+			path, &retry.StatusError{Code: resp.StatusCode})
+	case resp.StatusCode != http.StatusOK:
+		return 0, fmt.Errorf("gluetun %s: %w", path, &retry.StatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(body))})
+	}
+
+	var payload struct {
+		Port *int `json:"port"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0, fmt.Errorf("failed to decode gluetun %s response: %w", path, err)
+	}
+	if payload.Port == nil {
+		return 0, fmt.Errorf("gluetun %s response has no port: %s", path, strings.TrimSpace(string(body)))
+	}
+	if *payload.Port == 0 {
+		slog.Warn("gluetun reports no forwarded port, skipping sync (port forwarding may still be starting)")
+	}
+	return *payload.Port, nil
+}
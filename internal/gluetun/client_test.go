@@ -0,0 +1,146 @@
+package gluetun
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newControlServer stands in for Gluetun's control server. Only the listed
+// paths exist; every request must pass authorized.
+func newControlServer(t *testing.T, paths map[string]string, authorized func(*http.Request) bool, requests *[]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.Path)
+		if !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, ok := paths[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNewSource_Invalid(t *testing.T) {
+	if _, err := NewSource(Config{}); err == nil {
+		t.Error("expected error without URL")
+	}
+	if _, err := NewSource(Config{URL: "http://gluetun:8000", APIKey: "key", Username: "user"}); err == nil {
+		t.Error("expected error with both API key and username")
+	}
+}
+
+func TestReadPort_APIKey(t *testing.T) {
+	var requests []string
+	server := newControlServer(t, map[string]string{portForwardPath: `{"port":51413}`},
+		func(r *http.Request) bool { return r.Header.Get("X-API-Key") == "secret" }, &requests)
+
+	source, err := NewSource(Config{URL: server.URL + "/", APIKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	port, err := source.ReadPort(context.Background())
+	if err != nil {
+		t.Fatalf("ReadPort() error = %v", err)
+	}
+	if port != 51413 {
+		t.Errorf("ReadPort() = %d, want 51413", port)
+	}
+}
+
+func TestReadPort_LegacyEndpointWithBasicAuth(t *testing.T) {
+	var requests []string
+	server := newControlServer(t, map[string]string{legacyPortForwardPath: `{"port":6881}`},
+		func(r *http.Request) bool {
+			user, pass, ok := r.BasicAuth()
+			return ok && user == "admin" && pass == "pass"
+		}, &requests)
+
+	source, err := NewSource(Config{URL: server.URL, Username: "admin", Password: "pass"})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	for range 2 {
+		port, err := source.ReadPort(context.Background())
+		if err != nil {
+			t.Fatalf("ReadPort() error = %v", err)
+		}
+		if port != 6881 {
+			t.Errorf("ReadPort() = %d, want 6881", port)
+		}
+	}
+
+	want := []string{portForwardPath, legacyPortForwardPath, legacyPortForwardPath}
+	if strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestReadPort_Unauthorized(t *testing.T) {
+	var requests []string
+	server := newControlServer(t, map[string]string{portForwardPath: `{"port":51413}`},
+		func(r *http.Request) bool { return false }, &requests)
+
+	source, err := NewSource(Config{URL: server.URL, APIKey: "wrong"})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	if _, err := source.ReadPort(context.Background()); err == nil || !strings.Contains(err.Error(), "API key") {
+		t.Errorf("ReadPort() error = %v, want rejected credentials", err)
+	}
+}
+
+func TestReadPort_Responses(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    int
+		wantErr bool
+	}{
+		{name: "no port yet", body: `{"port":0}`, want: 0},
+		{name: "missing port", body: `{}`, wantErr: true},
+		{name: "invalid json", body: `port`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			server := newControlServer(t, map[string]string{portForwardPath: tt.body},
+				func(r *http.Request) bool { return true }, &requests)
+
+			source, err := NewSource(Config{URL: server.URL})
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			port, err := source.ReadPort(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if port != tt.want {
+				t.Errorf("ReadPort() = %d, want %d", port, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPort_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	source, err := NewSource(Config{URL: url})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	if _, err := source.ReadPort(context.Background()); err == nil {
+		t.Error("ReadPort() error = nil, want error")
+	}
+}
@@ -0,0 +1,411 @@
+package httptarget
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"text/template"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/jsonpath"
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// ClientType selects the generic backend that sends a templated HTTP request
+// on each port change.
+const ClientType = "http"
+
+const (
+	defaultHTTPTimeout   = 10 * time.Second
+	defaultSetMethod     = http.MethodPost
+	defaultGetMethod     = http.MethodGet
+	headerSettingPrefix  = "HEADER_"
+	maxResponseBodyBytes = 1 << 20
+)
+
+// Config describes the requests used to push and optionally read the port.
+// URL, GetURL, Body and header values are Go templates rendered with
+// TemplateData.
+type Config struct {
+	Name     string
+	Method   string
+	URL      string
+	Headers  map[string]string
+	Body     string
+	Username string
+	Password string
+	// SuccessCodes lists the accepted status codes; empty accepts any 2xx.
+	SuccessCodes []int
+
+	// GetURL enables reading the current port back. GetPortPath is a dotted
+	// path into the JSON response, e.g. "data.port" or "items.0.port".
+	GetMethod   string
+	GetURL      string
+	GetPortPath string
+
+	Timeout time.Duration
+}
+
+// TemplateData is passed to the URL, header and body templates. For the read
+// request Port and OldPort are both the last port pushed.
+type TemplateData struct {
+	Port    int
+	OldPort int
+	Target  string
+}
+
+// Client pushes the forwarded port to an arbitrary HTTP service.
+type Client struct {
+	cfg     Config
+	url     *template.Template
+	getURL  *template.Template
+	body    *template.Template
+	headers map[string]*template.Template
+	client  *http.Client
+	retry   retry.Policy
+
+	mu       gosync.Mutex
+	lastPort int
+}
+
+var _ torrent.Client = (*Client)(nil)
+
+func init() {
+	torrent.Register(ClientType, func(ctx context.Context, opts torrent.Options) (torrent.Client, error) {
+		cfg, err := ConfigFromSettings(opts.Name, opts.URL, opts.Settings)
+		if err != nil {
+			return nil, err
+		}
+		client, err := NewClient(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Retry.Attempts > 0 {
+			client.SetRetryPolicy(opts.Retry)
+		}
+		return client, nil
+	})
+}
+
+// ConfigFromSettings builds a Config from per-target settings:
+// METHOD, BODY, HEADER_<NAME>, SUCCESS_CODES, USER, PASSWORD, GET_URL,
+// GET_METHOD, GET_PORT_PATH and TIMEOUT (seconds).
+func ConfigFromSettings(name, rawURL string, settings map[string]string) (Config, error) {
+	cfg := Config{
+		Name:        name,
+		Method:      settings["METHOD"],
+		URL:         rawURL,
+		Headers:     make(map[string]string),
+		Body:        settings["BODY"],
+		Username:    settings["USER"],
+		Password:    settings["PASSWORD"],
+		GetMethod:   settings["GET_METHOD"],
+		GetURL:      settings["GET_URL"],
+		GetPortPath: settings["GET_PORT_PATH"],
+	}
+
+	for key, value := range settings {
+		if header, ok := strings.CutPrefix(key, headerSettingPrefix); ok && header != "" {
+			cfg.Headers[headerName(header)] = value
+		}
+	}
+
+	if codes := settings["SUCCESS_CODES"]; codes != "" {
+		for _, field := range strings.Split(codes, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || code < 100 || code > 599 {
+				return Config{}, fmt.Errorf("invalid success code %q", field)
+			}
+			cfg.SuccessCodes = append(cfg.SuccessCodes, code)
+		}
+	}
+
+	if timeout := settings["TIMEOUT"]; timeout != "" {
+		seconds, err := strconv.Atoi(timeout)
+		if err != nil || seconds <= 0 {
+			return Config{}, fmt.Errorf("invalid timeout %q", timeout)
+		}
+		cfg.Timeout = time.Duration(seconds) * time.Second
+	}
+
+	return cfg, nil
+}
+
+// NewClient validates the configuration and parses its templates. When a read
+// request is configured it is issued once to check connectivity.
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("http target URL is required")
+	}
+	if cfg.Method == "" {
+		cfg.Method = defaultSetMethod
+	}
+	if cfg.GetMethod == "" {
+		cfg.GetMethod = defaultGetMethod
+	}
+	if cfg.GetURL != "" && cfg.GetPortPath == "" {
+		return nil, fmt.Errorf("GET_PORT_PATH is required when GET_URL is set")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultHTTPTimeout
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	cfg.GetMethod = strings.ToUpper(cfg.GetMethod)
+
+	urlTmpl, err := template.New("url").Option("missingkey=error").Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL template: %w", err)
+	}
+	getURLTmpl, err := template.New("get_url").Option("missingkey=error").Parse(cfg.GetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GET_URL template: %w", err)
+	}
+	bodyTmpl, err := template.New("body").Option("missingkey=error").Parse(cfg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	headers := make(map[string]*template.Template, len(cfg.Headers))
+	for name, value := range cfg.Headers {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for header %s: %w", name, err)
+		}
+		headers[name] = tmpl
+	}
+
+	client := &Client{
+		cfg:     cfg,
+		url:     urlTmpl,
+		getURL:  getURLTmpl,
+		body:    bodyTmpl,
+		headers: headers,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		retry: retry.DefaultPolicy(),
+	}
+
+	if err := client.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("initial read failed: %w", err)
+	}
+
+	return client, nil
+}
+
+// SetRetryPolicy replaces the policy for the GET_URL request in GetPort and
+// the templated request in SetPort.
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retry = policy
+}
+
+func (c *Client) Name() string {
+	return ClientType
+}
+
+// GetPort reads the port from the configured read request. Without one it
+// returns the last port successfully pushed, which is 0 until the first push
+// so the watcher always applies the forwarded port after startup.
+func (c *Client) GetPort(ctx context.Context) (int, error) {
+	if c.cfg.GetURL == "" {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.lastPort, nil
+	}
+
+	var port int
+	attempts, err := c.retry.Do(ctx, "get port", func(ctx context.Context) error {
+		var err error
+		port, err = c.readPort(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read port after %d attempts: %w", attempts, err)
+	}
+	return port, nil
+}
+
+func (c *Client) SetPort(ctx context.Context, port int) error {
+	c.mu.Lock()
+	data := TemplateData{Port: port, OldPort: c.lastPort, Target: c.cfg.Name}
+	c.mu.Unlock()
+
+	attempts, err := c.retry.Do(ctx, "set port", func(ctx context.Context) error {
+		return c.pushPort(ctx, data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set HTTP target port after %d attempts: %w", attempts, err)
+	}
+
+	c.mu.Lock()
+	c.lastPort = port
+	c.mu.Unlock()
+	slog.Info("successfully updated HTTP target port", "target", c.cfg.Name, "port", port)
+	return nil
+}
+
+// Ping issues the read request when one is configured. Without it there is no
+// side-effect free request to probe, so the target is assumed reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	if c.cfg.GetURL == "" {
+		return nil
+	}
+	if _, err := c.readPort(ctx); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) pushPort(ctx context.Context, data TemplateData) error {
+	target, err := render(c.url, data)
+	if err != nil {
+		return fmt.Errorf("failed to render URL: %w", err)
+	}
+	body, err := render(c.body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render body: %w", err)
+	}
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := c.newRequest(ctx, c.cfg.Method, target, reader, data)
+	if err != nil {
+		return err
+	}
+	if body != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	if !c.isSuccess(resp.StatusCode) {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+		return &retry.StatusError{Code: resp.StatusCode, Body: string(respBody)}
+	}
+
+	return nil
+}
+
+func (c *Client) readPort(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	data := TemplateData{Port: c.lastPort, OldPort: c.lastPort, Target: c.cfg.Name}
+	c.mu.Unlock()
+
+	target, err := render(c.getURL, data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to render GET_URL: %w", err)
+	}
+	req, err := c.newRequest(ctx, c.cfg.GetMethod, target, nil, data)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, &retry.StatusError{Code: resp.StatusCode, Body: string(body)}
+	}
+
+	return extractPort(body, c.cfg.GetPortPath)
+}
+
+func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.Reader, data TemplateData) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for name, tmpl := range c.headers {
+		value, err := render(tmpl, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render header %s: %w", name, err)
+		}
+		req.Header.Set(name, value)
+	}
+	if c.cfg.Username != "" || c.cfg.Password != "" {
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+
+	return req, nil
+}
+
+func (c *Client) isSuccess(code int) bool {
+	if len(c.cfg.SuccessCodes) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, ok := range c.cfg.SuccessCodes {
+		if code == ok {
+			return true
+		}
+	}
+	return false
+}
+
+func render(tmpl *template.Template, data TemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// extractPort reads the port at a dotted path through the JSON response; the
+// value may be a JSON number or a numeric string.
+func extractPort(body []byte, path string) (int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	path = jsonpath.Normalize(path)
+	value, err := jsonpath.Lookup(document, path)
+	if err != nil {
+		return 0, fmt.Errorf("path %q: %w", path, err)
+	}
+
+	var raw string
+	switch v := value.(type) {
+	case json.Number:
+		raw = v.String()
+	case string:
+		raw = strings.TrimSpace(v)
+	default:
+		return 0, fmt.Errorf("path %q: expected a number, got %T", path, value)
+	}
+
+	port, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("path %q: invalid port %q", path, raw)
+	}
+	return port, nil
+}
+
+// headerName turns a setting suffix such as X_API_KEY into X-Api-Key.
+func headerName(setting string) string {
+	return http.CanonicalHeaderKey(strings.ReplaceAll(setting, "_", "-"))
+}
@@ -0,0 +1,283 @@
+package httptarget
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+)
+
+type capturedRequest struct {
+	method string
+	path   string
+	body   string
+	header http.Header
+	user   string
+	pass   string
+}
+
+func TestConfigFromSettings(t *testing.T) {
+	cfg, err := ConfigFromSettings("hook", "http://svc/port", map[string]string{
+		"METHOD":           "put",
+		"BODY":             `{"port":{{.Port}}}`,
+		"HEADER_X_API_KEY": "secret",
+		"SUCCESS_CODES":    "200, 204",
+		"TIMEOUT":          "3",
+		"GET_URL":          "http://svc/state",
+		"GET_PORT_PATH":    "data.port",
+	})
+	if err != nil {
+		t.Fatalf("ConfigFromSettings() error = %v", err)
+	}
+
+	if cfg.Name != "hook" || cfg.Method != "put" || cfg.URL != "http://svc/port" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if got := cfg.Headers["X-Api-Key"]; got != "secret" {
+		t.Errorf("Headers[X-Api-Key] = %q, want %q", got, "secret")
+	}
+	if len(cfg.SuccessCodes) != 2 || cfg.SuccessCodes[0] != 200 || cfg.SuccessCodes[1] != 204 {
+		t.Errorf("SuccessCodes = %v, want [200 204]", cfg.SuccessCodes)
+	}
+	if cfg.Timeout != 3*time.Second {
+		t.Errorf("Timeout = %v, want 3s", cfg.Timeout)
+	}
+	if cfg.GetURL != "http://svc/state" || cfg.GetPortPath != "data.port" {
+		t.Errorf("unexpected read config: %+v", cfg)
+	}
+}
+
+func TestConfigFromSettings_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]string
+	}{
+		{name: "non-numeric code", settings: map[string]string{"SUCCESS_CODES": "ok"}},
+		{name: "out of range code", settings: map[string]string{"SUCCESS_CODES": "999"}},
+		{name: "bad timeout", settings: map[string]string{"TIMEOUT": "-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ConfigFromSettings("hook", "http://svc", tt.settings); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestNewClient_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "missing URL", cfg: Config{}},
+		{name: "bad URL template", cfg: Config{URL: "http://svc/{{.Port"}},
+		{name: "bad body template", cfg: Config{URL: "http://svc", Body: "{{"}},
+		{name: "bad header template", cfg: Config{URL: "http://svc", Headers: map[string]string{"X": "{{"}}},
+		{name: "read without path", cfg: Config{URL: "http://svc", GetURL: "http://svc/state"}},
+		{name: "bad read URL template", cfg: Config{URL: "http://svc", GetURL: "http://svc/{{.Target", GetPortPath: "port"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(context.Background(), tt.cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestSetPort_RendersRequest(t *testing.T) {
+	var got capturedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = capturedRequest{method: r.Method, path: r.URL.Path, body: string(body), header: r.Header.Clone()}
+		got.user, got.pass, _ = r.BasicAuth()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), Config{
+		Name:     "hook",
+		Method:   "put",
+		URL:      server.URL + "/targets/{{.Target}}/port/{{.Port}}",
+		Body:     `{"port":{{.Port}},"old":{{.OldPort}}}`,
+		Headers:  map[string]string{"X-Api-Key": "secret", "X-Port": "{{.Port}}"},
+		Username: "user",
+		Password: "pass",
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	if got.method != http.MethodPut {
+		t.Errorf("method = %s, want PUT", got.method)
+	}
+	if got.path != "/targets/hook/port/51413" {
+		t.Errorf("path = %s, want /targets/hook/port/51413", got.path)
+	}
+	if got.body != `{"port":51413,"old":0}` {
+		t.Errorf("body = %s", got.body)
+	}
+	if got.header.Get("X-Api-Key") != "secret" || got.header.Get("X-Port") != "51413" {
+		t.Errorf("headers = %v", got.header)
+	}
+	if got.header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got.header.Get("Content-Type"))
+	}
+	if got.user != "user" || got.pass != "pass" {
+		t.Errorf("basic auth = %s/%s, want user/pass", got.user, got.pass)
+	}
+
+	if err := client.SetPort(context.Background(), 6881); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	if got.body != `{"port":6881,"old":51413}` {
+		t.Errorf("second body = %s, want old port carried over", got.body)
+	}
+}
+
+func TestSetPort_SuccessCodes(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), Config{URL: server.URL, SuccessCodes: []int{http.StatusAccepted}})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+
+	err = client.SetPort(context.Background(), 51413)
+	if err == nil {
+		t.Fatal("expected error for status outside success codes")
+	}
+	if !strings.Contains(err.Error(), "unexpected status code: 200") {
+		t.Errorf("error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+
+	port, err := client.GetPort(context.Background())
+	if err != nil || port != 0 {
+		t.Errorf("GetPort() = %d, %v; want 0 after failed push", port, err)
+	}
+}
+
+func TestGetPort_WithoutReadRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), Config{URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if port, _ := client.GetPort(context.Background()); port != 0 {
+		t.Errorf("GetPort() before push = %d, want 0", port)
+	}
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	if port, _ := client.GetPort(context.Background()); port != 51413 {
+		t.Errorf("GetPort() after push = %d, want 51413", port)
+	}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}
+
+func TestGetPort_ReadRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/state/hook" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"listeners":[{"port":"6881"},{"port":51413}]}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), Config{
+		Name:        "hook",
+		URL:         server.URL + "/port",
+		Headers:     map[string]string{"X-Api-Key": "secret"},
+		GetURL:      server.URL + "/state/{{.Target}}",
+		GetPortPath: "data.listeners.1.port",
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	port, err := client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if port != 51413 {
+		t.Errorf("GetPort() = %d, want 51413", port)
+	}
+}
+
+func TestNewClient_ReadRequestUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(context.Background(), Config{URL: server.URL, GetURL: server.URL, GetPortPath: "port"})
+	if err == nil {
+		t.Fatal("expected error when read request fails")
+	}
+}
+
+func TestExtractPort(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		path    string
+		want    int
+		wantErr bool
+	}{
+		{name: "top-level number", body: `51413`, path: "", want: 51413},
+		{name: "nested key", body: `{"a":{"port":6881}}`, path: "a.port", want: 6881},
+		{name: "dollar prefix", body: `{"port":6881}`, path: "$.port", want: 6881},
+		{name: "array index", body: `{"ports":[1,2,3]}`, path: "ports.2", want: 3},
+		{name: "numeric string", body: `{"port":" 6881 "}`, path: "port", want: 6881},
+		{name: "missing key", body: `{"port":6881}`, path: "listen", wantErr: true},
+		{name: "index out of range", body: `[1]`, path: "3", wantErr: true},
+		{name: "descend into scalar", body: `{"port":6881}`, path: "port.value", wantErr: true},
+		{name: "non-numeric value", body: `{"port":true}`, path: "port", wantErr: true},
+		{name: "fractional number", body: `{"port":1.5}`, path: "port", wantErr: true},
+		{name: "invalid json", body: `{`, path: "port", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractPort([]byte(tt.body), tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("extractPort() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+// Package jsonpath looks up values in decoded JSON by a dotted path such as
+// "data.ports.0", as used for PORT_FILE_FIELD and the HTTP target's
+// GET_PORT_PATH.
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Normalize strips a leading "$" or "$." so JSONPath-style paths are accepted.
+func Normalize(path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+}
+
+// Lookup walks path through a value decoded by encoding/json. Numeric segments
+// index into arrays; an empty path returns the value itself.
+func Lookup(value any, path string) (any, error) {
+	path = Normalize(path)
+	if path == "" {
+		return value, nil
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]any:
+			next, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found", segment)
+			}
+			value = next
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("invalid index %q", segment)
+			}
+			value = node[index]
+		default:
+			return nil, fmt.Errorf("cannot descend into %T at %q", value, segment)
+		}
+	}
+	return value, nil
+}
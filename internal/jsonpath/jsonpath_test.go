@@ -0,0 +1,45 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty path", body: `51413`, path: "", want: "51413"},
+		{name: "nested key", body: `{"a":{"port":6881}}`, path: "a.port", want: "6881"},
+		{name: "dollar prefix", body: `{"port":6881}`, path: "$.port", want: "6881"},
+		{name: "array index", body: `{"ports":[1,2,3]}`, path: "ports.2", want: "3"},
+		{name: "missing key", body: `{"port":6881}`, path: "listen", wantErr: true},
+		{name: "index out of range", body: `[1]`, path: "3", wantErr: true},
+		{name: "non-numeric index", body: `[1]`, path: "first", wantErr: true},
+		{name: "descend into scalar", body: `{"port":6881}`, path: "port.value", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := json.NewDecoder(strings.NewReader(tt.body))
+			decoder.UseNumber()
+			var document any
+			if err := decoder.Decode(&document); err != nil {
+				t.Fatalf("failed to decode %s: %v", tt.body, err)
+			}
+
+			got, err := Lookup(document, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.(json.Number).String() != tt.want {
+				t.Errorf("Lookup() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+// Package natpmp requests port mappings from a NAT-PMP (RFC 6886) gateway,
+// as VPN providers such as ProtonVPN require, and reports the mapped port.
+package natpmp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	gosync "sync"
+	"time"
+)
+
+const (
+	defaultPort     = 5351
+	defaultLifetime = 60 * time.Second
+	defaultTimeout  = 5 * time.Second
+	// defaultInternalPort is what ProtonVPN's instructions use. Internal port
+	// 0 is not usable: RFC 6886 section 3.4 reserves it for deleting all of
+	// the client's mappings.
+	defaultInternalPort = 1
+	// initialRetransmit is the first wait for a response; it doubles on
+	// every retransmission as RFC 6886 section 3.1 describes.
+	initialRetransmit = 250 * time.Millisecond
+
+	version    = 0
+	opMapUDP   = 1
+	opMapTCP   = 2
+	opResponse = 128
+
+	requestSize  = 12
+	responseSize = 16
+)
+
+// resultMessages are the non-zero result codes from RFC 6886 section 3.5.
+var resultMessages = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized or refused",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// Config describes the gateway and the mapping requested from it.
+type Config struct {
+	// Gateway is the gateway address, with or without a port; 5351 is used
+	// when it has none.
+	Gateway string
+	// InternalPort is the private port of the mapping, 1 when unset.
+	// Providers that pick the port themselves, like ProtonVPN, ignore it.
+	InternalPort int
+	// Lifetime is the requested mapping lifetime. Mappings are renewed
+	// after half the lifetime the gateway granted.
+	Lifetime time.Duration
+	// Timeout bounds one request including its retransmissions.
+	Timeout time.Duration
+}
+
+// Source keeps a UDP and a TCP mapping alive and reports the external port.
+type Source struct {
+	cfg     Config
+	address string
+
+	mu gosync.Mutex
+	// port is the external port of the current lease, lifetime the
+	// lifetime the gateway granted and renewAt when it has to be renewed; a
+	// zero renewAt maps again on the next read.
+	port     int
+	lifetime time.Duration
+	renewAt  time.Time
+	// epoch is the gateway's seconds-since-start-of-epoch from the last
+	// response; it going backwards means the gateway lost its mappings.
+	epoch uint32
+}
+
+// NewSource validates the configuration. It does not contact the gateway,
+// which may only be reachable once the VPN is up.
+func NewSource(cfg Config) (*Source, error) {
+	if cfg.Gateway == "" {
+		return nil, errors.New("NAT-PMP gateway is required")
+	}
+	if cfg.InternalPort == 0 {
+		cfg.InternalPort = defaultInternalPort
+	}
+	if cfg.InternalPort < 1 || cfg.InternalPort > 65535 {
+		return nil, fmt.Errorf("invalid NAT-PMP internal port %d", cfg.InternalPort)
+	}
+	if cfg.Lifetime <= 0 {
+		cfg.Lifetime = defaultLifetime
+	}
+	if cfg.Lifetime < time.Second {
+		return nil, fmt.Errorf("NAT-PMP lifetime %s is shorter than a second", cfg.Lifetime)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	address := cfg.Gateway
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, strconv.Itoa(defaultPort))
+	}
+	return &Source{cfg: cfg, address: address}, nil
+}
+
+func (s *Source) Name() string {
+	return "natpmp"
+}
+
+// RenewInterval is how often ReadPorts has to be called: a quarter of the
+// granted lifetime, or of the requested one before the first mapping. Reads
+// that often renew the lease between half and three quarters of its
+// lifetime, well before the gateway expires it.
+func (s *Source) RenewInterval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lifetime > 0 {
+		return s.lifetime / 4
+	}
+	return s.cfg.Lifetime / 4
+}
+
+// ReadPorts returns the external port of the current mappings, renewing them
+// first when half their lifetime has passed. A renewal suggests the current
+// port so the gateway keeps it when it can.
+func (s *Source) ReadPorts(ctx context.Context) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.port != 0 && time.Now().Before(s.renewAt) {
+		return []int{s.port}, nil
+	}
+
+	requestedAt := time.Now()
+	port, lifetime, err := s.mapPorts(ctx)
+	if err != nil {
+		s.renewAt = time.Time{}
+		return nil, err
+	}
+
+	switch {
+	case s.port == 0:
+		slog.Info("NAT-PMP mapping created", "gateway", s.address, "port", port, "lifetime", lifetime)
+	case port != s.port:
+		slog.Info("NAT-PMP gateway assigned a new port", "gateway", s.address, "old_port", s.port, "new_port", port)
+	default:
+		slog.Debug("NAT-PMP mapping renewed", "gateway", s.address, "port", port, "lifetime", lifetime)
+	}
+	s.port = port
+	s.lifetime = lifetime
+	// The gateway counts the lifetime from the request, not the reply.
+	s.renewAt = requestedAt.Add(lifetime / 2)
+	return []int{port}, nil
+}
+
+// mapPorts requests the UDP mapping and then a TCP mapping for the same
+// external port. It returns the UDP port and the shorter granted lifetime.
+func (s *Source) mapPorts(ctx context.Context) (int, time.Duration, error) {
+	udp, err := s.request(ctx, opMapUDP, s.port)
+	if err != nil {
+		return 0, 0, fmt.Errorf("NAT-PMP UDP mapping failed: %w", err)
+	}
+	tcp, err := s.request(ctx, opMapTCP, udp.externalPort)
+	if err != nil {
+		return 0, 0, fmt.Errorf("NAT-PMP TCP mapping failed: %w", err)
+	}
+	if tcp.externalPort != udp.externalPort {
+		slog.Warn("NAT-PMP gateway mapped different UDP and TCP ports, using the UDP port",
+			"udp_port", udp.externalPort,
+			"tcp_port", tcp.externalPort,
+		)
+	}
+	if udp.externalPort == 0 {
+		return 0, 0, errors.New("NAT-PMP gateway returned external port 0")
+	}
+
+	lifetime := min(udp.lifetime, tcp.lifetime)
+	if lifetime <= 0 {
+		return 0, 0, errors.New("NAT-PMP gateway granted no lifetime")
+	}
+	return udp.externalPort, lifetime, nil
+}
+
+type mapping struct {
+	externalPort int
+	lifetime     time.Duration
+}
+
+// request sends one mapping request, retransmitting with a doubling wait
+// until a matching response arrives or the timeout passes.
+func (s *Source) request(ctx context.Context, op byte, suggestedPort int) (mapping, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", s.address)
+	if err != nil {
+		return mapping{}, fmt.Errorf("failed to reach gateway %s: %w", s.address, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Unblock a pending read when ctx ends before the deadline does.
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	req := make([]byte, requestSize)
+	req[0] = version
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:6], uint16(s.cfg.InternalPort))
+	binary.BigEndian.PutUint16(req[6:8], uint16(suggestedPort))
+	binary.BigEndian.PutUint32(req[8:12], uint32(s.cfg.Lifetime/time.Second))
+
+	buf := make([]byte, 64)
+	for wait := initialRetransmit; ctx.Err() == nil; wait *= 2 {
+		if _, err := conn.Write(req); err != nil {
+			return mapping{}, fmt.Errorf("failed to send request to %s: %w", s.address, err)
+		}
+
+		deadline := time.Now().Add(wait)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return mapping{}, err
+		}
+
+		for {
+			n, err := conn.Read(buf)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			if err != nil {
+				// An ICMP port unreachable surfaces here when nothing
+				// listens on the gateway yet; wait out the interval and
+				// retransmit like on a timeout.
+				slog.Debug("NAT-PMP read failed", "gateway", s.address, "error", err)
+				timer := time.NewTimer(time.Until(deadline))
+				select {
+				case <-ctx.Done():
+				case <-timer.C:
+				}
+				timer.Stop()
+				break
+			}
+
+			m, ok, err := s.parseResponse(buf[:n], op)
+			if err != nil {
+				return mapping{}, err
+			}
+			if ok {
+				return m, nil
+			}
+		}
+	}
+
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return mapping{}, ctx.Err()
+	}
+	return mapping{}, fmt.Errorf("no response from gateway %s within %s", s.address, s.cfg.Timeout)
+}
+
+// parseResponse decodes a mapping response. Packets that are not the answer
+// to op are skipped by returning false.
+func (s *Source) parseResponse(packet []byte, op byte) (mapping, bool, error) {
+	if len(packet) < responseSize || packet[0] != version || packet[1] != opResponse+op {
+		slog.Debug("ignoring unexpected NAT-PMP packet", "gateway", s.address, "length", len(packet))
+		return mapping{}, false, nil
+	}
+
+	if result := binary.BigEndian.Uint16(packet[2:4]); result != 0 {
+		message, ok := resultMessages[result]
+		if !ok {
+			message = "unknown error"
+		}
+		return mapping{}, false, fmt.Errorf("gateway %s refused the mapping: %s (result code %d)", s.address, message, result)
+	}
+
+	epoch := binary.BigEndian.Uint32(packet[4:8])
+	if epoch < s.epoch {
+		slog.Info("NAT-PMP gateway restarted, mappings were recreated", "gateway", s.address)
+	}
+	s.epoch = epoch
+
+	return mapping{
+		externalPort: int(binary.BigEndian.Uint16(packet[10:12])),
+		lifetime:     time.Duration(binary.BigEndian.Uint32(packet[12:16])) * time.Second,
+	}, true, nil
+}
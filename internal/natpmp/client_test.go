@@ -0,0 +1,287 @@
+package natpmp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+)
+
+// fakeGateway is a local UDP stand-in for a NAT-PMP gateway.
+type fakeGateway struct {
+	conn net.PacketConn
+
+	mu       gosync.Mutex
+	port     uint16
+	lifetime uint32
+	result   uint16
+	epoch    uint32
+	// drop is the number of requests ignored before answering.
+	drop     int
+	requests []request
+}
+
+type request struct {
+	op            byte
+	internalPort  uint16
+	suggestedPort uint16
+	lifetime      uint32
+	at            time.Time
+}
+
+func newFakeGateway(t *testing.T, port uint16) *fakeGateway {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	g := &fakeGateway{conn: conn, port: port, lifetime: 60, epoch: 1000}
+	t.Cleanup(func() { _ = conn.Close() })
+	go g.serve()
+	return g
+}
+
+func (g *fakeGateway) serve() {
+	buf := make([]byte, 64)
+	for {
+		n, addr, err := g.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n != requestSize {
+			continue
+		}
+
+		g.mu.Lock()
+		g.requests = append(g.requests, request{
+			op:            buf[1],
+			internalPort:  binary.BigEndian.Uint16(buf[4:6]),
+			suggestedPort: binary.BigEndian.Uint16(buf[6:8]),
+			lifetime:      binary.BigEndian.Uint32(buf[8:12]),
+			at:            time.Now(),
+		})
+		if g.drop > 0 {
+			g.drop--
+			g.mu.Unlock()
+			continue
+		}
+		resp := make([]byte, responseSize)
+		resp[1] = opResponse + buf[1]
+		binary.BigEndian.PutUint16(resp[2:4], g.result)
+		binary.BigEndian.PutUint32(resp[4:8], g.epoch)
+		copy(resp[8:10], buf[4:6])
+		binary.BigEndian.PutUint16(resp[10:12], g.port)
+		binary.BigEndian.PutUint32(resp[12:16], g.lifetime)
+		g.mu.Unlock()
+
+		_, _ = g.conn.WriteTo(resp, addr)
+	}
+}
+
+func (g *fakeGateway) set(fn func(g *fakeGateway)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fn(g)
+}
+
+func (g *fakeGateway) seen() []request {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]request(nil), g.requests...)
+}
+
+func (g *fakeGateway) address() string {
+	return g.conn.LocalAddr().String()
+}
+
+func TestNewSource_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "missing gateway", cfg: Config{}},
+		{name: "internal port out of range", cfg: Config{Gateway: "10.2.0.1", InternalPort: 70000}},
+		{name: "negative internal port", cfg: Config{Gateway: "10.2.0.1", InternalPort: -1}},
+		{name: "lifetime under a second", cfg: Config{Gateway: "10.2.0.1", Lifetime: 500 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSource(tt.cfg); err == nil {
+				t.Error("NewSource() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNewSource_DefaultPort(t *testing.T) {
+	source, err := NewSource(Config{Gateway: "10.2.0.1"})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	if source.address != "10.2.0.1:5351" {
+		t.Errorf("address = %q, want 10.2.0.1:5351", source.address)
+	}
+	if source.RenewInterval() != 15*time.Second {
+		t.Errorf("RenewInterval() = %v, want a quarter of the requested lifetime", source.RenewInterval())
+	}
+}
+
+func TestReadPorts_MapsUDPAndTCP(t *testing.T) {
+	gateway := newFakeGateway(t, 51413)
+	source, err := NewSource(Config{Gateway: gateway.address(), InternalPort: 1, Lifetime: 60 * time.Second})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+
+	ports, err := source.ReadPorts(context.Background())
+	if err != nil {
+		t.Fatalf("ReadPorts() error = %v", err)
+	}
+	if len(ports) != 1 || ports[0] != 51413 {
+		t.Fatalf("ReadPorts() = %v, want [51413]", ports)
+	}
+
+	requests := gateway.seen()
+	if len(requests) != 2 || requests[0].op != opMapUDP || requests[1].op != opMapTCP {
+		t.Fatalf("requests = %+v, want a UDP then a TCP mapping", requests)
+	}
+	if requests[0].internalPort != 1 || requests[0].lifetime != 60 {
+		t.Errorf("UDP request = %+v, want internal port 1 and lifetime 60", requests[0])
+	}
+	if requests[1].suggestedPort != 51413 {
+		t.Errorf("TCP request suggested port = %d, want the UDP port 51413", requests[1].suggestedPort)
+	}
+}
+
+func TestRenewInterval_GrantedLifetime(t *testing.T) {
+	gateway := newFakeGateway(t, 51413)
+	gateway.set(func(g *fakeGateway) { g.lifetime = 20 })
+	source, err := NewSource(Config{Gateway: gateway.address(), Lifetime: 60 * time.Second})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+
+	if _, err := source.ReadPorts(context.Background()); err != nil {
+		t.Fatalf("ReadPorts() error = %v", err)
+	}
+	if got := source.RenewInterval(); got != 5*time.Second {
+		t.Errorf("RenewInterval() = %v, want a quarter of the granted 20s lifetime", got)
+	}
+}
+
+func TestReadPorts_RenewsAfterHalfLifetime(t *testing.T) {
+	gateway := newFakeGateway(t, 51413)
+	source, err := NewSource(Config{Gateway: gateway.address()})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+
+	if _, err := source.ReadPorts(context.Background()); err != nil {
+		t.Fatalf("ReadPorts() error = %v", err)
+	}
+	if _, err := source.ReadPorts(context.Background()); err != nil {
+		t.Fatalf("ReadPorts() error = %v", err)
+	}
+	requests := gateway.seen()
+	if got := len(requests); got != 2 {
+		t.Fatalf("requests = %d, want 2 while the lease is fresh", got)
+	}
+	// Internal port 0 would ask the gateway to delete every mapping.
+	if requests[0].internalPort != 1 {
+		t.Errorf("internal port = %d, want the default 1", requests[0].internalPort)
+	}
+
+	// The gateway hands out a new port on the next renewal.
+	gateway.set(func(g *fakeGateway) { g.port = 6881 })
+	source.renewAt = time.Now()
+
+	ports, err := source.ReadPorts(context.Background())
+	if err != nil {
+		t.Fatalf("ReadPorts() error = %v", err)
+	}
+	if len(ports) != 1 || ports[0] != 6881 {
+		t.Errorf("ReadPorts() = %v, want the new port [6881]", ports)
+	}
+	requests = gateway.seen()
+	if len(requests) != 4 || requests[2].suggestedPort != 51413 {
+		t.Errorf("renewal requests = %+v, want the current port suggested", requests[2:])
+	}
+}
+
+func TestReadPorts_Retransmits(t *testing.T) {
+	gateway := newFakeGateway(t, 51413)
+	gateway.set(func(g *fakeGateway) { g.drop = 1 })
+	source, err := NewSource(Config{Gateway: gateway.address(), Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+
+	ports, err := source.ReadPorts(context.Background())
+	if err != nil {
+		t.Fatalf("ReadPorts() error = %v", err)
+	}
+	if len(ports) != 1 || ports[0] != 51413 {
+		t.Errorf("ReadPorts() = %v, want [51413]", ports)
+	}
+	if got := len(gateway.seen()); got != 3 {
+		t.Errorf("requests = %d, want 3 with one retransmission", got)
+	}
+}
+
+func TestReadPorts_ResultCode(t *testing.T) {
+	gateway := newFakeGateway(t, 51413)
+	gateway.set(func(g *fakeGateway) { g.result = 2 })
+	source, err := NewSource(Config{Gateway: gateway.address()})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+
+	_, err = source.ReadPorts(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Fatalf("ReadPorts() error = %v, want refused mapping", err)
+	}
+	if !source.renewAt.IsZero() {
+		t.Error("renewAt set after a failed mapping, want the next read to retry")
+	}
+}
+
+func TestReadPorts_NoGateway(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := conn.LocalAddr().String()
+	_ = conn.Close()
+
+	source, err := NewSource(Config{Gateway: address, Timeout: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+
+	start := time.Now()
+	if _, err := source.ReadPorts(context.Background()); err == nil {
+		t.Fatal("ReadPorts() error = nil, want error without a gateway")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ReadPorts() took %v, timeout not enforced", elapsed)
+	}
+}
+
+func TestReadPorts_Cancelled(t *testing.T) {
+	gateway := newFakeGateway(t, 51413)
+	gateway.set(func(g *fakeGateway) { g.drop = 100 })
+	source, err := NewSource(Config{Gateway: gateway.address()})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := source.ReadPorts(ctx); err == nil {
+		t.Fatal("ReadPorts() error = nil, want cancellation")
+	}
+}
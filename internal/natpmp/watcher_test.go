@@ -0,0 +1,80 @@
+package natpmp
+
+import (
+	"context"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/sync"
+)
+
+// portClient is an in-memory torrent.Client.
+type portClient struct {
+	mu   gosync.Mutex
+	port int
+}
+
+func (c *portClient) Name() string { return "fake" }
+
+func (c *portClient) GetPort(context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.port, nil
+}
+
+func (c *portClient) SetPort(_ context.Context, port int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.port = port
+	return nil
+}
+
+func (c *portClient) Ping(context.Context) error { return nil }
+
+func TestWatcherRenewsLeaseBeforeExpiry(t *testing.T) {
+	const lifetime = 2 * time.Second
+	gateway := newFakeGateway(t, 51413)
+	gateway.set(func(g *fakeGateway) { g.lifetime = uint32(lifetime / time.Second) })
+
+	source, err := NewSource(Config{Gateway: gateway.address(), Lifetime: lifetime})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	client := &portClient{port: 1}
+	// The configured poll interval is far longer than the lease; the watcher
+	// has to poll at the source's renewal interval instead.
+	watcher, err := sync.NewSourceWatcher(source, time.Minute, []sync.Target{{Name: "a", Client: client}}, nil, 0)
+	if err != nil {
+		t.Fatalf("NewSourceWatcher() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Start(ctx) }()
+	time.Sleep(2*lifetime + lifetime/2)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	var mapped []time.Time
+	for _, req := range gateway.seen() {
+		if req.op == opMapUDP {
+			mapped = append(mapped, req.at)
+		}
+	}
+	if len(mapped) < 3 {
+		t.Fatalf("UDP mappings = %d, want the initial one and at least two renewals", len(mapped))
+	}
+	// Renewals are due at half the lifetime and polled every quarter, so
+	// each lease is renewed by three quarters of its lifetime.
+	for i := 1; i < len(mapped); i++ {
+		if gap := mapped[i].Sub(mapped[i-1]); gap > lifetime*3/4+100*time.Millisecond {
+			t.Errorf("renewal %d came %v after the previous mapping, want before %v of a %v lease", i, gap, lifetime*3/4, lifetime)
+		}
+	}
+	if client.port != 51413 {
+		t.Errorf("client port = %d, want 51413", client.port)
+	}
+}
@@ -0,0 +1,39 @@
+// Package portlist parses the port lists that port files and port sources
+// report.
+package portlist
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Parse reads a comma-, whitespace- or newline-separated port list. Entries
+// that are not valid ports are logged and dropped, so one bad value does not
+// hide the others.
+func Parse(content string) []int {
+	fields := strings.FieldsFunc(content, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	ports := make([]int, 0, len(fields))
+	for _, field := range fields {
+		port, err := strconv.Atoi(field)
+		if err != nil {
+			slog.Warn("invalid port value, ignoring", "value", field, "error", err)
+			continue
+		}
+		if !Valid(port) {
+			slog.Warn("port out of valid range, ignoring", "port", port)
+			continue
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// Valid reports whether port is a usable TCP or UDP port.
+func Valid(port int) bool {
+	return port >= 1 && port <= 65535
+}
@@ -0,0 +1,36 @@
+package portlist
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []int
+	}{
+		{name: "single", content: "51413\n", want: []int{51413}},
+		{name: "comma separated", content: "51413,6881, 40000", want: []int{51413, 6881, 40000}},
+		{name: "newline separated", content: "51413\r\n6881\n\n", want: []int{51413, 6881}},
+		{name: "invalid entries dropped", content: "51413,abc,0,70000,6881", want: []int{51413, 6881}},
+		{name: "empty", content: " \n", want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.content); !slices.Equal(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	for port, want := range map[int]bool{0: false, 1: true, 51413: true, 65535: true, 65536: false, -1: false} {
+		if got := Valid(port); got != want {
+			t.Errorf("Valid(%d) = %v, want %v", port, got, want)
+		}
+	}
+}
@@ -1,22 +1,103 @@
 package qbit
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strconv"
 	"strings"
+	gosync "sync"
 	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
 )
 
+// ClientType selects the qBittorrent WebUI backend, the default
+// TORRENT_CLIENT_TYPE.
+const ClientType = "qbittorrent"
+
 type Client struct {
 	baseURL string
 	user    string
 	pass    string
 	client  *http.Client
+	// skipLogin is set when the WebUI bypasses authentication for our subnet.
+	skipLogin bool
+	// sessionFile persists the session cookies across restarts when set.
+	sessionFile string
+	// retry governs GetPort and SetPort.
+	retry retry.Policy
+
+	// enforced holds preferences re-applied by EnforceSettings.
+	enforced map[string]any
+	// reannounce enables Reannounce when non-nil.
+	reannounce *ReannounceOptions
+	// killSwitch enables PauseTorrents when non-nil.
+	killSwitch *KillSwitchOptions
+
+	// versionMu guards the versions detected at login and the request
+	// shapes chosen for them.
+	versionMu  gosync.RWMutex
+	appVersion string
+	apiVersion string
+	compat     compat
+
+	loginMu           gosync.Mutex
+	loginFailures     int
+	loginBlockedUntil time.Time
+	lastLoginErr      error
+}
+
+// Options configures a Client beyond the WebUI address and credentials.
+type Options struct {
+	URL      string
+	Username string
+	Password string
+	TLS      TLSOptions
+	Proxy    ProxyOptions
+	// SkipLogin never calls the login endpoint, for WebUIs with
+	// authentication bypassed for whitelisted subnets.
+	SkipLogin bool
+	// SessionFile stores the session cookies so a restart can reuse them
+	// instead of logging in again.
+	SessionFile string
+}
+
+// OptionsFromSettings builds Options from the shared connection settings
+// plus the TLS, proxy, SKIP_LOGIN and SESSION_FILE per-target settings.
+func OptionsFromSettings(opts torrent.Options) (Options, error) {
+	tlsOpts, err := TLSOptionsFromSettings(opts.Settings)
+	if err != nil {
+		return Options{}, err
+	}
+	proxyOpts, err := ProxyOptionsFromSettings(opts.Settings)
+	if err != nil {
+		return Options{}, err
+	}
+
+	skipLogin := false
+	if value := opts.Settings["SKIP_LOGIN"]; value != "" {
+		if skipLogin, err = strconv.ParseBool(value); err != nil {
+			return Options{}, fmt.Errorf("invalid SKIP_LOGIN value %q: %w", value, err)
+		}
+	}
+
+	return Options{
+		URL:         opts.URL,
+		Username:    opts.Username,
+		Password:    opts.Password,
+		TLS:         tlsOpts,
+		Proxy:       proxyOpts,
+		SkipLogin:   skipLogin,
+		SessionFile: opts.Settings["SESSION_FILE"],
+	}, nil
 }
 
 type Preferences struct {
@@ -24,83 +105,220 @@ type Preferences struct {
 }
 
 const (
-	defaultHTTPTimeout   = 10 * time.Second
-	requestRetryAttempts = 3
+	defaultHTTPTimeout = 10 * time.Second
+
+	loginBackoffBase   = 30 * time.Second
+	loginBackoffMax    = time.Hour
+	bannedLoginBackoff = 5 * time.Minute
 )
 
-var requestRetryDelay = 2 * time.Second
+var (
+	_ torrent.Client             = (*Client)(nil)
+	_ torrent.SettingsEnforcer   = (*Client)(nil)
+	_ torrent.Reannouncer        = (*Client)(nil)
+	_ torrent.VersionReporter    = (*Client)(nil)
+	_ torrent.ConnectionReporter = (*Client)(nil)
+	_ torrent.Pauser             = (*Client)(nil)
+)
+
+func init() {
+	torrent.Register(ClientType, func(ctx context.Context, opts torrent.Options) (torrent.Client, error) {
+		prefs, err := ParsePreferences(opts.Settings["PREFERENCES"])
+		if err != nil {
+			return nil, err
+		}
+		reannounce, err := ParseReannounceOptions(opts.Settings)
+		if err != nil {
+			return nil, err
+		}
+		killSwitch, err := ParseKillSwitchOptions(opts.Settings)
+		if err != nil {
+			return nil, err
+		}
+
+		clientOpts, err := OptionsFromSettings(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := NewClientWithOptions(ctx, clientOpts)
+		if err != nil {
+			return nil, err
+		}
+		client.SetEnforcedPreferences(prefs)
+		client.SetReannounce(reannounce)
+		client.SetKillSwitch(killSwitch)
+		if opts.Retry.Attempts > 0 {
+			client.SetRetryPolicy(opts.Retry)
+		}
+		return client, nil
+	})
+}
+
+func NewClient(ctx context.Context, baseURL, user, pass string) (*Client, error) {
+	return NewClientWithOptions(ctx, Options{URL: baseURL, Username: user, Password: pass})
+}
 
-func NewClient(baseURL, user, pass string) (*Client, error) {
+// NewClientWithOptions creates a client and logs in, or pings when login is
+// skipped or a stored session is still valid. TLS and proxy options apply to
+// every request, including Ping.
+func NewClientWithOptions(ctx context.Context, opts Options) (*Client, error) {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cookie jar: %w", err)
 	}
 
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+
+	httpClient := &http.Client{
+		Jar:     jar,
+		Timeout: defaultHTTPTimeout,
+	}
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		httpClient.Transport = transport
+	}
+	httpClient.Transport = opts.Proxy.wrap(httpClient.Transport)
+
 	client := &Client{
-		baseURL: strings.TrimRight(baseURL, "/"),
-		user:    user,
-		pass:    pass,
-		client: &http.Client{
-			Jar:     jar,
-			Timeout: defaultHTTPTimeout,
-		},
+		baseURL:     opts.Proxy.resolveURL(opts.URL),
+		user:        opts.Username,
+		pass:        opts.Password,
+		client:      httpClient,
+		skipLogin:   opts.SkipLogin,
+		sessionFile: opts.SessionFile,
+		retry:       retry.DefaultPolicy(),
+		compat:      defaultCompat,
 	}
 
-	if err := client.Login(); err != nil {
+	if client.skipLogin {
+		if err := client.Ping(ctx); err != nil {
+			return nil, fmt.Errorf("initial ping without login failed: %w", err)
+		}
+	} else if err := client.resumeSession(ctx); err != nil {
 		return nil, fmt.Errorf("initial login failed: %w", err)
 	}
 
+	if err := client.detectVersion(ctx); err != nil {
+		return nil, err
+	}
+
 	return client, nil
 }
 
-func (c *Client) Login() error {
+func (c *Client) Name() string {
+	return ClientType
+}
+
+// Login authenticates with the WebUI. After bad credentials or an IP ban
+// further logins are suppressed for a growing backoff so repeated 403s do not
+// trip qBittorrent's failed-login limiter; the last error is returned instead.
+func (c *Client) Login(ctx context.Context) error {
+	if c.skipLogin {
+		return nil
+	}
+
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+
+	if wait := time.Until(c.loginBlockedUntil); wait > 0 {
+		return fmt.Errorf("login suppressed for %s after previous failure: %w", wait.Round(time.Second), c.lastLoginErr)
+	}
+
+	err := c.login(ctx)
+	if err == nil {
+		c.loginFailures = 0
+		c.loginBlockedUntil = time.Time{}
+		c.lastLoginErr = nil
+		c.saveSession()
+		slog.Debug("successfully authenticated with qBittorrent")
+		return nil
+	}
+
+	if torrent.IsPermanent(err) {
+		c.loginFailures++
+		backoff := loginBackoff(torrent.KindOf(err), c.loginFailures)
+		c.loginBlockedUntil = time.Now().Add(backoff)
+		c.lastLoginErr = err
+		slog.Warn("qBittorrent rejected login, backing off",
+			"kind", torrent.KindOf(err),
+			"failures", c.loginFailures,
+			"retry_in", backoff,
+		)
+	}
+
+	return err
+}
+
+func (c *Client) login(ctx context.Context) error {
 	data := url.Values{}
 	data.Set("username", c.user)
 	data.Set("password", c.pass)
 
-	resp, err := c.client.PostForm(c.baseURL+"/api/v2/auth/login", data)
+	resp, err := c.postForm(ctx, c.baseURL+"/api/v2/auth/login", data)
 	if err != nil {
-		return fmt.Errorf("login request failed: %w", err)
+		return torrent.NewError(torrent.KindUnreachable, fmt.Errorf("login request failed: %w", err))
 	}
-	defer closeResponseBody(resp)
+	defer torrent.CloseResponseBody(resp)
 
 	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK || string(body) != "Ok." {
-		return fmt.Errorf("login failed: status %d, body: %s", resp.StatusCode, string(body))
+	text := strings.TrimSpace(string(body))
+	switch {
+	// qBittorrent 5 may answer a successful login with 204 and no body.
+	case resp.StatusCode == http.StatusOK && text == "Ok.", resp.StatusCode == http.StatusNoContent:
+		return nil
+	case resp.StatusCode == http.StatusOK && text == "Fails.", resp.StatusCode == http.StatusUnauthorized:
+		return torrent.NewError(torrent.KindBadCredentials, fmt.Errorf("login failed: invalid username or password"))
+	case resp.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(text), "banned"):
+		return torrent.NewError(torrent.KindIPBanned, fmt.Errorf("login failed: IP banned by qBittorrent: %s", text))
+	case resp.StatusCode == http.StatusNotFound:
+		return torrent.NewError(torrent.KindUnexpectedResponse,
+			errors.New("login failed: WebAPI v2 not found; qBittorrent 4.1 or newer is required, check the URL and BASE_PATH"))
+	default:
+		return torrent.NewError(torrent.KindUnexpectedResponse, fmt.Errorf("login failed: status %d, body: %s", resp.StatusCode, text))
 	}
+}
 
-	slog.Debug("successfully authenticated with qBittorrent")
-	return nil
+// loginBackoff doubles from loginBackoffBase per consecutive failure up to
+// loginBackoffMax. A ban always waits at least bannedLoginBackoff.
+func loginBackoff(kind torrent.ErrorKind, failures int) time.Duration {
+	backoff := loginBackoffMax
+	if failures < 16 {
+		backoff = min(loginBackoffBase<<(failures-1), loginBackoffMax)
+	}
+	if kind == torrent.KindIPBanned {
+		backoff = max(backoff, bannedLoginBackoff)
+	}
+	return backoff
 }
 
-func (c *Client) GetPort() (int, error) {
-	var lastErr error
-	for attempt := 1; attempt <= requestRetryAttempts; attempt++ {
-		resp, err := c.doGet(c.baseURL + "/api/v2/app/preferences")
-		if err != nil {
-			lastErr = fmt.Errorf("failed to get preferences: %w", err)
-		} else {
-			port, decodeErr := decodePreferences(resp)
-			if decodeErr == nil {
-				return port, nil
-			}
-			lastErr = decodeErr
-		}
+// SetRetryPolicy replaces the policy for the preference requests behind
+// GetPort and SetPort. A rejected login is never retried.
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retry = policy
+}
 
-		if attempt < requestRetryAttempts {
-			slog.Warn("get port failed, retrying",
-				"attempt", attempt,
-				"max_attempts", requestRetryAttempts,
-				"error", lastErr,
-			)
-			time.Sleep(requestRetryDelay)
+func (c *Client) GetPort(ctx context.Context) (int, error) {
+	var port int
+	attempts, err := c.retry.Do(ctx, "get port", func(ctx context.Context) error {
+		resp, err := c.doGet(ctx, c.baseURL+"/api/v2/app/preferences")
+		if err != nil {
+			return fmt.Errorf("failed to get preferences: %w", err)
 		}
+		port, err = c.decodePreferences(resp)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get preferences after %d attempts: %w", attempts, err)
 	}
-
-	return 0, fmt.Errorf("failed to get preferences after %d attempts: %w", requestRetryAttempts, lastErr)
+	return port, nil
 }
 
-func (c *Client) SetPort(port int) error {
+func (c *Client) SetPort(ctx context.Context, port int) error {
 	prefsJSON := map[string]int{
 		"listen_port": port,
 	}
@@ -113,56 +331,48 @@ func (c *Client) SetPort(port int) error {
 	data := url.Values{}
 	data.Set("json", string(jsonBytes))
 
-	var lastErr error
-	for attempt := 1; attempt <= requestRetryAttempts; attempt++ {
-		resp, err := c.doPostForm(c.baseURL+"/api/v2/app/setPreferences", data)
+	attempts, err := c.retry.Do(ctx, "set port", func(ctx context.Context) error {
+		resp, err := c.doPostForm(ctx, c.baseURL+"/api/v2/app/setPreferences", data)
 		if err != nil {
-			lastErr = fmt.Errorf("failed to set preferences: %w", err)
-		} else {
-			body, readErr := io.ReadAll(resp.Body)
-			closeResponseBody(resp)
-
-			if resp.StatusCode == http.StatusOK {
-				slog.Info("successfully updated qBittorrent listening port", "port", port)
-				return nil
-			}
-
-			if readErr != nil {
-				lastErr = fmt.Errorf("unexpected status code: %d, body read error: %w", resp.StatusCode, readErr)
-			} else {
-				lastErr = fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
-			}
+			return fmt.Errorf("failed to set preferences: %w", err)
 		}
+		defer torrent.CloseResponseBody(resp)
 
-		if attempt < requestRetryAttempts {
-			slog.Warn("set port failed, retrying",
-				"attempt", attempt,
-				"max_attempts", requestRetryAttempts,
-				"error", lastErr,
-			)
-			time.Sleep(requestRetryDelay)
+		if resp.StatusCode != http.StatusOK {
+			return unexpectedStatus(resp)
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set qBittorrent port after %d attempts: %w", attempts, err)
 	}
 
-	return fmt.Errorf("failed to set qBittorrent port after %d attempts: %w", requestRetryAttempts, lastErr)
+	slog.Info("successfully updated qBittorrent listening port", "port", port)
+	return nil
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.ping(ctx, c.doGet)
 }
 
-func (c *Client) Ping() error {
-	resp, err := c.doGet(c.baseURL + "/api/v2/app/version")
+// ping requests the version with get, which either re-authenticates on 403
+// (doGet) or not (get).
+func (c *Client) ping(ctx context.Context, get func(context.Context, string) (*http.Response, error)) error {
+	resp, err := get(ctx, c.baseURL+"/api/v2/app/version")
 	if err != nil {
 		return fmt.Errorf("ping failed: %w", err)
 	}
-	defer closeResponseBody(resp)
+	defer torrent.CloseResponseBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return torrent.NewError(torrent.KindUnexpectedResponse, fmt.Errorf("unexpected status code: %d", resp.StatusCode))
 	}
 
 	return nil
 }
 
-func (c *Client) doGet(path string) (*http.Response, error) {
-	resp, err := c.client.Get(path)
+func (c *Client) doGet(ctx context.Context, path string) (*http.Response, error) {
+	resp, err := c.get(ctx, path)
 	if err != nil {
 		return nil, err
 	}
@@ -171,17 +381,16 @@ func (c *Client) doGet(path string) (*http.Response, error) {
 		return resp, nil
 	}
 
-	closeResponseBody(resp)
-	slog.Warn("received 403 from qBittorrent, re-authenticating...")
-	if err := c.Login(); err != nil {
-		return nil, fmt.Errorf("re-authentication failed: %w", err)
+	torrent.CloseResponseBody(resp)
+	if err := c.reauthenticate(ctx); err != nil {
+		return nil, err
 	}
 
-	return c.client.Get(path)
+	return c.get(ctx, path)
 }
 
-func (c *Client) doPostForm(path string, data url.Values) (*http.Response, error) {
-	resp, err := c.client.PostForm(path, data)
+func (c *Client) doPostForm(ctx context.Context, path string, data url.Values) (*http.Response, error) {
+	resp, err := c.postForm(ctx, path, data)
 	if err != nil {
 		return nil, err
 	}
@@ -190,36 +399,77 @@ func (c *Client) doPostForm(path string, data url.Values) (*http.Response, error
 		return resp, nil
 	}
 
-	closeResponseBody(resp)
-	slog.Warn("received 403 from qBittorrent, re-authenticating...")
-	if err := c.Login(); err != nil {
-		return nil, fmt.Errorf("re-authentication failed: %w", err)
+	torrent.CloseResponseBody(resp)
+	if err := c.reauthenticate(ctx); err != nil {
+		return nil, err
 	}
 
-	return c.client.PostForm(path, data)
+	return c.postForm(ctx, path, data)
+}
+
+func (c *Client) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
 }
 
-func decodePreferences(resp *http.Response) (int, error) {
-	defer closeResponseBody(resp)
+func (c *Client) postForm(ctx context.Context, path string, data url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.client.Do(req)
+}
+
+// reauthenticate handles a 403 by logging in again. With login skipped a 403
+// means the bypass whitelist no longer covers us, so it is reported instead.
+func (c *Client) reauthenticate(ctx context.Context) error {
+	if c.skipLogin {
+		return torrent.NewError(torrent.KindBadCredentials,
+			errors.New("received 403 from qBittorrent with login skipped; check the WebUI authentication bypass whitelist"))
+	}
+
+	slog.Warn("received 403 from qBittorrent, re-authenticating...")
+	if err := c.Login(ctx); err != nil {
+		return fmt.Errorf("re-authentication failed: %w", err)
+	}
+	// A 403 usually means qBittorrent restarted, possibly after an upgrade.
+	return c.detectVersion(ctx)
+}
+
+// decodePreferences names the detected version in its errors, since an
+// unexpected preferences response usually means an unsupported release.
+func (c *Client) decodePreferences(resp *http.Response) (int, error) {
+	defer torrent.CloseResponseBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		return 0, torrent.NewError(torrent.KindUnexpectedResponse,
+			fmt.Errorf("%s: %w", c.describeVersion(), &retry.StatusError{Code: resp.StatusCode, Body: string(body)}))
 	}
 
-	var prefs Preferences
+	var prefs struct {
+		ListenPort *int `json:"listen_port"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&prefs); err != nil {
-		return 0, fmt.Errorf("failed to decode preferences: %w", err)
+		return 0, torrent.NewError(torrent.KindUnexpectedResponse,
+			fmt.Errorf("failed to decode preferences from %s: %w", c.describeVersion(), err))
+	}
+	if prefs.ListenPort == nil {
+		return 0, torrent.NewError(torrent.KindUnexpectedResponse,
+			fmt.Errorf("preferences from %s have no listen_port", c.describeVersion()))
 	}
 
-	return prefs.ListenPort, nil
+	return *prefs.ListenPort, nil
 }
 
-func closeResponseBody(resp *http.Response) {
-	if resp == nil || resp.Body == nil {
-		return
-	}
-	if err := resp.Body.Close(); err != nil {
-		slog.Warn("failed to close response body", "error", err)
-	}
+// unexpectedStatus classifies a response other than 200, including a 403 that
+// persisted after re-authentication, as unexpected_response. The status is
+// kept as a retry.StatusError so 4xx responses are not retried.
+func unexpectedStatus(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	return torrent.NewError(torrent.KindUnexpectedResponse, &retry.StatusError{Code: resp.StatusCode, Body: string(body)})
 }
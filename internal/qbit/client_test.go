@@ -1,12 +1,17 @@
 package qbit
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
 )
 
 func TestNewClient_Success(t *testing.T) {
@@ -20,7 +25,7 @@ func TestNewClient_Success(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, err := NewClient(server.URL, "admin", "admin")
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
 	if err != nil {
 		t.Fatalf("NewClient() error = %v, want nil", err)
 	}
@@ -36,7 +41,7 @@ func TestNewClient_LoginFailure(t *testing.T) {
 	}))
 	defer server.Close()
 
-	_, err := NewClient(server.URL, "admin", "wrongpass")
+	_, err := NewClient(context.Background(), server.URL, "admin", "wrongpass")
 	if err == nil {
 		t.Fatal("NewClient() error = nil, want error")
 	}
@@ -49,8 +54,8 @@ func TestLogin_Success(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	err := client.Login()
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	err := client.Login(context.Background())
 	if err != nil {
 		t.Errorf("Login() error = %v, want nil", err)
 	}
@@ -76,7 +81,7 @@ func TestLogin_Failure(t *testing.T) {
 		},
 	}
 
-	err := client.Login()
+	err := client.Login(context.Background())
 	if err == nil {
 		t.Error("Login() error = nil, want error")
 	}
@@ -102,8 +107,8 @@ func TestGetPort_Success(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	port, err := client.GetPort()
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	port, err := client.GetPort(context.Background())
 	if err != nil {
 		t.Fatalf("GetPort() error = %v, want nil", err)
 	}
@@ -136,8 +141,8 @@ func TestGetPort_Reauthentication(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	port, err := client.GetPort()
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	port, err := client.GetPort(context.Background())
 	if err != nil {
 		t.Fatalf("GetPort() error = %v, want nil", err)
 	}
@@ -150,9 +155,6 @@ func TestGetPort_Reauthentication(t *testing.T) {
 }
 
 func TestGetPort_RetryOnServerError(t *testing.T) {
-	origDelay := requestRetryDelay
-	requestRetryDelay = 10 * time.Millisecond
-	defer func() { requestRetryDelay = origDelay }()
 	callCount := 0
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/api/v2/auth/login" {
@@ -175,8 +177,9 @@ func TestGetPort_RetryOnServerError(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	port, err := client.GetPort()
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+	port, err := client.GetPort(context.Background())
 	if err != nil {
 		t.Fatalf("GetPort() error = %v, want nil", err)
 	}
@@ -188,6 +191,35 @@ func TestGetPort_RetryOnServerError(t *testing.T) {
 	}
 }
 
+func TestGetPort_CancelledDuringRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/auth/login" {
+			_, _ = w.Write([]byte("Ok."))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = client.GetPort(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetPort() error = %v, want context deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetPort() took %v, retry sleep not cancelled", elapsed)
+	}
+}
+
 func TestSetPort_Success(t *testing.T) {
 	receivedPort := 0
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -226,8 +258,8 @@ func TestSetPort_Success(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	err := client.SetPort(9999)
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	err := client.SetPort(context.Background(), 9999)
 	if err != nil {
 		t.Fatalf("SetPort() error = %v, want nil", err)
 	}
@@ -258,8 +290,8 @@ func TestSetPort_Reauthentication(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	err := client.SetPort(8888)
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	err := client.SetPort(context.Background(), 8888)
 	if err != nil {
 		t.Fatalf("SetPort() error = %v, want nil", err)
 	}
@@ -269,10 +301,6 @@ func TestSetPort_Reauthentication(t *testing.T) {
 }
 
 func TestSetPort_RetryOnServerError(t *testing.T) {
-	origDelay := requestRetryDelay
-	requestRetryDelay = 10 * time.Millisecond
-	defer func() { requestRetryDelay = origDelay }()
-
 	callCount := 0
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/api/v2/auth/login" {
@@ -293,8 +321,9 @@ func TestSetPort_RetryOnServerError(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	err := client.SetPort(7777)
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+	err := client.SetPort(context.Background(), 7777)
 	if err != nil {
 		t.Fatalf("SetPort() error = %v, want nil", err)
 	}
@@ -303,6 +332,34 @@ func TestSetPort_RetryOnServerError(t *testing.T) {
 	}
 }
 
+func TestSetPort_NoRetryOnClientError(t *testing.T) {
+	callCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/auth/login" {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("Ok."))
+			return
+		}
+		if r.URL.Path == "/api/v2/app/setPreferences" {
+			callCount++
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+	err := client.SetPort(context.Background(), 7777)
+	if err == nil {
+		t.Fatal("SetPort() error = nil, want error")
+	}
+	if callCount != 1 {
+		t.Errorf("SetPort() call count = %d, want 1", callCount)
+	}
+}
+
 func TestPing_Success(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/api/v2/auth/login" {
@@ -319,8 +376,8 @@ func TestPing_Success(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	err := client.Ping()
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	err := client.Ping(context.Background())
 	if err != nil {
 		t.Errorf("Ping() error = %v, want nil", err)
 	}
@@ -341,8 +398,8 @@ func TestPing_Failure(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	err := client.Ping()
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	err := client.Ping(context.Background())
 	if err == nil {
 		t.Error("Ping() error = nil, want error")
 	}
@@ -370,8 +427,8 @@ func TestPing_Reauthentication(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	err := client.Ping()
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	err := client.Ping(context.Background())
 	if err != nil {
 		t.Errorf("Ping() error = %v, want nil", err)
 	}
@@ -392,9 +449,111 @@ func TestPing_ReauthenticationFailure(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, _ := NewClient(server.URL, "admin", "admin")
-	err := client.Ping()
+	client, _ := NewClient(context.Background(), server.URL, "admin", "admin")
+	err := client.Ping(context.Background())
 	if err == nil {
 		t.Error("Ping() error = nil, want error when repeated 403")
 	}
 }
+
+func TestLogin_ErrorKinds(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   torrent.ErrorKind
+	}{
+		{name: "bad credentials", status: http.StatusOK, body: "Fails.", want: torrent.KindBadCredentials},
+		{name: "unauthorized", status: http.StatusUnauthorized, body: "", want: torrent.KindBadCredentials},
+		{
+			name:   "ip banned",
+			status: http.StatusForbidden,
+			body:   "Your IP address has been banned after too many failed authentication attempts.",
+			want:   torrent.KindIPBanned,
+		},
+		{name: "unexpected", status: http.StatusInternalServerError, body: "oops", want: torrent.KindUnexpectedResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := NewClient(context.Background(), server.URL, "admin", "admin")
+			if got := torrent.KindOf(err); got != tt.want {
+				t.Errorf("KindOf(NewClient() error) = %q, want %q (error: %v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLogin_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serverURL := server.URL
+	server.Close()
+
+	_, err := NewClient(context.Background(), serverURL, "admin", "admin")
+	if got := torrent.KindOf(err); got != torrent.KindUnreachable {
+		t.Errorf("KindOf() = %q, want %q (error: %v)", got, torrent.KindUnreachable, err)
+	}
+}
+
+func TestLogin_BacksOffAfterBan(t *testing.T) {
+	loginAttempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/auth/login" {
+			loginAttempts++
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("Your IP address has been banned after too many failed authentication attempts."))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &Client{baseURL: server.URL, user: "admin", pass: "admin", client: &http.Client{Jar: jar}}
+
+	for range 3 {
+		err := client.Login(context.Background())
+		if got := torrent.KindOf(err); got != torrent.KindIPBanned {
+			t.Fatalf("KindOf(Login() error) = %q, want %q", got, torrent.KindIPBanned)
+		}
+	}
+	if _, err := client.GetPort(context.Background()); torrent.KindOf(err) != torrent.KindIPBanned {
+		t.Errorf("GetPort() error = %v, want ip_banned", err)
+	}
+	if loginAttempts != 1 {
+		t.Errorf("login attempts = %d, want 1 while backing off", loginAttempts)
+	}
+
+	// Once the backoff has passed, logins are attempted again.
+	client.loginBlockedUntil = time.Now().Add(-time.Second)
+	_ = client.Login(context.Background())
+	if loginAttempts != 2 {
+		t.Errorf("login attempts = %d, want 2 after backoff expired", loginAttempts)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	tests := []struct {
+		kind     torrent.ErrorKind
+		failures int
+		want     time.Duration
+	}{
+		{kind: torrent.KindBadCredentials, failures: 1, want: loginBackoffBase},
+		{kind: torrent.KindBadCredentials, failures: 3, want: 4 * loginBackoffBase},
+		{kind: torrent.KindBadCredentials, failures: 100, want: loginBackoffMax},
+		{kind: torrent.KindIPBanned, failures: 1, want: bannedLoginBackoff},
+		{kind: torrent.KindIPBanned, failures: 20, want: loginBackoffMax},
+	}
+
+	for _, tt := range tests {
+		if got := loginBackoff(tt.kind, tt.failures); got != tt.want {
+			t.Errorf("loginBackoff(%s, %d) = %v, want %v", tt.kind, tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package qbit
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"testing"
+)
+
+const loginPath = "/api/v2/auth/login"
+
+// fakeQbit is a configurable qBittorrent WebUI for tests. Logins are
+// accepted with "Ok." unless routes overrides the login path, routes are
+// keyed by their full API path, and anything else is 404.
+type fakeQbit struct {
+	// basePath prefixes every path, as a reverse proxy in front of the
+	// WebUI would.
+	basePath string
+	// appVersion and apiVersion are served by app/version and
+	// app/webapiVersion when set.
+	appVersion string
+	apiVersion string
+	// loginStatus replaces the 200 login status; a 204 has no body.
+	loginStatus int
+	// sessions, when set, makes every login issue a new SID and every other
+	// request need one of the SIDs it holds.
+	sessions map[string]bool
+	// guard runs before routing. It rejects a request by writing the
+	// response and returning false.
+	guard  func(w http.ResponseWriter, r *http.Request) bool
+	routes map[string]http.HandlerFunc
+
+	mu     gosync.Mutex
+	logins int
+}
+
+// start serves the fake over HTTP until the test ends.
+func (f *fakeQbit) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// startTLS serves the fake over HTTPS with the given server config, if any.
+func (f *fakeQbit) startTLS(t *testing.T, config *tls.Config) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(f.serveHTTP))
+	if config != nil {
+		server.TLS = config
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// loginCalls returns the number of login requests so far.
+func (f *fakeQbit) loginCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.logins
+}
+
+// expire drops a session so the next request with its SID is refused.
+func (f *fakeQbit) expire(sid string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sessions, sid)
+}
+
+func (f *fakeQbit) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.guard != nil && !f.guard(w, r) {
+		return
+	}
+	path, found := strings.CutPrefix(r.URL.Path, f.basePath)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if path == loginPath {
+		f.login(w, r)
+		return
+	}
+	if !f.validSession(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if route, ok := f.routes[path]; ok {
+		route(w, r)
+		return
+	}
+	switch {
+	case path == "/api/v2/app/version" && f.appVersion != "":
+		_, _ = w.Write([]byte(f.appVersion))
+	case path == "/api/v2/app/webapiVersion" && f.apiVersion != "":
+		_, _ = w.Write([]byte(f.apiVersion))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeQbit) login(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.logins++
+	if f.sessions != nil {
+		sid := "sid-" + strconv.Itoa(f.logins)
+		f.sessions[sid] = true
+		http.SetCookie(w, &http.Cookie{Name: "SID", Value: sid, Path: "/"})
+	}
+	f.mu.Unlock()
+
+	if route, ok := f.routes[loginPath]; ok {
+		route(w, r)
+		return
+	}
+	if f.loginStatus != 0 {
+		w.WriteHeader(f.loginStatus)
+	}
+	if f.loginStatus != http.StatusNoContent {
+		_, _ = w.Write([]byte("Ok."))
+	}
+}
+
+func (f *fakeQbit) validSession(r *http.Request) bool {
+	if f.sessions == nil {
+		return true
+	}
+	cookie, err := r.Cookie("SID")
+	if err != nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessions[cookie.Value]
+}
+
+// reply answers every request with body.
+func reply(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+// replyStatus answers every request with an empty response and code.
+func replyStatus(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
@@ -0,0 +1,94 @@
+package qbit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// KillSwitchOptions limits which torrents are paused while no forwarded port
+// is available. Empty lists pause every running torrent; when both are set a
+// torrent must match one of each.
+type KillSwitchOptions struct {
+	Categories []string
+	Tags       []string
+}
+
+// ParseKillSwitchOptions reads the KILL_SWITCH, KILL_SWITCH_CATEGORIES and
+// KILL_SWITCH_TAGS settings. It returns nil when KILL_SWITCH is not enabled.
+func ParseKillSwitchOptions(settings map[string]string) (*KillSwitchOptions, error) {
+	enabled := settings["KILL_SWITCH"]
+	if enabled == "" {
+		return nil, nil
+	}
+	on, err := strconv.ParseBool(enabled)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KILL_SWITCH value %q: %w", enabled, err)
+	}
+	if !on {
+		return nil, nil
+	}
+
+	return &KillSwitchOptions{
+		Categories: splitList(settings["KILL_SWITCH_CATEGORIES"]),
+		Tags:       splitList(settings["KILL_SWITCH_TAGS"]),
+	}, nil
+}
+
+// SetKillSwitch enables pausing with the given filter, or disables it for nil.
+func (c *Client) SetKillSwitch(opts *KillSwitchOptions) {
+	c.killSwitch = opts
+}
+
+func (c *Client) KillSwitchEnabled() bool {
+	return c.killSwitch != nil
+}
+
+// PauseTorrents stops the matching torrents that are still running and
+// returns their hashes, so only those are resumed later.
+func (c *Client) PauseTorrents(ctx context.Context) ([]string, error) {
+	if c.killSwitch == nil {
+		return nil, nil
+	}
+
+	torrents, err := c.listTorrents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	for _, t := range torrents {
+		if !isStopped(t.State) && matchesFilter(c.killSwitch.Categories, c.killSwitch.Tags, t) {
+			hashes = append(hashes, t.Hash)
+		}
+	}
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	if err := c.postHashes(ctx, c.currentCompat().stopPath, hashes); err != nil {
+		return nil, fmt.Errorf("failed to pause torrents: %w", err)
+	}
+	slog.Info("paused qBittorrent torrents", "torrents", len(hashes))
+	return hashes, nil
+}
+
+// ResumeTorrents starts the given torrents again. Hashes of torrents removed
+// in the meantime are ignored by qBittorrent.
+func (c *Client) ResumeTorrents(ctx context.Context, hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	if err := c.postHashes(ctx, c.currentCompat().startPath, hashes); err != nil {
+		return fmt.Errorf("failed to resume torrents: %w", err)
+	}
+	slog.Info("resumed qBittorrent torrents", "torrents", len(hashes))
+	return nil
+}
+
+// isStopped covers the 4.x "paused" and 5.x "stopped" states.
+func isStopped(state string) bool {
+	return strings.HasPrefix(state, "paused") || strings.HasPrefix(state, "stopped")
+}
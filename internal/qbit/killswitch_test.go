@@ -0,0 +1,168 @@
+package qbit
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+func TestParseKillSwitchOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]string
+		want     *KillSwitchOptions
+		wantErr  bool
+	}{
+		{name: "not set", settings: map[string]string{}, want: nil},
+		{name: "disabled", settings: map[string]string{"KILL_SWITCH": "false"}, want: nil},
+		{name: "all torrents", settings: map[string]string{"KILL_SWITCH": "true"}, want: &KillSwitchOptions{}},
+		{
+			name:     "filtered",
+			settings: map[string]string{"KILL_SWITCH": "1", "KILL_SWITCH_CATEGORIES": "tv", "KILL_SWITCH_TAGS": "private, seed"},
+			want:     &KillSwitchOptions{Categories: []string{"tv"}, Tags: []string{"private", "seed"}},
+		},
+		{name: "invalid flag", settings: map[string]string{"KILL_SWITCH": "sometimes"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKillSwitchOptions(tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKillSwitchOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKillSwitchOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+const testStateTorrentList = `[
+	{"hash":"a","category":"tv","tags":"","state":"uploading"},
+	{"hash":"b","category":"tv","tags":"","state":"pausedUP"},
+	{"hash":"c","category":"tv","tags":"","state":"stoppedDL"},
+	{"hash":"d","category":"movies","tags":"","state":"downloading"},
+	{"hash":"e","category":"tv","tags":"","state":"stalledUP"}
+]`
+
+// killSwitchRoutes list testStateTorrentList and record the path and hashes
+// of every torrent action.
+func killSwitchRoutes(actions map[string][]string) map[string]http.HandlerFunc {
+	record := func(w http.ResponseWriter, r *http.Request) {
+		actions[r.URL.Path] = strings.Split(r.FormValue("hashes"), "|")
+	}
+	return map[string]http.HandlerFunc{
+		"/api/v2/torrents/info":   reply(testStateTorrentList),
+		"/api/v2/torrents/pause":  record,
+		"/api/v2/torrents/resume": record,
+		"/api/v2/torrents/stop":   record,
+		"/api/v2/torrents/start":  record,
+	}
+}
+
+func TestPauseAndResumeTorrents(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiVersion string
+		opts       *KillSwitchOptions
+		stopPath   string
+		startPath  string
+		wantPaused []string
+	}{
+		{
+			name:       "qBittorrent 4 pauses running torrents",
+			apiVersion: "2.9.3",
+			opts:       &KillSwitchOptions{},
+			stopPath:   "/api/v2/torrents/pause",
+			startPath:  "/api/v2/torrents/resume",
+			wantPaused: []string{"a", "d", "e"},
+		},
+		{
+			name:       "qBittorrent 5 stops torrents in a category",
+			apiVersion: "2.11.2",
+			opts:       &KillSwitchOptions{Categories: []string{"tv"}},
+			stopPath:   "/api/v2/torrents/stop",
+			startPath:  "/api/v2/torrents/start",
+			wantPaused: []string{"a", "e"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := make(map[string][]string)
+			server := (&fakeQbit{apiVersion: tt.apiVersion, routes: killSwitchRoutes(actions)}).start(t)
+
+			client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			client.SetKillSwitch(tt.opts)
+
+			paused, err := client.PauseTorrents(context.Background())
+			if err != nil {
+				t.Fatalf("PauseTorrents() error = %v", err)
+			}
+			if !reflect.DeepEqual(paused, tt.wantPaused) || !reflect.DeepEqual(actions[tt.stopPath], tt.wantPaused) {
+				t.Errorf("PauseTorrents() = %v, %s got %v, want %v", paused, tt.stopPath, actions[tt.stopPath], tt.wantPaused)
+			}
+
+			if err := client.ResumeTorrents(context.Background(), paused); err != nil {
+				t.Fatalf("ResumeTorrents() error = %v", err)
+			}
+			if !reflect.DeepEqual(actions[tt.startPath], tt.wantPaused) {
+				t.Errorf("%s got %v, want %v", tt.startPath, actions[tt.startPath], tt.wantPaused)
+			}
+		})
+	}
+}
+
+func TestPauseAndResumeTorrents_StatusErrors(t *testing.T) {
+	// Listing works once so the pause can be attempted; every action is
+	// then refused.
+	listed := false
+	refuse := replyStatus(http.StatusInternalServerError)
+	server := (&fakeQbit{routes: map[string]http.HandlerFunc{
+		"/api/v2/torrents/info": func(w http.ResponseWriter, r *http.Request) {
+			if listed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			listed = true
+			_, _ = w.Write([]byte(testStateTorrentList))
+		},
+		"/api/v2/torrents/pause":  refuse,
+		"/api/v2/torrents/resume": refuse,
+		"/api/v2/torrents/stop":   refuse,
+		"/api/v2/torrents/start":  refuse,
+	}}).start(t)
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetKillSwitch(&KillSwitchOptions{})
+
+	if _, err := client.PauseTorrents(context.Background()); torrent.KindOf(err) != torrent.KindUnexpectedResponse {
+		t.Errorf("PauseTorrents() with a failing action error = %v, want unexpected_response", err)
+	}
+	if _, err := client.PauseTorrents(context.Background()); torrent.KindOf(err) != torrent.KindUnexpectedResponse {
+		t.Errorf("PauseTorrents() with a forbidden list error = %v, want unexpected_response", err)
+	}
+	if err := client.ResumeTorrents(context.Background(), []string{"a"}); torrent.KindOf(err) != torrent.KindUnexpectedResponse {
+		t.Errorf("ResumeTorrents() error = %v, want unexpected_response", err)
+	}
+}
+
+func TestPauseTorrents_Disabled(t *testing.T) {
+	client := &Client{}
+	if client.KillSwitchEnabled() {
+		t.Error("KillSwitchEnabled() = true without options")
+	}
+	if paused, err := client.PauseTorrents(context.Background()); err != nil || paused != nil {
+		t.Errorf("PauseTorrents() = %v, %v, want nil, nil", paused, err)
+	}
+}
@@ -0,0 +1,171 @@
+package qbit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// ParsePreferences parses a "key=value,key=value" list such as
+// "upnp=false,random_port=false". Values are read as JSON where possible
+// (booleans, numbers, quoted strings) and as plain strings otherwise.
+// listen_port is rejected because the watcher manages it.
+func ParsePreferences(spec string) (map[string]any, error) {
+	prefs := make(map[string]any)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, raw, found := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		raw = strings.TrimSpace(raw)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid preference %q: expected key=value", entry)
+		}
+		if key == "listen_port" {
+			return nil, fmt.Errorf("preference listen_port is managed by the port sync and cannot be enforced")
+		}
+
+		var value any
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		prefs[key] = value
+	}
+	return prefs, nil
+}
+
+// SetEnforcedPreferences sets the preferences that EnforceSettings checks and
+// re-applies. A nil or empty map disables enforcement.
+func (c *Client) SetEnforcedPreferences(prefs map[string]any) {
+	c.enforced = prefs
+}
+
+// EnforceSettings compares the enforced preferences with the current ones and
+// re-applies any that drifted, logging each correction separately.
+func (c *Client) EnforceSettings(ctx context.Context) error {
+	if len(c.enforced) == 0 {
+		return nil
+	}
+
+	current, err := c.getPreferences(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(c.enforced))
+	for key := range c.enforced {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	drift := make(map[string]any)
+	for _, key := range keys {
+		want := c.enforced[key]
+		raw, ok := current[key]
+		if !ok {
+			slog.Warn("enforced qBittorrent preference not reported by client", "preference", key)
+			drift[key] = want
+			continue
+		}
+		var have any
+		if err := json.Unmarshal(raw, &have); err != nil {
+			return fmt.Errorf("failed to decode preference %s: %w", key, err)
+		}
+		if !preferenceEqual(have, want) {
+			drift[key] = want
+		}
+	}
+
+	if len(drift) == 0 {
+		return nil
+	}
+
+	if err := c.setPreferences(ctx, drift); err != nil {
+		return fmt.Errorf("failed to re-apply preferences: %w", err)
+	}
+
+	for _, key := range keys {
+		want, ok := drift[key]
+		if !ok {
+			continue
+		}
+		var have any
+		if raw, ok := current[key]; ok {
+			_ = json.Unmarshal(raw, &have)
+		}
+		slog.Info("corrected qBittorrent preference drift",
+			"preference", key,
+			"was", have,
+			"now", want,
+		)
+	}
+
+	return nil
+}
+
+func (c *Client) getPreferences(ctx context.Context) (map[string]json.RawMessage, error) {
+	resp, err := c.doGet(ctx, c.baseURL+"/api/v2/app/preferences")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var prefs map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&prefs); err != nil {
+		return nil, fmt.Errorf("failed to decode preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+func (c *Client) setPreferences(ctx context.Context, prefs map[string]any) error {
+	jsonBytes, err := json.Marshal(prefs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal preferences: %w", err)
+	}
+
+	data := url.Values{}
+	data.Set("json", string(jsonBytes))
+
+	resp, err := c.doPostForm(ctx, c.baseURL+"/api/v2/app/setPreferences", data)
+	if err != nil {
+		return fmt.Errorf("failed to set preferences: %w", err)
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// preferenceEqual compares a decoded client value with a desired value after
+// normalising both through JSON, so 1 and 1.0 compare equal.
+func preferenceEqual(have, want any) bool {
+	encoded, err := json.Marshal(want)
+	if err != nil {
+		return false
+	}
+	var normalised any
+	if err := json.Unmarshal(encoded, &normalised); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(have, normalised)
+}
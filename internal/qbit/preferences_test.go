@@ -0,0 +1,123 @@
+package qbit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParsePreferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]any
+		wantErr bool
+	}{
+		{name: "empty", spec: "", want: map[string]any{}},
+		{
+			name: "typed values",
+			spec: "upnp=false, random_port=false,max_connec=500,save_path=/downloads",
+			want: map[string]any{"upnp": false, "random_port": false, "max_connec": float64(500), "save_path": "/downloads"},
+		},
+		{name: "quoted string", spec: `announce_ip="10.0.0.1"`, want: map[string]any{"announce_ip": "10.0.0.1"}},
+		{name: "missing value separator", spec: "upnp", wantErr: true},
+		{name: "empty key", spec: "=false", wantErr: true},
+		{name: "listen_port rejected", spec: "listen_port=6881", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePreferences(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePreferences() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePreferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnforceSettings_CorrectsDrift(t *testing.T) {
+	var sets []map[string]any
+	prefs := map[string]any{"listen_port": 6881, "upnp": true, "random_port": false, "max_connec": 500}
+	server := (&fakeQbit{routes: map[string]http.HandlerFunc{
+		"/api/v2/app/preferences": func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(prefs)
+		},
+		"/api/v2/app/setPreferences": func(w http.ResponseWriter, r *http.Request) {
+			var update map[string]any
+			if err := json.Unmarshal([]byte(r.FormValue("json")), &update); err != nil {
+				t.Errorf("failed to decode setPreferences payload: %v", err)
+			}
+			for key, value := range update {
+				prefs[key] = value
+			}
+			sets = append(sets, update)
+		},
+	}}).start(t)
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetEnforcedPreferences(map[string]any{"upnp": false, "random_port": false, "max_connec": float64(500)})
+
+	if err := client.EnforceSettings(context.Background()); err != nil {
+		t.Fatalf("EnforceSettings() error = %v", err)
+	}
+	if len(sets) != 1 {
+		t.Fatalf("setPreferences calls = %d, want 1", len(sets))
+	}
+	if want := map[string]any{"upnp": false}; !reflect.DeepEqual(sets[0], want) {
+		t.Errorf("setPreferences payload = %v, want only drifted keys %v", sets[0], want)
+	}
+
+	// Nothing drifted on the second pass.
+	if err := client.EnforceSettings(context.Background()); err != nil {
+		t.Fatalf("EnforceSettings() error = %v", err)
+	}
+	if len(sets) != 1 {
+		t.Errorf("setPreferences calls = %d, want no further writes", len(sets))
+	}
+}
+
+func TestEnforceSettings_Disabled(t *testing.T) {
+	requests := 0
+	server := (&fakeQbit{guard: func(http.ResponseWriter, *http.Request) bool {
+		requests++
+		return true
+	}}).start(t)
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	requests = 0
+
+	if err := client.EnforceSettings(context.Background()); err != nil {
+		t.Fatalf("EnforceSettings() error = %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("requests = %d, want none when no preferences are enforced", requests)
+	}
+}
+
+func TestEnforceSettings_SetFailure(t *testing.T) {
+	server := (&fakeQbit{routes: map[string]http.HandlerFunc{
+		"/api/v2/app/preferences":    reply(`{"upnp":true}`),
+		"/api/v2/app/setPreferences": replyStatus(http.StatusBadRequest),
+	}}).start(t)
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetEnforcedPreferences(map[string]any{"upnp": false})
+
+	if err := client.EnforceSettings(context.Background()); err == nil {
+		t.Fatal("EnforceSettings() error = nil, want error")
+	}
+}
@@ -0,0 +1,97 @@
+package qbit
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const headerSettingPrefix = "HEADER_"
+
+// ProxyOptions configures access to a WebUI published behind a reverse proxy.
+type ProxyOptions struct {
+	// BasePath is appended to the URL, e.g. "/qbt" for https://host/qbt/.
+	BasePath string
+	// Headers are sent with every request. Referer and Origin usually need to
+	// match the public URL to pass qBittorrent's CSRF checks.
+	Headers map[string]string
+	// Username and Password, or BearerToken, authenticate with the proxy in
+	// addition to the WebUI cookie login.
+	Username    string
+	Password    string
+	BearerToken string
+}
+
+// ProxyOptionsFromSettings reads the BASE_PATH, HEADER_<NAME>, PROXY_USER,
+// PROXY_PASSWORD and PROXY_BEARER_TOKEN settings. HEADER_X_FORWARDED_HOST
+// becomes the X-Forwarded-Host header.
+func ProxyOptionsFromSettings(settings map[string]string) (ProxyOptions, error) {
+	opts := ProxyOptions{
+		BasePath:    settings["BASE_PATH"],
+		Username:    settings["PROXY_USER"],
+		Password:    settings["PROXY_PASSWORD"],
+		BearerToken: settings["PROXY_BEARER_TOKEN"],
+	}
+
+	for key, value := range settings {
+		if name, ok := strings.CutPrefix(key, headerSettingPrefix); ok && name != "" {
+			if opts.Headers == nil {
+				opts.Headers = make(map[string]string)
+			}
+			opts.Headers[http.CanonicalHeaderKey(strings.ReplaceAll(name, "_", "-"))] = value
+		}
+	}
+
+	if opts.BearerToken != "" && (opts.Username != "" || opts.Password != "") {
+		return ProxyOptions{}, errors.New("proxy basic auth and bearer token are mutually exclusive")
+	}
+
+	return opts, nil
+}
+
+// resolveURL joins the base URL and base path without a trailing slash.
+func (o ProxyOptions) resolveURL(baseURL string) string {
+	resolved := strings.TrimRight(baseURL, "/")
+	if path := strings.Trim(o.BasePath, "/"); path != "" {
+		resolved += "/" + path
+	}
+	return resolved
+}
+
+// wrap returns base unchanged when no headers or proxy auth are configured.
+func (o ProxyOptions) wrap(base http.RoundTripper) http.RoundTripper {
+	headers := make(http.Header, len(o.Headers)+1)
+	for name, value := range o.Headers {
+		headers.Set(name, value)
+	}
+	switch {
+	case o.BearerToken != "":
+		headers.Set("Authorization", "Bearer "+o.BearerToken)
+	case o.Username != "" || o.Password != "":
+		credentials := base64.StdEncoding.EncodeToString([]byte(o.Username + ":" + o.Password))
+		headers.Set("Authorization", "Basic "+credentials)
+	}
+
+	if len(headers) == 0 {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &headerTransport{base: base, headers: headers}
+}
+
+// headerTransport adds fixed headers to every outgoing request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+	return t.base.RoundTrip(req)
+}
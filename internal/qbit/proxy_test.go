@@ -0,0 +1,189 @@
+package qbit
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+func TestProxyOptionsFromSettings(t *testing.T) {
+	opts, err := ProxyOptionsFromSettings(map[string]string{
+		"BASE_PATH":      "/qbt/",
+		"HEADER_REFERER": "https://host/qbt/",
+		"HEADER_ORIGIN":  "https://host",
+		"PROXY_USER":     "proxy",
+		"PROXY_PASSWORD": "secret",
+	})
+	if err != nil {
+		t.Fatalf("ProxyOptionsFromSettings() error = %v", err)
+	}
+	want := ProxyOptions{
+		BasePath: "/qbt/",
+		Headers:  map[string]string{"Referer": "https://host/qbt/", "Origin": "https://host"},
+		Username: "proxy",
+		Password: "secret",
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("ProxyOptionsFromSettings() = %+v, want %+v", opts, want)
+	}
+
+	_, err = ProxyOptionsFromSettings(map[string]string{"PROXY_USER": "proxy", "PROXY_BEARER_TOKEN": "token"})
+	if err == nil {
+		t.Error("expected error when both basic auth and bearer token are set")
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		basePath string
+		want     string
+	}{
+		{baseURL: "https://host", basePath: "", want: "https://host"},
+		{baseURL: "https://host/", basePath: "/qbt/", want: "https://host/qbt"},
+		{baseURL: "https://host/qbt/", basePath: "", want: "https://host/qbt"},
+		{baseURL: "https://host", basePath: "apps/qbt", want: "https://host/apps/qbt"},
+	}
+
+	for _, tt := range tests {
+		if got := (ProxyOptions{BasePath: tt.basePath}).resolveURL(tt.baseURL); got != tt.want {
+			t.Errorf("resolveURL(%q, %q) = %q, want %q", tt.baseURL, tt.basePath, got, tt.want)
+		}
+	}
+}
+
+// newProxiedQbit mimics a reverse proxy at /qbt that requires the given
+// Authorization header and a matching Referer before passing requests on.
+func newProxiedQbit(authorization string) *fakeQbit {
+	return &fakeQbit{
+		basePath:   "/qbt",
+		appVersion: "v4.6.0",
+		guard: func(w http.ResponseWriter, r *http.Request) bool {
+			if r.Header.Get("Authorization") != authorization {
+				w.WriteHeader(http.StatusUnauthorized)
+				return false
+			}
+			if r.Header.Get("Referer") != "https://host/qbt/" {
+				w.WriteHeader(http.StatusForbidden)
+				return false
+			}
+			return true
+		},
+		routes: map[string]http.HandlerFunc{
+			"/api/v2/app/preferences": reply(`{"listen_port":6881}`),
+		},
+	}
+}
+
+func TestNewClientWithOptions_Proxy(t *testing.T) {
+	tests := []struct {
+		name          string
+		proxy         ProxyOptions
+		authorization string
+	}{
+		{
+			name:          "basic auth",
+			proxy:         ProxyOptions{Username: "proxy", Password: "secret"},
+			authorization: "Basic cHJveHk6c2VjcmV0",
+		},
+		{
+			name:          "bearer token",
+			proxy:         ProxyOptions{BearerToken: "token"},
+			authorization: "Bearer token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newProxiedQbit(tt.authorization)
+			server := fake.start(t)
+
+			proxy := tt.proxy
+			proxy.BasePath = "/qbt"
+			proxy.Headers = map[string]string{"Referer": "https://host/qbt/"}
+			client, err := NewClientWithOptions(context.Background(), Options{URL: server.URL, Username: "admin", Password: "admin", Proxy: proxy})
+			if err != nil {
+				t.Fatalf("NewClientWithOptions() error = %v", err)
+			}
+
+			port, err := client.GetPort(context.Background())
+			if err != nil {
+				t.Fatalf("GetPort() error = %v", err)
+			}
+			if port != 6881 {
+				t.Errorf("GetPort() = %d, want 6881", port)
+			}
+			if calls := fake.loginCalls(); calls != 1 {
+				t.Errorf("login calls = %d, want 1", calls)
+			}
+		})
+	}
+}
+
+func TestNewClientWithOptions_SkipLogin(t *testing.T) {
+	fake := newProxiedQbit("")
+	server := fake.start(t)
+
+	client, err := NewClientWithOptions(context.Background(), Options{
+		URL:       server.URL,
+		Proxy:     ProxyOptions{BasePath: "/qbt", Headers: map[string]string{"Referer": "https://host/qbt/"}},
+		SkipLogin: true,
+	})
+	if err != nil {
+		t.Fatalf("NewClientWithOptions() error = %v", err)
+	}
+	if _, err := client.GetPort(context.Background()); err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if err := client.Login(context.Background()); err != nil {
+		t.Errorf("Login() error = %v, want nil when skipped", err)
+	}
+	if calls := fake.loginCalls(); calls != 0 {
+		t.Errorf("login calls = %d, want 0", calls)
+	}
+}
+
+func TestSkipLogin_Forbidden(t *testing.T) {
+	fake := &fakeQbit{appVersion: "v4.6.0", routes: map[string]http.HandlerFunc{
+		"/api/v2/app/webapiVersion": replyStatus(http.StatusForbidden),
+		"/api/v2/app/preferences":   replyStatus(http.StatusForbidden),
+	}}
+	server := fake.start(t)
+
+	client, err := NewClientWithOptions(context.Background(), Options{URL: server.URL, SkipLogin: true})
+	if err != nil {
+		t.Fatalf("NewClientWithOptions() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3})
+
+	_, err = client.GetPort(context.Background())
+	if torrent.KindOf(err) != torrent.KindBadCredentials {
+		t.Errorf("GetPort() error = %v, want bad_credentials", err)
+	}
+	if calls := fake.loginCalls(); calls != 0 {
+		t.Errorf("login calls = %d, want 0", calls)
+	}
+}
+
+func TestOptionsFromSettings(t *testing.T) {
+	opts, err := OptionsFromSettings(torrent.Options{
+		URL:      "https://host",
+		Username: "admin",
+		Password: "pass",
+		Settings: map[string]string{"SKIP_LOGIN": "true", "BASE_PATH": "/qbt", "TLS_INSECURE_SKIP_VERIFY": "true", "SESSION_FILE": "/data/session.json"},
+	})
+	if err != nil {
+		t.Fatalf("OptionsFromSettings() error = %v", err)
+	}
+	if !opts.SkipLogin || opts.Proxy.BasePath != "/qbt" || !opts.TLS.InsecureSkipVerify || opts.URL != "https://host" || opts.SessionFile != "/data/session.json" {
+		t.Errorf("OptionsFromSettings() = %+v", opts)
+	}
+
+	if _, err := OptionsFromSettings(torrent.Options{Settings: map[string]string{"SKIP_LOGIN": "perhaps"}}); err == nil {
+		t.Error("expected error for invalid SKIP_LOGIN")
+	}
+}
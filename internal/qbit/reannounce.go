@@ -0,0 +1,212 @@
+package qbit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+const (
+	defaultReannounceBatchSize = 100
+	defaultReannounceInterval  = time.Second
+)
+
+// ReannounceOptions limits which torrents are reannounced after a port change
+// and how fast. When both Categories and Tags are set a torrent must match
+// one of each.
+type ReannounceOptions struct {
+	Categories []string
+	Tags       []string
+	// BatchSize is the number of torrents sent per request and Interval the
+	// pause between requests.
+	BatchSize int
+	Interval  time.Duration
+}
+
+type torrentInfo struct {
+	Hash     string `json:"hash"`
+	Category string `json:"category"`
+	Tags     string `json:"tags"`
+	State    string `json:"state"`
+}
+
+// ParseReannounceOptions reads the REANNOUNCE, REANNOUNCE_CATEGORIES,
+// REANNOUNCE_TAGS, REANNOUNCE_BATCH_SIZE and REANNOUNCE_INTERVAL (seconds)
+// settings. It returns nil when REANNOUNCE is not enabled.
+func ParseReannounceOptions(settings map[string]string) (*ReannounceOptions, error) {
+	enabled := settings["REANNOUNCE"]
+	if enabled == "" {
+		return nil, nil
+	}
+	on, err := strconv.ParseBool(enabled)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REANNOUNCE value %q: %w", enabled, err)
+	}
+	if !on {
+		return nil, nil
+	}
+
+	opts := &ReannounceOptions{
+		Categories: splitList(settings["REANNOUNCE_CATEGORIES"]),
+		Tags:       splitList(settings["REANNOUNCE_TAGS"]),
+		BatchSize:  defaultReannounceBatchSize,
+		Interval:   defaultReannounceInterval,
+	}
+
+	if value := settings["REANNOUNCE_BATCH_SIZE"]; value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid REANNOUNCE_BATCH_SIZE %q", value)
+		}
+		opts.BatchSize = size
+	}
+	if value := settings["REANNOUNCE_INTERVAL"]; value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("invalid REANNOUNCE_INTERVAL %q", value)
+		}
+		opts.Interval = time.Duration(seconds) * time.Second
+	}
+
+	return opts, nil
+}
+
+// SetReannounce enables reannouncing with the given options; nil disables it.
+func (c *Client) SetReannounce(opts *ReannounceOptions) {
+	c.reannounce = opts
+}
+
+func (c *Client) ReannounceEnabled() bool {
+	return c.reannounce != nil
+}
+
+// Reannounce asks qBittorrent to announce the matching torrents to their
+// trackers in batches, so the new port is picked up straight away.
+func (c *Client) Reannounce(ctx context.Context) (int, error) {
+	if c.reannounce == nil {
+		return 0, nil
+	}
+	if !c.currentCompat().reannounce {
+		return 0, torrent.NewError(torrent.KindUnexpectedResponse,
+			fmt.Errorf("tracker reannounce requires qBittorrent 4.1.5 or newer, found %s", c.describeVersion()))
+	}
+
+	hashes, err := c.matchingTorrents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	batchSize := c.reannounce.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(hashes)
+	}
+
+	done := 0
+	for start := 0; start < len(hashes); start += batchSize {
+		if start > 0 && c.reannounce.Interval > 0 {
+			if err := retry.Sleep(ctx, c.reannounce.Interval); err != nil {
+				return done, err
+			}
+		}
+
+		end := min(start+batchSize, len(hashes))
+		if err := c.reannounceBatch(ctx, hashes[start:end]); err != nil {
+			return done, fmt.Errorf("reannounce failed after %d of %d torrents: %w", done, len(hashes), err)
+		}
+		done = end
+		slog.Debug("reannounced torrent batch", "done", done, "total", len(hashes))
+	}
+
+	return done, nil
+}
+
+func (c *Client) matchingTorrents(ctx context.Context) ([]string, error) {
+	torrents, err := c.listTorrents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(torrents))
+	for _, t := range torrents {
+		if matchesFilter(c.reannounce.Categories, c.reannounce.Tags, t) {
+			hashes = append(hashes, t.Hash)
+		}
+	}
+	return hashes, nil
+}
+
+func (c *Client) listTorrents(ctx context.Context) ([]torrentInfo, error) {
+	resp, err := c.doGet(ctx, c.baseURL+"/api/v2/torrents/info")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list torrents: %w", err)
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list torrents: %w", unexpectedStatus(resp))
+	}
+
+	var torrents []torrentInfo
+	if err := json.NewDecoder(resp.Body).Decode(&torrents); err != nil {
+		return nil, fmt.Errorf("failed to decode torrent list: %w", err)
+	}
+	return torrents, nil
+}
+
+func (c *Client) reannounceBatch(ctx context.Context, hashes []string) error {
+	return c.postHashes(ctx, "/api/v2/torrents/reannounce", hashes)
+}
+
+// postHashes sends a torrents action for the given hashes, joined with "|".
+func (c *Client) postHashes(ctx context.Context, path string, hashes []string) error {
+	data := url.Values{}
+	data.Set("hashes", strings.Join(hashes, "|"))
+
+	resp, err := c.doPostForm(ctx, c.baseURL+path, data)
+	if err != nil {
+		return err
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return unexpectedStatus(resp)
+	}
+	return nil
+}
+
+// matchesFilter reports whether t is in one of the categories and carries
+// one of the tags. An empty list matches everything.
+func matchesFilter(categories, tags []string, t torrentInfo) bool {
+	if len(categories) > 0 && !slices.Contains(categories, t.Category) {
+		return false
+	}
+	if len(tags) > 0 {
+		for _, tag := range splitList(t.Tags) {
+			if slices.Contains(tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
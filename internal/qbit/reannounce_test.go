@@ -0,0 +1,191 @@
+package qbit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+func TestParseReannounceOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]string
+		want     *ReannounceOptions
+		wantErr  bool
+	}{
+		{name: "not set", settings: map[string]string{}, want: nil},
+		{name: "disabled", settings: map[string]string{"REANNOUNCE": "false"}, want: nil},
+		{
+			name:     "defaults",
+			settings: map[string]string{"REANNOUNCE": "true"},
+			want:     &ReannounceOptions{BatchSize: defaultReannounceBatchSize, Interval: defaultReannounceInterval},
+		},
+		{
+			name: "filters and rate limit",
+			settings: map[string]string{
+				"REANNOUNCE":            "true",
+				"REANNOUNCE_CATEGORIES": "tv, movies",
+				"REANNOUNCE_TAGS":       "private",
+				"REANNOUNCE_BATCH_SIZE": "25",
+				"REANNOUNCE_INTERVAL":   "0",
+			},
+			want: &ReannounceOptions{Categories: []string{"tv", "movies"}, Tags: []string{"private"}, BatchSize: 25},
+		},
+		{name: "invalid flag", settings: map[string]string{"REANNOUNCE": "maybe"}, wantErr: true},
+		{name: "invalid batch size", settings: map[string]string{"REANNOUNCE": "true", "REANNOUNCE_BATCH_SIZE": "0"}, wantErr: true},
+		{name: "invalid interval", settings: map[string]string{"REANNOUNCE": "true", "REANNOUNCE_INTERVAL": "-1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReannounceOptions(tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReannounceOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseReannounceOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+const testTorrentList = `[
+	{"hash":"a","category":"tv","tags":""},
+	{"hash":"b","category":"movies","tags":"private, seed"},
+	{"hash":"c","category":"tv","tags":"private"},
+	{"hash":"d","category":"","tags":"public"},
+	{"hash":"e","category":"tv","tags":"private"}
+]`
+
+// reannounceRoutes serve a fixed torrent list and record the hashes of each
+// reannounce request. failAfter rejects requests after that many batches when
+// positive.
+func reannounceRoutes(batches *[][]string, failAfter int) map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/api/v2/torrents/info": reply(testTorrentList),
+		"/api/v2/torrents/reannounce": func(w http.ResponseWriter, r *http.Request) {
+			if failAfter > 0 && len(*batches) >= failAfter {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			*batches = append(*batches, strings.Split(r.FormValue("hashes"), "|"))
+		},
+	}
+}
+
+func TestReannounce_Filters(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ReannounceOptions
+		want [][]string
+	}{
+		{name: "all torrents", opts: ReannounceOptions{}, want: [][]string{{"a", "b", "c", "d", "e"}}},
+		{name: "category", opts: ReannounceOptions{Categories: []string{"tv"}}, want: [][]string{{"a", "c", "e"}}},
+		{name: "tag", opts: ReannounceOptions{Tags: []string{"private"}}, want: [][]string{{"b", "c", "e"}}},
+		{
+			name: "category and tag",
+			opts: ReannounceOptions{Categories: []string{"tv"}, Tags: []string{"private"}},
+			want: [][]string{{"c", "e"}},
+		},
+		{name: "batched", opts: ReannounceOptions{BatchSize: 2}, want: [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batches [][]string
+			server := (&fakeQbit{routes: reannounceRoutes(&batches, 0)}).start(t)
+
+			client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			opts := tt.opts
+			client.SetReannounce(&opts)
+
+			count, err := client.Reannounce(context.Background())
+			if err != nil {
+				t.Fatalf("Reannounce() error = %v", err)
+			}
+			if !reflect.DeepEqual(batches, tt.want) {
+				t.Errorf("batches = %v, want %v", batches, tt.want)
+			}
+
+			want := 0
+			for _, batch := range tt.want {
+				want += len(batch)
+			}
+			if count != want {
+				t.Errorf("Reannounce() count = %d, want %d", count, want)
+			}
+		})
+	}
+}
+
+func TestReannounce_PartialFailure(t *testing.T) {
+	var batches [][]string
+	server := (&fakeQbit{routes: reannounceRoutes(&batches, 1)}).start(t)
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetReannounce(&ReannounceOptions{BatchSize: 2, Interval: 10 * time.Millisecond})
+
+	count, err := client.Reannounce(context.Background())
+	if torrent.KindOf(err) != torrent.KindUnexpectedResponse {
+		t.Fatalf("Reannounce() error = %v, want unexpected_response", err)
+	}
+	if count != 2 {
+		t.Errorf("Reannounce() count = %d, want 2 torrents from the first batch", count)
+	}
+}
+
+func TestReannounce_Forbidden(t *testing.T) {
+	// The session is accepted but listing torrents stays forbidden, even
+	// after logging in again.
+	server := (&fakeQbit{routes: map[string]http.HandlerFunc{
+		"/api/v2/torrents/info": replyStatus(http.StatusForbidden),
+	}}).start(t)
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetReannounce(&ReannounceOptions{})
+
+	_, err = client.Reannounce(context.Background())
+	if torrent.KindOf(err) != torrent.KindUnexpectedResponse {
+		t.Fatalf("Reannounce() error = %v, want unexpected_response", err)
+	}
+	var status *retry.StatusError
+	if !errors.As(err, &status) || status.Code != http.StatusForbidden {
+		t.Errorf("Reannounce() error = %v, want status 403", err)
+	}
+}
+
+func TestReannounce_Disabled(t *testing.T) {
+	var batches [][]string
+	server := (&fakeQbit{routes: reannounceRoutes(&batches, 0)}).start(t)
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if client.ReannounceEnabled() {
+		t.Error("ReannounceEnabled() = true, want false by default")
+	}
+	if count, err := client.Reannounce(context.Background()); err != nil || count != 0 {
+		t.Errorf("Reannounce() = %d, %v; want 0, nil", count, err)
+	}
+	if len(batches) != 0 {
+		t.Errorf("batches = %v, want none", batches)
+	}
+}
@@ -0,0 +1,136 @@
+package qbit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// sessionState is the on-disk form of the WebUI session cookies.
+type sessionState struct {
+	// URL is the WebUI the cookies were issued by; a stored session is
+	// ignored after the URL changes.
+	URL     string          `json:"url"`
+	Cookies []sessionCookie `json:"cookies"`
+}
+
+type sessionCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// resumeSession restores the stored session and checks it with a ping that
+// does not re-authenticate. A full login is only done when there is no stored
+// session or the WebUI rejects it.
+func (c *Client) resumeSession(ctx context.Context) error {
+	if c.sessionFile == "" {
+		return c.Login(ctx)
+	}
+
+	restored, err := c.restoreSession()
+	if err != nil {
+		slog.Warn("failed to restore qBittorrent session, logging in", "file", c.sessionFile, "error", err)
+		return c.Login(ctx)
+	}
+	if !restored {
+		return c.Login(ctx)
+	}
+
+	if err := c.ping(ctx, c.get); err != nil {
+		slog.Info("stored qBittorrent session rejected, logging in", "error", err)
+		return c.Login(ctx)
+	}
+
+	slog.Info("reusing stored qBittorrent session", "file", c.sessionFile)
+	return nil
+}
+
+// restoreSession loads the session file into the cookie jar. It reports false
+// when there is nothing to restore.
+func (c *Client) restoreSession() (bool, error) {
+	content, err := os.ReadFile(c.sessionFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var state sessionState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return false, fmt.Errorf("failed to decode session file: %w", err)
+	}
+	if state.URL != c.baseURL || len(state.Cookies) == 0 {
+		return false, nil
+	}
+
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return false, err
+	}
+	cookies := make([]*http.Cookie, 0, len(state.Cookies))
+	for _, cookie := range state.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value, Path: "/"})
+	}
+	c.client.Jar.SetCookies(u, cookies)
+	return true, nil
+}
+
+// saveSession writes the current session cookies after a successful login.
+// Failures are logged since the next start simply logs in again.
+func (c *Client) saveSession() {
+	if c.sessionFile == "" {
+		return
+	}
+
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return
+	}
+	state := sessionState{URL: c.baseURL}
+	for _, cookie := range c.client.Jar.Cookies(u) {
+		state.Cookies = append(state.Cookies, sessionCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	if err := writeSessionFile(c.sessionFile, state); err != nil {
+		slog.Warn("failed to save qBittorrent session", "file", c.sessionFile, "error", err)
+	}
+}
+
+// writeSessionFile replaces path atomically. The file is created with mode
+// 0600 because the SID grants full WebUI access.
+func writeSessionFile(path string, state sessionState) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".qbit-session-*.json")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := tmp.Chmod(0600); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
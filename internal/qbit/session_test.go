@@ -0,0 +1,115 @@
+package qbit
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newSessionQbit issues a new SID on each login and only accepts the SIDs it
+// holds, so tests can expire a session.
+func newSessionQbit(sessions map[string]bool) *fakeQbit {
+	return &fakeQbit{
+		appVersion: "v4.6.0",
+		sessions:   sessions,
+		routes:     map[string]http.HandlerFunc{"/api/v2/app/preferences": reply(`{"listen_port":6881}`)},
+	}
+}
+
+func TestSessionFile_ReusedAcrossClients(t *testing.T) {
+	fake := newSessionQbit(make(map[string]bool))
+	server := fake.start(t)
+	sessionFile := filepath.Join(t.TempDir(), "qbit", "session.json")
+	opts := Options{URL: server.URL, Username: "admin", Password: "admin", SessionFile: sessionFile}
+
+	if _, err := NewClientWithOptions(context.Background(), opts); err != nil {
+		t.Fatalf("NewClientWithOptions() error = %v", err)
+	}
+	info, err := os.Stat(sessionFile)
+	if err != nil {
+		t.Fatalf("session file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("session file mode = %v, want 0600", info.Mode().Perm())
+	}
+	content, _ := os.ReadFile(sessionFile)
+	if !strings.Contains(string(content), "sid-1") {
+		t.Errorf("session file = %s, want sid-1", content)
+	}
+
+	// A second client stands in for a restart.
+	client, err := NewClientWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("NewClientWithOptions() after restart error = %v", err)
+	}
+	if calls := fake.loginCalls(); calls != 1 {
+		t.Errorf("login calls = %d, want 1", calls)
+	}
+	if _, err := client.GetPort(context.Background()); err != nil {
+		t.Errorf("GetPort() with restored session error = %v", err)
+	}
+}
+
+func TestSessionFile_RejectedSessionLogsIn(t *testing.T) {
+	fake := newSessionQbit(make(map[string]bool))
+	server := fake.start(t)
+	sessionFile := filepath.Join(t.TempDir(), "session.json")
+	opts := Options{URL: server.URL, Username: "admin", Password: "admin", SessionFile: sessionFile}
+
+	if _, err := NewClientWithOptions(context.Background(), opts); err != nil {
+		t.Fatalf("NewClientWithOptions() error = %v", err)
+	}
+	fake.expire("sid-1")
+
+	if _, err := NewClientWithOptions(context.Background(), opts); err != nil {
+		t.Fatalf("NewClientWithOptions() after expiry error = %v", err)
+	}
+	if calls := fake.loginCalls(); calls != 2 {
+		t.Errorf("login calls = %d, want 2", calls)
+	}
+	content, _ := os.ReadFile(sessionFile)
+	if !strings.Contains(string(content), "sid-2") {
+		t.Errorf("session file = %s, want the new sid-2", content)
+	}
+}
+
+func TestSessionFile_IgnoredForOtherURL(t *testing.T) {
+	fake := newSessionQbit(make(map[string]bool))
+	server := fake.start(t)
+	sessionFile := filepath.Join(t.TempDir(), "session.json")
+	fake.sessions["sid-0"] = true
+	if err := writeSessionFile(sessionFile, sessionState{
+		URL:     "http://other:8080",
+		Cookies: []sessionCookie{{Name: "SID", Value: "sid-0"}},
+	}); err != nil {
+		t.Fatalf("writeSessionFile() error = %v", err)
+	}
+
+	opts := Options{URL: server.URL, Username: "admin", Password: "admin", SessionFile: sessionFile}
+	if _, err := NewClientWithOptions(context.Background(), opts); err != nil {
+		t.Fatalf("NewClientWithOptions() error = %v", err)
+	}
+	if calls := fake.loginCalls(); calls != 1 {
+		t.Errorf("login calls = %d, want 1", calls)
+	}
+}
+
+func TestSessionFile_CorruptFileLogsIn(t *testing.T) {
+	fake := newSessionQbit(make(map[string]bool))
+	server := fake.start(t)
+	sessionFile := filepath.Join(t.TempDir(), "session.json")
+	if err := os.WriteFile(sessionFile, []byte("{"), 0600); err != nil {
+		t.Fatalf("failed to write session file: %v", err)
+	}
+
+	opts := Options{URL: server.URL, Username: "admin", Password: "admin", SessionFile: sessionFile}
+	if _, err := NewClientWithOptions(context.Background(), opts); err != nil {
+		t.Fatalf("NewClientWithOptions() error = %v", err)
+	}
+	if calls := fake.loginCalls(); calls != 1 {
+		t.Errorf("login calls = %d, want 1", calls)
+	}
+}
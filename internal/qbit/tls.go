@@ -0,0 +1,130 @@
+package qbit
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TLSOptions configures HTTPS connections to the WebUI. The zero value uses
+// Go's default verification against the system roots.
+type TLSOptions struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+	// CertFile and KeyFile hold a client certificate for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// PinSHA256 is the hex SHA-256 fingerprint of the server's leaf
+	// certificate. Colons and case are ignored.
+	PinSHA256 string
+	// InsecureSkipVerify disables chain and hostname verification. A pin, if
+	// set, is still enforced.
+	InsecureSkipVerify bool
+}
+
+// TLSOptionsFromSettings reads the TLS_CA_FILE, TLS_CERT_FILE, TLS_KEY_FILE,
+// TLS_PIN_SHA256 and TLS_INSECURE_SKIP_VERIFY settings.
+func TLSOptionsFromSettings(settings map[string]string) (TLSOptions, error) {
+	opts := TLSOptions{
+		CAFile:    settings["TLS_CA_FILE"],
+		CertFile:  settings["TLS_CERT_FILE"],
+		KeyFile:   settings["TLS_KEY_FILE"],
+		PinSHA256: settings["TLS_PIN_SHA256"],
+	}
+
+	if value := settings["TLS_INSECURE_SKIP_VERIFY"]; value != "" {
+		skip, err := strconv.ParseBool(value)
+		if err != nil {
+			return TLSOptions{}, fmt.Errorf("invalid TLS_INSECURE_SKIP_VERIFY value %q: %w", value, err)
+		}
+		opts.InsecureSkipVerify = skip
+	}
+
+	return opts, nil
+}
+
+func (o TLSOptions) isZero() bool {
+	return o == TLSOptions{}
+}
+
+// config builds the tls.Config for the options, or nil for the zero value.
+func (o TLSOptions) config() (*tls.Config, error) {
+	if o.isZero() {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, errors.New("both a client certificate and key are required for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if o.PinSHA256 != "" {
+		pin, err := normalizeFingerprint(o.PinSHA256)
+		if err != nil {
+			return nil, err
+		}
+		// VerifyConnection also runs when InsecureSkipVerify is set, so the
+		// pin holds either way.
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if got := hex.EncodeToString(sum[:]); got != pin {
+				return fmt.Errorf("server certificate fingerprint %s does not match pinned %s", got, pin)
+			}
+			return nil
+		}
+	}
+
+	if o.InsecureSkipVerify {
+		if o.PinSHA256 == "" {
+			slog.Warn("TLS certificate verification is disabled for qBittorrent")
+		} else {
+			slog.Info("TLS chain verification disabled for qBittorrent, relying on the pinned certificate")
+		}
+	}
+
+	return cfg, nil
+}
+
+func normalizeFingerprint(fingerprint string) (string, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+	if decoded, err := hex.DecodeString(normalized); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint %q", fingerprint)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,197 @@
+package qbit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTLSQbitServer serves the fake WebUI over HTTPS, requiring a client
+// certificate signed by clientCAs when it is set.
+func newTLSQbitServer(t *testing.T, clientCAs *x509.CertPool) *httptest.Server {
+	t.Helper()
+	var config *tls.Config
+	if clientCAs != nil {
+		config = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	}
+	return (&fakeQbit{appVersion: "v4.6.0"}).startTLS(t, config)
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// writeServerCA writes the test server's certificate as a CA bundle.
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	return writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+}
+
+func serverFingerprint(server *httptest.Server) string {
+	sum := sha256.Sum256(server.Certificate().Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// newClientCertificate creates a self-signed client certificate and returns
+// its pool plus the certificate and key file paths.
+func newClientCertificate(t *testing.T) (*x509.CertPool, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "forwardarr"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool, writePEM(t, "client.pem", "CERTIFICATE", der), writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func TestTLSOptionsFromSettings(t *testing.T) {
+	opts, err := TLSOptionsFromSettings(map[string]string{
+		"TLS_CA_FILE":              "/certs/ca.pem",
+		"TLS_CERT_FILE":            "/certs/client.pem",
+		"TLS_KEY_FILE":             "/certs/client-key.pem",
+		"TLS_PIN_SHA256":           "AB:CD",
+		"TLS_INSECURE_SKIP_VERIFY": "true",
+	})
+	if err != nil {
+		t.Fatalf("TLSOptionsFromSettings() error = %v", err)
+	}
+	want := TLSOptions{
+		CAFile:             "/certs/ca.pem",
+		CertFile:           "/certs/client.pem",
+		KeyFile:            "/certs/client-key.pem",
+		PinSHA256:          "AB:CD",
+		InsecureSkipVerify: true,
+	}
+	if opts != want {
+		t.Errorf("TLSOptionsFromSettings() = %+v, want %+v", opts, want)
+	}
+
+	if _, err := TLSOptionsFromSettings(map[string]string{"TLS_INSECURE_SKIP_VERIFY": "sometimes"}); err == nil {
+		t.Error("expected error for invalid TLS_INSECURE_SKIP_VERIFY")
+	}
+}
+
+func TestNewClientWithOptions_TLS(t *testing.T) {
+	server := newTLSQbitServer(t, nil)
+	caFile := writeServerCA(t, server)
+	pin := serverFingerprint(server)
+	wrongPin := strings.Repeat("00", sha256.Size)
+
+	tests := []struct {
+		name    string
+		tls     TLSOptions
+		wantErr bool
+	}{
+		{name: "untrusted by default", tls: TLSOptions{}, wantErr: true},
+		{name: "custom CA", tls: TLSOptions{CAFile: caFile}},
+		{name: "custom CA with matching pin", tls: TLSOptions{CAFile: caFile, PinSHA256: pin}},
+		{name: "custom CA with wrong pin", tls: TLSOptions{CAFile: caFile, PinSHA256: wrongPin}, wantErr: true},
+		{name: "pin only with skip verify", tls: TLSOptions{InsecureSkipVerify: true, PinSHA256: strings.ToUpper(pin)}},
+		{name: "skip verify still enforces pin", tls: TLSOptions{InsecureSkipVerify: true, PinSHA256: wrongPin}, wantErr: true},
+		{name: "skip verify", tls: TLSOptions{InsecureSkipVerify: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClientWithOptions(context.Background(), Options{URL: server.URL, Username: "admin", Password: "admin", TLS: tt.tls})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewClientWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if err := client.Ping(context.Background()); err != nil {
+					t.Errorf("Ping() error = %v, want TLS options applied to ping", err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewClientWithOptions_MutualTLS(t *testing.T) {
+	clientCAs, certFile, keyFile := newClientCertificate(t)
+	server := newTLSQbitServer(t, clientCAs)
+	caFile := writeServerCA(t, server)
+
+	if _, err := NewClientWithOptions(context.Background(), Options{URL: server.URL, TLS: TLSOptions{CAFile: caFile}}); err == nil {
+		t.Error("NewClientWithOptions() without client certificate error = nil, want error")
+	}
+
+	client, err := NewClientWithOptions(context.Background(), Options{
+		URL: server.URL,
+		TLS: TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+	})
+	if err != nil {
+		t.Fatalf("NewClientWithOptions() error = %v", err)
+	}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}
+
+func TestTLSOptionsConfig_Invalid(t *testing.T) {
+	emptyCA := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(emptyCA, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts TLSOptions
+	}{
+		{name: "missing CA file", opts: TLSOptions{CAFile: "/nonexistent/ca.pem"}},
+		{name: "CA file without certificates", opts: TLSOptions{CAFile: emptyCA}},
+		{name: "certificate without key", opts: TLSOptions{CertFile: "/certs/client.pem"}},
+		{name: "unreadable key pair", opts: TLSOptions{CertFile: emptyCA, KeyFile: emptyCA}},
+		{name: "malformed pin", opts: TLSOptions{PinSHA256: "abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.opts.config(); err == nil {
+				t.Error("config() error = nil, want error")
+			}
+		})
+	}
+}
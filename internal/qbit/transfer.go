@@ -0,0 +1,38 @@
+package qbit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// ConnectionStatus reads connection_status and dht_nodes from
+// /api/v2/transfer/info. It is polled on every sync, so it does not retry.
+func (c *Client) ConnectionStatus(ctx context.Context) (torrent.ConnectionInfo, error) {
+	resp, err := c.doGet(ctx, c.baseURL+"/api/v2/transfer/info")
+	if err != nil {
+		return torrent.ConnectionInfo{}, fmt.Errorf("failed to get transfer info: %w", err)
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return torrent.ConnectionInfo{}, torrent.NewError(torrent.KindUnexpectedResponse,
+			fmt.Errorf("unexpected status code from %s: %d, body: %s", c.describeVersion(), resp.StatusCode, string(body)))
+	}
+
+	var info struct {
+		ConnectionStatus string `json:"connection_status"`
+		DHTNodes         int    `json:"dht_nodes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return torrent.ConnectionInfo{}, torrent.NewError(torrent.KindUnexpectedResponse,
+			fmt.Errorf("failed to decode transfer info: %w", err))
+	}
+
+	return torrent.ConnectionInfo{Status: info.ConnectionStatus, DHTNodes: info.DHTNodes}, nil
+}
@@ -0,0 +1,65 @@
+package qbit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+func TestConnectionStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		want     torrent.ConnectionInfo
+		wantErr  bool
+		wantKind torrent.ErrorKind
+	}{
+		{
+			name:   "firewalled",
+			status: http.StatusOK,
+			body:   `{"connection_status":"firewalled","dht_nodes":312,"dl_info_speed":0}`,
+			want:   torrent.ConnectionInfo{Status: torrent.ConnectionFirewalled, DHTNodes: 312},
+		},
+		{
+			name:   "connected",
+			status: http.StatusOK,
+			body:   `{"connection_status":"connected","dht_nodes":0}`,
+			want:   torrent.ConnectionInfo{Status: torrent.ConnectionConnected},
+		},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true, wantKind: torrent.KindUnexpectedResponse},
+		{name: "invalid json", status: http.StatusOK, body: "{", wantErr: true, wantKind: torrent.KindUnexpectedResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := (&fakeQbit{routes: map[string]http.HandlerFunc{
+				"/api/v2/transfer/info": func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(tt.status)
+					_, _ = w.Write([]byte(tt.body))
+				},
+			}}).start(t)
+
+			client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			got, err := client.ConnectionStatus(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConnectionStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if torrent.KindOf(err) != tt.wantKind {
+					t.Errorf("KindOf() = %q, want %q", torrent.KindOf(err), tt.wantKind)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ConnectionStatus() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package qbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+var (
+	// minAPIVersion is the first WebAPI v2 release, shipped with qBittorrent 4.1.
+	minAPIVersion = apiVersion{major: 2}
+	// reannounceAPIVersion added /api/v2/torrents/reannounce (qBittorrent 4.1.5).
+	reannounceAPIVersion = apiVersion{major: 2, minor: 0, patch: 2}
+	// stopStartAPIVersion renamed pause/resume to stop/start (qBittorrent 5.0).
+	stopStartAPIVersion = apiVersion{major: 2, minor: 11}
+)
+
+// apiVersion is a WebAPI version as reported by /api/v2/app/webapiVersion.
+type apiVersion struct {
+	major, minor, patch int
+}
+
+// parseAPIVersion accepts "2.9" and "2.9.3".
+func parseAPIVersion(s string) (apiVersion, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return apiVersion{}, fmt.Errorf("invalid WebAPI version %q", s)
+	}
+
+	var nums [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return apiVersion{}, fmt.Errorf("invalid WebAPI version %q", s)
+		}
+		nums[i] = n
+	}
+	return apiVersion{major: nums[0], minor: nums[1], patch: nums[2]}, nil
+}
+
+func (v apiVersion) atLeast(other apiVersion) bool {
+	if v.major != other.major {
+		return v.major > other.major
+	}
+	if v.minor != other.minor {
+		return v.minor > other.minor
+	}
+	return v.patch >= other.patch
+}
+
+func (v apiVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// compat holds the request shapes that differ between WebAPI versions.
+type compat struct {
+	// reannounce is false before the reannounce endpoint existed.
+	reannounce bool
+	// stopPath and startPath pause and resume torrents.
+	stopPath  string
+	startPath string
+}
+
+// defaultCompat is used until a version has been detected. It assumes a 4.x
+// WebUI, which is still the most widely deployed.
+var defaultCompat = compat{
+	reannounce: true,
+	stopPath:   "/api/v2/torrents/pause",
+	startPath:  "/api/v2/torrents/resume",
+}
+
+func compatFor(v apiVersion) compat {
+	c := defaultCompat
+	c.reannounce = v.atLeast(reannounceAPIVersion)
+	if v.atLeast(stopStartAPIVersion) {
+		c.stopPath = "/api/v2/torrents/stop"
+		c.startPath = "/api/v2/torrents/start"
+	}
+	return c
+}
+
+// Version returns the qBittorrent and WebAPI versions detected at connect
+// time, or empty strings when detection failed.
+func (c *Client) Version() (string, string) {
+	c.versionMu.RLock()
+	defer c.versionMu.RUnlock()
+	return c.appVersion, c.apiVersion
+}
+
+func (c *Client) currentCompat() compat {
+	c.versionMu.RLock()
+	defer c.versionMu.RUnlock()
+	return c.compat
+}
+
+// describeVersion names the detected versions for error messages.
+func (c *Client) describeVersion() string {
+	app, api := c.Version()
+	if api == "" {
+		return "unknown qBittorrent version"
+	}
+	if app == "" {
+		return "qBittorrent WebAPI " + api
+	}
+	return fmt.Sprintf("qBittorrent %s (WebAPI %s)", app, api)
+}
+
+// detectVersion reads the application and WebAPI versions and selects the
+// matching request shapes. Only a WebAPI older than v2 is an error; when the
+// versions cannot be read the defaults are kept and a warning is logged.
+func (c *Client) detectVersion(ctx context.Context) error {
+	rawAPI, err := c.getText(ctx, "/api/v2/app/webapiVersion")
+	if err != nil {
+		slog.Warn("failed to detect qBittorrent WebAPI version, assuming defaults", "error", err)
+		return nil
+	}
+	parsed, err := parseAPIVersion(rawAPI)
+	if err != nil {
+		slog.Warn("failed to parse qBittorrent WebAPI version, assuming defaults", "error", err)
+		return nil
+	}
+	if !parsed.atLeast(minAPIVersion) {
+		return torrent.NewError(torrent.KindUnexpectedResponse,
+			fmt.Errorf("qBittorrent WebAPI %s is not supported; qBittorrent 4.1 or newer is required", rawAPI))
+	}
+	if parsed.major > minAPIVersion.major {
+		slog.Warn("qBittorrent WebAPI major version is newer than supported, requests may fail", "api_version", rawAPI)
+	}
+
+	rawApp, err := c.getText(ctx, "/api/v2/app/version")
+	if err != nil {
+		slog.Warn("failed to read qBittorrent version", "error", err)
+	}
+
+	c.versionMu.Lock()
+	changed := c.apiVersion != rawAPI || c.appVersion != rawApp
+	c.appVersion = rawApp
+	c.apiVersion = rawAPI
+	c.compat = compatFor(parsed)
+	c.versionMu.Unlock()
+
+	if changed {
+		slog.Info("detected qBittorrent version", "version", rawApp, "api_version", rawAPI)
+	}
+	return nil
+}
+
+// getText fetches a plain-text endpoint. It does not re-authenticate on 403
+// because it also runs from within reauthenticate.
+func (c *Client) getText(ctx context.Context, path string) (string, error) {
+	resp, err := c.get(ctx, c.baseURL+path)
+	if err != nil {
+		return "", torrent.NewError(torrent.KindUnreachable, fmt.Errorf("request to %s failed: %w", path, err))
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s response: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", torrent.NewError(torrent.KindUnexpectedResponse,
+			fmt.Errorf("unexpected status code from %s: %d", path, resp.StatusCode))
+	}
+
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		return "", torrent.NewError(torrent.KindUnexpectedResponse, errors.New("empty response from "+path))
+	}
+	return text, nil
+}
@@ -0,0 +1,155 @@
+package qbit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+func TestParseAPIVersion(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    apiVersion
+		wantErr bool
+	}{
+		{input: "2.9.3", want: apiVersion{major: 2, minor: 9, patch: 3}},
+		{input: " 2.11 ", want: apiVersion{major: 2, minor: 11}},
+		{input: "1.0", want: apiVersion{major: 1}},
+		{input: "2", wantErr: true},
+		{input: "2.x.1", wantErr: true},
+		{input: "2.1.1.1", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseAPIVersion(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAPIVersion(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAPIVersion(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCompatFor(t *testing.T) {
+	tests := []struct {
+		version    apiVersion
+		reannounce bool
+		stopPath   string
+	}{
+		{version: apiVersion{major: 2}, reannounce: false, stopPath: "/api/v2/torrents/pause"},
+		{version: apiVersion{major: 2, patch: 2}, reannounce: true, stopPath: "/api/v2/torrents/pause"},
+		{version: apiVersion{major: 2, minor: 9, patch: 3}, reannounce: true, stopPath: "/api/v2/torrents/pause"},
+		{version: apiVersion{major: 2, minor: 11}, reannounce: true, stopPath: "/api/v2/torrents/stop"},
+	}
+
+	for _, tt := range tests {
+		got := compatFor(tt.version)
+		if got.reannounce != tt.reannounce || got.stopPath != tt.stopPath {
+			t.Errorf("compatFor(%s) = %+v, want reannounce %v and stop path %s", tt.version, got, tt.reannounce, tt.stopPath)
+		}
+	}
+}
+
+// newVersionedServer serves a WebUI reporting the given versions and
+// preferences. The login endpoint answers with loginStatus.
+func newVersionedServer(t *testing.T, appVersion, apiVersion string, loginStatus int, prefs string) *httptest.Server {
+	t.Helper()
+	return (&fakeQbit{
+		appVersion:  appVersion,
+		apiVersion:  apiVersion,
+		loginStatus: loginStatus,
+		routes:      map[string]http.HandlerFunc{"/api/v2/app/preferences": reply(prefs)},
+	}).start(t)
+}
+
+func TestNewClient_DetectsVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		appVersion  string
+		apiVersion  string
+		loginStatus int
+		stopPath    string
+	}{
+		{name: "qBittorrent 4.6", appVersion: "v4.6.3", apiVersion: "2.9.3", loginStatus: http.StatusOK, stopPath: "/api/v2/torrents/pause"},
+		{name: "qBittorrent 5.0", appVersion: "v5.0.2", apiVersion: "2.11.2", loginStatus: http.StatusOK, stopPath: "/api/v2/torrents/stop"},
+		{name: "login without body", appVersion: "v5.1.0", apiVersion: "2.11.4", loginStatus: http.StatusNoContent, stopPath: "/api/v2/torrents/stop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newVersionedServer(t, tt.appVersion, tt.apiVersion, tt.loginStatus, `{"listen_port":6881}`)
+
+			client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			app, api := client.Version()
+			if app != tt.appVersion || api != tt.apiVersion {
+				t.Errorf("Version() = %q, %q, want %q, %q", app, api, tt.appVersion, tt.apiVersion)
+			}
+			if got := client.currentCompat().stopPath; got != tt.stopPath {
+				t.Errorf("stop path = %q, want %q", got, tt.stopPath)
+			}
+		})
+	}
+}
+
+func TestNewClient_UnsupportedVersion(t *testing.T) {
+	server := newVersionedServer(t, "v4.0.4", "1.9", http.StatusOK, `{"listen_port":6881}`)
+
+	_, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("NewClient() error = %v, want unsupported version error", err)
+	}
+	if torrent.KindOf(err) != torrent.KindUnexpectedResponse {
+		t.Errorf("KindOf() = %q, want unexpected_response", torrent.KindOf(err))
+	}
+}
+
+func TestNewClient_LoginNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err == nil || !strings.Contains(err.Error(), "WebAPI v2 not found") {
+		t.Fatalf("NewClient() error = %v, want WebAPI v2 not found", err)
+	}
+}
+
+func TestGetPort_MissingListenPortNamesVersion(t *testing.T) {
+	server := newVersionedServer(t, "v9.0.0", "2.99.0", http.StatusOK, `{"session_port":6881}`)
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3})
+
+	_, err = client.GetPort(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "qBittorrent v9.0.0 (WebAPI 2.99.0) have no listen_port") {
+		t.Errorf("GetPort() error = %v, want missing listen_port naming the version", err)
+	}
+}
+
+func TestReannounce_UnsupportedVersion(t *testing.T) {
+	server := newVersionedServer(t, "v4.1.0", "2.0", http.StatusOK, `{"listen_port":6881}`)
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetReannounce(&ReannounceOptions{BatchSize: defaultReannounceBatchSize})
+
+	if _, err := client.Reannounce(context.Background()); err == nil || !strings.Contains(err.Error(), "4.1.5 or newer") {
+		t.Errorf("Reannounce() error = %v, want version requirement", err)
+	}
+}
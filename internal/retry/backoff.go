@@ -1,8 +1,11 @@
-package main
+package retry
 
 import "time"
 
-func exponentialBackoffDelay(attempt int, base, remaining time.Duration) time.Duration {
+// ExponentialBackoff doubles base for every attempt after the first and caps
+// the result at remaining, the time left before a deadline. It returns 0 for
+// invalid input.
+func ExponentialBackoff(attempt int, base, remaining time.Duration) time.Duration {
 	if attempt < 1 || base <= 0 || remaining <= 0 {
 		return 0
 	}
@@ -24,7 +27,9 @@ func exponentialBackoffDelay(attempt int, base, remaining time.Duration) time.Du
 	return delay
 }
 
-func calculateMaxAttempts(baseDelay, timeout time.Duration) int {
+// MaxAttempts reports how many attempts fit into timeout when waiting
+// ExponentialBackoff between them.
+func MaxAttempts(baseDelay, timeout time.Duration) int {
 	if baseDelay <= 0 || timeout <= 0 {
 		return 1
 	}
@@ -32,7 +37,7 @@ func calculateMaxAttempts(baseDelay, timeout time.Duration) int {
 	attempts := 1
 	remaining := timeout
 	for {
-		sleep := exponentialBackoffDelay(attempts, baseDelay, remaining)
+		sleep := ExponentialBackoff(attempts, baseDelay, remaining)
 		if sleep <= 0 || sleep >= remaining {
 			return attempts
 		}
@@ -1,11 +1,11 @@
-package main
+package retry
 
 import (
 	"testing"
 	"time"
 )
 
-func TestExponentialBackoffDelay(t *testing.T) {
+func TestExponentialBackoff(t *testing.T) {
 	base := 5 * time.Second
 
 	tests := []struct {
@@ -82,15 +82,15 @@ func TestExponentialBackoffDelay(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := exponentialBackoffDelay(tt.attempt, tt.base, tt.remaining)
+			got := ExponentialBackoff(tt.attempt, tt.base, tt.remaining)
 			if got != tt.want {
-				t.Errorf("exponentialBackoffDelay() = %s, want %s", got, tt.want)
+				t.Errorf("ExponentialBackoff() = %s, want %s", got, tt.want)
 			}
 		})
 	}
 }
 
-func TestCalculateMaxAttempts(t *testing.T) {
+func TestMaxAttempts(t *testing.T) {
 	base := 5 * time.Second
 
 	tests := []struct {
@@ -139,9 +139,9 @@ func TestCalculateMaxAttempts(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := calculateMaxAttempts(tt.base, tt.timeout)
+			got := MaxAttempts(tt.base, tt.timeout)
 			if got != tt.want {
-				t.Errorf("calculateMaxAttempts() = %d, want %d", got, tt.want)
+				t.Errorf("MaxAttempts() = %d, want %d", got, tt.want)
 			}
 		})
 	}
@@ -0,0 +1,156 @@
+// Package retry holds the retry policy shared by the client backends and
+// webhook delivery.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy describes how often and how long to wait before repeating a failed
+// request.
+type Policy struct {
+	// Attempts is the total number of tries including the first; values
+	// below 1 mean a single try.
+	Attempts int
+	// BaseDelay is the wait after the first failure.
+	BaseDelay time.Duration
+	// MaxDelay caps each wait; zero leaves it uncapped.
+	MaxDelay time.Duration
+	// Factor multiplies the wait after every further failure; values below
+	// 1 keep it constant.
+	Factor float64
+	// Jitter picks each wait uniformly between zero and the computed delay
+	// ("full jitter"), so clients that failed together do not retry together.
+	Jitter bool
+	// Retryable decides which errors are worth another try; nil uses
+	// IsRetryable.
+	Retryable func(error) bool
+}
+
+// DefaultPolicy tries three times, waiting up to 2s and then 4s.
+func DefaultPolicy() Policy {
+	return Policy{
+		Attempts:  3,
+		BaseDelay: 2 * time.Second,
+		MaxDelay:  30 * time.Second,
+		Factor:    2,
+		Jitter:    true,
+	}
+}
+
+// Validate rejects settings that cannot be meant seriously.
+func (p Policy) Validate() error {
+	switch {
+	case p.Attempts < 1:
+		return fmt.Errorf("retry attempts must be at least 1, got %d", p.Attempts)
+	case p.BaseDelay < 0 || p.MaxDelay < 0:
+		return errors.New("retry delays must not be negative")
+	case p.MaxDelay > 0 && p.MaxDelay < p.BaseDelay:
+		return fmt.Errorf("retry max delay %s is shorter than the base delay %s", p.MaxDelay, p.BaseDelay)
+	case p.Factor < 1:
+		return fmt.Errorf("retry factor must be at least 1, got %g", p.Factor)
+	}
+	return nil
+}
+
+// Delay returns the wait after the given failed attempt, counting from 1,
+// before jitter is applied.
+func (p Policy) Delay(attempt int) time.Duration {
+	if attempt < 1 || p.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := float64(p.BaseDelay) * math.Pow(max(p.Factor, 1), float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
+
+func (p Policy) wait(attempt int) time.Duration {
+	delay := p.Delay(attempt)
+	if !p.Jitter || delay <= 0 {
+		return delay
+	}
+	return time.Duration(rand.Int64N(int64(delay) + 1))
+}
+
+func (p Policy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// Do calls fn until it succeeds, fails with an error the policy does not
+// retry, or runs out of attempts. Retries are logged with op. It returns the
+// number of attempts made and the last error; when ctx is cancelled during a
+// wait the error is ctx.Err().
+func (p Policy) Do(ctx context.Context, op string, fn func(ctx context.Context) error) (int, error) {
+	attempts := max(p.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return attempt, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil || !p.retryable(err) {
+			return attempt, err
+		}
+
+		delay := p.wait(attempt)
+		slog.Warn(op+" failed, retrying",
+			"attempt", attempt,
+			"max_attempts", attempts,
+			"retry_delay", delay,
+			"error", err,
+		)
+		if err := Sleep(ctx, delay); err != nil {
+			return attempt, err
+		}
+	}
+}
+
+// StatusError is an unexpected HTTP status code. 4xx responses are not
+// retried because repeating the same request cannot fix them.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.Code)
+	}
+	return fmt.Sprintf("unexpected status code: %d, body: %s", e.Code, e.Body)
+}
+
+// IsRetryable is the default classification. Network failures, 5xx responses
+// and unclassified errors are retried. 4xx responses, cancellation and errors
+// with a Permanent() method that returns true, such as rejected credentials,
+// are not.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var permanent interface{ Permanent() bool }
+	if errors.As(err, &permanent) && permanent.Permanent() {
+		return false
+	}
+
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code < 400 || status.Code >= 500
+	}
+
+	return true
+}
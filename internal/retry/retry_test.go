@@ -0,0 +1,162 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type permanentError struct{}
+
+func (permanentError) Error() string   { return "rejected" }
+func (permanentError) Permanent() bool { return true }
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, Factor: 2}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 0},
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 4, want: 8 * time.Second},
+		{attempt: 5, want: 10 * time.Second},
+		{attempt: 200, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	constant := Policy{BaseDelay: time.Second}
+	if got := constant.Delay(3); got != time.Second {
+		t.Errorf("Delay(3) without factor = %v, want 1s", got)
+	}
+}
+
+func TestPolicyWaitJitter(t *testing.T) {
+	policy := Policy{BaseDelay: 100 * time.Millisecond, Factor: 2, Jitter: true}
+	for range 100 {
+		if got := policy.wait(2); got < 0 || got > 200*time.Millisecond {
+			t.Fatalf("wait(2) = %v, want within [0, 200ms]", got)
+		}
+	}
+
+	policy.Jitter = false
+	if got := policy.wait(2); got != 200*time.Millisecond {
+		t.Errorf("wait(2) without jitter = %v, want 200ms", got)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "default", policy: DefaultPolicy()},
+		{name: "no attempts", policy: Policy{Attempts: 0, Factor: 1}, wantErr: true},
+		{name: "negative delay", policy: Policy{Attempts: 1, BaseDelay: -time.Second, Factor: 1}, wantErr: true},
+		{name: "max below base", policy: Policy{Attempts: 1, BaseDelay: 2 * time.Second, MaxDelay: time.Second, Factor: 1}, wantErr: true},
+		{name: "shrinking factor", policy: Policy{Attempts: 1, Factor: 0.5}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int
+	}{
+		{name: "success", err: nil, wantAttempts: 1},
+		{name: "network error", err: errors.New("connection refused"), wantAttempts: 3},
+		{name: "server error", err: &StatusError{Code: 503}, wantAttempts: 3},
+		{name: "client error", err: fmt.Errorf("set port: %w", &StatusError{Code: 400}), wantAttempts: 1},
+		{name: "permanent error", err: fmt.Errorf("login: %w", permanentError{}), wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			policy := Policy{Attempts: 3, BaseDelay: time.Millisecond}
+			attempts, err := policy.Do(context.Background(), "test", func(ctx context.Context) error {
+				calls++
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Do() error = %v, want %v", err, tt.err)
+			}
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts {
+				t.Errorf("Do() attempts = %d, calls = %d, want %d", attempts, calls, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPolicyDo_CustomRetryable(t *testing.T) {
+	calls := 0
+	policy := Policy{Attempts: 3, Retryable: func(error) bool { return false }}
+	_, _ = policy.Do(context.Background(), "test", func(ctx context.Context) error {
+		calls++
+		return errors.New("failed")
+	})
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestPolicyDo_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	policy := Policy{Attempts: 5, BaseDelay: time.Minute}
+	start := time.Now()
+	attempts, err := policy.Do(ctx, "test", func(ctx context.Context) error {
+		return errors.New("failed")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want context.Canceled", err)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Do() took %v after cancellation", elapsed)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "deadline", err: context.DeadlineExceeded, want: true},
+		{name: "unclassified", err: errors.New("EOF"), want: true},
+		{name: "500", err: &StatusError{Code: 500}, want: true},
+		{name: "404", err: &StatusError{Code: 404}, want: false},
+		{name: "permanent", err: permanentError{}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package retry
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep waits for d between retries. It returns ctx.Err() early when ctx is
+// cancelled, so shutdown does not wait out a backoff.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,269 @@
+package rtorrent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// ClientType selects the rTorrent XML-RPC backend, reached over HTTP or SCGI.
+const ClientType = "rtorrent"
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+)
+
+// transport carries one encoded XML-RPC request and returns the raw response.
+type transport interface {
+	roundTrip(ctx context.Context, body []byte) ([]byte, error)
+}
+
+// Client drives rTorrent through XML-RPC, either over SCGI or through an
+// HTTP endpoint such as ruTorrent's /RPC2.
+type Client struct {
+	transport transport
+	retry     retry.Policy
+}
+
+var _ torrent.Client = (*Client)(nil)
+
+func init() {
+	torrent.Register(ClientType, func(ctx context.Context, opts torrent.Options) (torrent.Client, error) {
+		client, err := NewClient(ctx, opts.URL, opts.Username, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Retry.Attempts > 0 {
+			client.SetRetryPolicy(opts.Retry)
+		}
+		return client, nil
+	})
+}
+
+// NewClient creates an rTorrent client and checks that it responds. Supported
+// addresses are scgi://host:port, scgi:///path/to/socket (or unix:///path)
+// and http(s):// XML-RPC endpoints, which may use basic auth.
+func NewClient(ctx context.Context, address, user, pass string) (*Client, error) {
+	t, err := newTransport(address, user, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{transport: t, retry: retry.DefaultPolicy()}
+	if err := client.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("initial connection failed: %w", err)
+	}
+
+	return client, nil
+}
+
+func newTransport(address, user, pass string) (transport, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rTorrent address: %w", err)
+	}
+
+	switch u.Scheme {
+	case "scgi":
+		if u.Host == "" {
+			if u.Path == "" {
+				return nil, fmt.Errorf("invalid rTorrent address %q: missing host or socket path", address)
+			}
+			return &scgiTransport{network: "unix", address: u.Path, timeout: defaultHTTPTimeout}, nil
+		}
+		return &scgiTransport{network: "tcp", address: u.Host, timeout: defaultHTTPTimeout}, nil
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid rTorrent address %q: missing socket path", address)
+		}
+		return &scgiTransport{network: "unix", address: u.Path, timeout: defaultHTTPTimeout}, nil
+	case "http", "https":
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/RPC2"
+		}
+		return &httpTransport{
+			url:    u.String(),
+			user:   user,
+			pass:   pass,
+			client: &http.Client{Timeout: defaultHTTPTimeout},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported rTorrent address scheme %q (use scgi, unix, http or https)", u.Scheme)
+	}
+}
+
+func (c *Client) Name() string {
+	return ClientType
+}
+
+// SetRetryPolicy replaces the policy for the network.port_range and
+// network.port_random calls behind GetPort and SetPort.
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retry = policy
+}
+
+// GetPort returns the listening port, or 0 when rTorrent is configured with a
+// port range or a random port, so the watcher treats it as out of sync.
+func (c *Client) GetPort(ctx context.Context) (int, error) {
+	var port int
+	attempts, err := c.retry.Do(ctx, "get port", func(ctx context.Context) error {
+		var err error
+		port, err = c.getPort(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get port range after %d attempts: %w", attempts, err)
+	}
+	return port, nil
+}
+
+func (c *Client) getPort(ctx context.Context) (int, error) {
+	value, err := c.call(ctx, "network.port_range", "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get port range: %w", err)
+	}
+	portRange, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected network.port_range value %v", value)
+	}
+	low, high, err := parsePortRange(portRange)
+	if err != nil {
+		return 0, err
+	}
+
+	random, err := c.call(ctx, "network.port_random", "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get port random setting: %w", err)
+	}
+	if isTrue(random) || low != high {
+		return 0, nil
+	}
+
+	return low, nil
+}
+
+func (c *Client) SetPort(ctx context.Context, port int) error {
+	portRange := fmt.Sprintf("%d-%d", port, port)
+
+	attempts, err := c.retry.Do(ctx, "set port", func(ctx context.Context) error {
+		return c.setPort(ctx, portRange)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set rTorrent port after %d attempts: %w", attempts, err)
+	}
+
+	slog.Info("successfully updated rTorrent port range", "port", port)
+	return nil
+}
+
+func (c *Client) setPort(ctx context.Context, portRange string) error {
+	if _, err := c.call(ctx, "network.port_range.set", "", portRange); err != nil {
+		return fmt.Errorf("failed to set port range: %w", err)
+	}
+	if _, err := c.call(ctx, "network.port_random.set", "", 0); err != nil {
+		return fmt.Errorf("failed to disable random port: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	if _, err := c.call(ctx, "system.client_version"); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) call(ctx context.Context, method string, params ...any) (any, error) {
+	body, err := encodeCall(method, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", method, err)
+	}
+
+	respBody, err := c.transport.roundTrip(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeResponse(bytes.NewReader(respBody))
+}
+
+func parsePortRange(portRange string) (int, int, error) {
+	lowStr, highStr, found := strings.Cut(strings.TrimSpace(portRange), "-")
+	if !found {
+		highStr = lowStr
+	}
+
+	low, err := strconv.Atoi(strings.TrimSpace(lowStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", portRange, err)
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(highStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", portRange, err)
+	}
+	return low, high, nil
+}
+
+// isTrue interprets rTorrent's boolean-ish values, which are usually integers.
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case string:
+		return v == "1" || strings.EqualFold(v, "yes") || strings.EqualFold(v, "true")
+	default:
+		return false
+	}
+}
+
+// httpTransport posts XML-RPC requests to an HTTP endpoint, e.g. ruTorrent's
+// plugins/httprpc or a web server proxying /RPC2.
+type httpTransport struct {
+	url    string
+	user   string
+	pass   string
+	client *http.Client
+}
+
+func (t *httpTransport) roundTrip(ctx context.Context, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if t.user != "" || t.pass != "" {
+		req.SetBasicAuth(t.user, t.pass)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, torrent.NewError(torrent.KindBadCredentials, errors.New("rTorrent endpoint rejected credentials (401)"))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &retry.StatusError{Code: resp.StatusCode, Body: string(respBody)}
+	}
+
+	return respBody, nil
+}
@@ -0,0 +1,286 @@
+package rtorrent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// fakeRTorrent keeps the state of the few commands forwardarr uses.
+type fakeRTorrent struct {
+	mu         gosync.Mutex
+	portRange  string
+	portRandom int
+	calls      []string
+	failSet    int
+}
+
+type methodCall struct {
+	Method string   `xml:"methodName"`
+	Params []string `xml:"params>param>value>string"`
+	Ints   []string `xml:"params>param>value>i8"`
+}
+
+func (f *fakeRTorrent) handle(body []byte) string {
+	var call methodCall
+	if err := xml.Unmarshal(body, &call); err != nil {
+		return faultResponse(-501, err.Error())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call.Method)
+
+	switch call.Method {
+	case "system.client_version":
+		return valueResponse("<string>0.9.8</string>")
+	case "network.port_range":
+		return valueResponse("<string>" + f.portRange + "</string>")
+	case "network.port_random":
+		return valueResponse(fmt.Sprintf("<i8>%d</i8>", f.portRandom))
+	case "network.port_range.set":
+		if f.failSet > 0 {
+			f.failSet--
+			return faultResponse(-503, "busy")
+		}
+		if len(call.Params) != 2 || call.Params[0] != "" {
+			return faultResponse(-501, "bad params")
+		}
+		f.portRange = call.Params[1]
+		return valueResponse("<i8>0</i8>")
+	case "network.port_random.set":
+		if len(call.Params) != 1 || len(call.Ints) != 1 {
+			return faultResponse(-501, "bad params")
+		}
+		random, _ := strconv.Atoi(call.Ints[0])
+		f.portRandom = random
+		return valueResponse("<i8>0</i8>")
+	default:
+		return faultResponse(-506, "Method '"+call.Method+"' not defined")
+	}
+}
+
+func valueResponse(value string) string {
+	return `<?xml version="1.0"?><methodResponse><params><param><value>` + value + `</value></param></params></methodResponse>`
+}
+
+func faultResponse(code int, msg string) string {
+	return fmt.Sprintf(`<?xml version="1.0"?><methodResponse><fault><value><struct>`+
+		`<member><name>faultCode</name><value><i4>%d</i4></value></member>`+
+		`<member><name>faultString</name><value><string>%s</string></value></member>`+
+		`</struct></value></fault></methodResponse>`, code, msg)
+}
+
+// serveSCGI answers SCGI requests on listener until it is closed.
+func (f *fakeRTorrent) serveSCGI(t *testing.T, listener net.Listener) {
+	t.Helper()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer func() { _ = conn.Close() }()
+			reader := bufio.NewReader(conn)
+
+			lengthStr, err := reader.ReadString(':')
+			if err != nil {
+				t.Errorf("failed to read netstring length: %v", err)
+				return
+			}
+			length, _ := strconv.Atoi(strings.TrimSuffix(lengthStr, ":"))
+			header := make([]byte, length+1)
+			if _, err := io.ReadFull(reader, header); err != nil {
+				t.Errorf("failed to read scgi headers: %v", err)
+				return
+			}
+
+			fields := bytes.Split(header[:length], []byte{0})
+			if string(fields[0]) != "CONTENT_LENGTH" {
+				t.Errorf("first scgi header = %q, want CONTENT_LENGTH", fields[0])
+			}
+			contentLength, _ := strconv.Atoi(string(fields[1]))
+			body := make([]byte, contentLength)
+			if _, err := io.ReadFull(reader, body); err != nil {
+				t.Errorf("failed to read scgi body: %v", err)
+				return
+			}
+
+			resp := f.handle(body)
+			_, _ = fmt.Fprintf(conn, "Status: 200 OK\r\nContent-Type: text/xml\r\nContent-Length: %d\r\n\r\n%s", len(resp), resp)
+		}(conn)
+	}
+}
+
+func newSCGIServer(t *testing.T, network, address string) (*fakeRTorrent, net.Listener) {
+	t.Helper()
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	fake := &fakeRTorrent{portRange: "6881-6999", portRandom: 1}
+	go fake.serveSCGI(t, listener)
+	t.Cleanup(func() { _ = listener.Close() })
+	return fake, listener
+}
+
+func TestClient_SCGIOverTCP(t *testing.T) {
+	fake, listener := newSCGIServer(t, "tcp", "127.0.0.1:0")
+
+	client, err := NewClient(context.Background(), "scgi://"+listener.Addr().String(), "", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	port, err := client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if port != 0 {
+		t.Errorf("GetPort() with range and random port = %d, want 0", port)
+	}
+
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	if fake.portRange != "51413-51413" {
+		t.Errorf("port_range = %q, want 51413-51413", fake.portRange)
+	}
+	if fake.portRandom != 0 {
+		t.Errorf("port_random = %d, want 0", fake.portRandom)
+	}
+
+	port, err = client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if port != 51413 {
+		t.Errorf("GetPort() = %d, want 51413", port)
+	}
+}
+
+func TestClient_SCGIOverUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "rtorrent.sock")
+	fake, _ := newSCGIServer(t, "unix", socket)
+	fake.portRange = "40000-40000"
+	fake.portRandom = 0
+
+	for _, address := range []string{"scgi://" + socket, "unix://" + socket} {
+		client, err := NewClient(context.Background(), address, "", "")
+		if err != nil {
+			t.Fatalf("NewClient(context.Background(), %q) error = %v", address, err)
+		}
+		port, err := client.GetPort(context.Background())
+		if err != nil {
+			t.Fatalf("GetPort() error = %v", err)
+		}
+		if port != 40000 {
+			t.Errorf("GetPort() = %d, want 40000", port)
+		}
+	}
+}
+
+func TestClient_SetPortRetriesFault(t *testing.T) {
+	fake, listener := newSCGIServer(t, "tcp", "127.0.0.1:0")
+	fake.failSet = 1
+
+	client, err := NewClient(context.Background(), "scgi://"+listener.Addr().String(), "", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+	if err := client.SetPort(context.Background(), 51413); err != nil {
+		t.Fatalf("SetPort() error = %v", err)
+	}
+	if fake.portRange != "51413-51413" {
+		t.Errorf("port_range = %q, want 51413-51413", fake.portRange)
+	}
+}
+
+func TestClient_HTTP(t *testing.T) {
+	fake := &fakeRTorrent{portRange: "51413-51413"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "rutorrent" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/RPC2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(fake.handle(body)))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(context.Background(), server.URL, "rutorrent", "wrong")
+	if err == nil {
+		t.Fatal("NewClient() error = nil, want error for bad credentials")
+	}
+	if kind := torrent.KindOf(err); kind != torrent.KindBadCredentials {
+		t.Errorf("KindOf() = %q, want %q", kind, torrent.KindBadCredentials)
+	}
+	if !torrent.IsPermanent(err) {
+		t.Error("IsPermanent() = false, want true for rejected credentials")
+	}
+
+	client, err := NewClient(context.Background(), server.URL, "rutorrent", "secret")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	port, err := client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v", err)
+	}
+	if port != 51413 {
+		t.Errorf("GetPort() = %d, want 51413", port)
+	}
+}
+
+func TestNewTransport_InvalidAddress(t *testing.T) {
+	for _, address := range []string{"ftp://host", "scgi://", "unix://", "localhost:5000"} {
+		if _, err := newTransport(address, "", ""); err == nil {
+			t.Errorf("newTransport(%q) error = nil, want error", address)
+		}
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		in        string
+		low, high int
+		wantErr   bool
+	}{
+		{"51413-51413", 51413, 51413, false},
+		{"6881-6999", 6881, 6999, false},
+		{"7000", 7000, 7000, false},
+		{"abc-def", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		low, high, err := parsePortRange(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parsePortRange(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if low != tt.low || high != tt.high {
+			t.Errorf("parsePortRange(%q) = %d, %d, want %d, %d", tt.in, low, high, tt.low, tt.high)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package rtorrent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scgiTransport sends XML-RPC requests over the SCGI protocol rTorrent
+// exposes through network.scgi.open_port or network.scgi.open_local.
+type scgiTransport struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func (t *scgiTransport) roundTrip(ctx context.Context, body []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, t.network, t.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s %s: %w", t.network, t.address, err)
+	}
+	defer func() { _ = conn.Close() }()
+	// The deadline covers the timeout; closing the connection also unblocks
+	// reads when the caller cancels.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("failed to set deadline: %w", err)
+		}
+	}
+
+	if _, err := conn.Write(encodeSCGIRequest(body)); err != nil {
+		return nil, fmt.Errorf("failed to write scgi request: %w", err)
+	}
+
+	return readSCGIResponse(conn)
+}
+
+// encodeSCGIRequest frames body as an SCGI request: a netstring of NUL
+// separated headers, with CONTENT_LENGTH first as the spec requires.
+func encodeSCGIRequest(body []byte) []byte {
+	headers := [][2]string{
+		{"CONTENT_LENGTH", strconv.Itoa(len(body))},
+		{"SCGI", "1"},
+		{"REQUEST_METHOD", "POST"},
+		{"REQUEST_URI", "/RPC2"},
+		{"CONTENT_TYPE", "text/xml"},
+	}
+
+	var header bytes.Buffer
+	for _, h := range headers {
+		header.WriteString(h[0])
+		header.WriteByte(0)
+		header.WriteString(h[1])
+		header.WriteByte(0)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(strconv.Itoa(header.Len()))
+	buf.WriteByte(':')
+	buf.Write(header.Bytes())
+	buf.WriteByte(',')
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// readSCGIResponse reads a CGI-style response: headers, a blank line and the
+// body until the server closes the connection.
+func readSCGIResponse(r io.Reader) ([]byte, error) {
+	reader := textproto.NewReader(bufio.NewReader(r))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scgi response headers: %w", err)
+	}
+
+	if status := header.Get("Status"); status != "" {
+		code, _, _ := strings.Cut(status, " ")
+		if code != "200" {
+			return nil, fmt.Errorf("unexpected scgi status: %s", status)
+		}
+	}
+
+	body, err := io.ReadAll(reader.R)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scgi response body: %w", err)
+	}
+	return body, nil
+}
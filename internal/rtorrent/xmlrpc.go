@@ -0,0 +1,198 @@
+package rtorrent
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Fault is an XML-RPC fault returned by rTorrent.
+type Fault struct {
+	Code    int
+	Message string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("xmlrpc fault %d: %s", f.Code, f.Message)
+}
+
+// encodeCall renders an XML-RPC methodCall. Supported parameter types are
+// string, int, int64 and bool, which covers every command forwardarr sends.
+func encodeCall(method string, params ...any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodCall><methodName>")
+	if err := xml.EscapeText(&buf, []byte(method)); err != nil {
+		return nil, err
+	}
+	buf.WriteString("</methodName><params>")
+
+	for _, param := range params {
+		buf.WriteString("<param><value>")
+		switch v := param.(type) {
+		case string:
+			buf.WriteString("<string>")
+			if err := xml.EscapeText(&buf, []byte(v)); err != nil {
+				return nil, err
+			}
+			buf.WriteString("</string>")
+		case int:
+			fmt.Fprintf(&buf, "<i8>%d</i8>", v)
+		case int64:
+			fmt.Fprintf(&buf, "<i8>%d</i8>", v)
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(&buf, "<boolean>%d</boolean>", b)
+		default:
+			return nil, fmt.Errorf("unsupported xmlrpc parameter type %T", param)
+		}
+		buf.WriteString("</value></param>")
+	}
+
+	buf.WriteString("</params></methodCall>")
+	return buf.Bytes(), nil
+}
+
+// xmlValue mirrors the XML-RPC <value> element. A value without a type
+// element is a string, so the character data is kept as well.
+type xmlValue struct {
+	String  *string     `xml:"string"`
+	Int     *string     `xml:"int"`
+	I4      *string     `xml:"i4"`
+	I8      *string     `xml:"i8"`
+	Boolean *string     `xml:"boolean"`
+	Double  *string     `xml:"double"`
+	Array   *xmlArray   `xml:"array"`
+	Struct  *xmlStruct  `xml:"struct"`
+	Text    string      `xml:",chardata"`
+	Nil     *struct{}   `xml:"nil"`
+	Base64  *string     `xml:"base64"`
+	Date    *string     `xml:"dateTime.iso8601"`
+	Extra   []xmlAnyTag `xml:",any"`
+}
+
+type xmlAnyTag struct {
+	XMLName xml.Name
+}
+
+type xmlArray struct {
+	Values []xmlValue `xml:"data>value"`
+}
+
+type xmlStruct struct {
+	Members []xmlMember `xml:"member"`
+}
+
+type xmlMember struct {
+	Name  string   `xml:"name"`
+	Value xmlValue `xml:"value"`
+}
+
+type xmlResponse struct {
+	Params []xmlValue `xml:"params>param>value"`
+	Fault  *xmlValue  `xml:"fault>value"`
+}
+
+// decodeResponse parses an XML-RPC methodResponse into Go values: string,
+// int64, bool, float64, []any and map[string]any.
+func decodeResponse(r io.Reader) (any, error) {
+	var resp xmlResponse
+	if err := xml.NewDecoder(r).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode xmlrpc response: %w", err)
+	}
+
+	if resp.Fault != nil {
+		value, err := resp.Fault.decode()
+		if err != nil {
+			return nil, err
+		}
+		fault := &Fault{Message: "unknown fault"}
+		if members, ok := value.(map[string]any); ok {
+			if code, ok := members["faultCode"].(int64); ok {
+				fault.Code = int(code)
+			}
+			if msg, ok := members["faultString"].(string); ok {
+				fault.Message = msg
+			}
+		}
+		return nil, fault
+	}
+
+	if len(resp.Params) == 0 {
+		return nil, errors.New("xmlrpc response has no params")
+	}
+	return resp.Params[0].decode()
+}
+
+func (v xmlValue) decode() (any, error) {
+	switch {
+	case v.String != nil:
+		return *v.String, nil
+	case v.Int != nil:
+		return parseInt(*v.Int)
+	case v.I4 != nil:
+		return parseInt(*v.I4)
+	case v.I8 != nil:
+		return parseInt(*v.I8)
+	case v.Boolean != nil:
+		switch strings.TrimSpace(*v.Boolean) {
+		case "1":
+			return true, nil
+		case "0":
+			return false, nil
+		default:
+			return nil, fmt.Errorf("invalid xmlrpc boolean %q", *v.Boolean)
+		}
+	case v.Double != nil:
+		f, err := strconv.ParseFloat(strings.TrimSpace(*v.Double), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid xmlrpc double %q: %w", *v.Double, err)
+		}
+		return f, nil
+	case v.Array != nil:
+		values := make([]any, 0, len(v.Array.Values))
+		for _, item := range v.Array.Values {
+			decoded, err := item.decode()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, decoded)
+		}
+		return values, nil
+	case v.Struct != nil:
+		members := make(map[string]any, len(v.Struct.Members))
+		for _, member := range v.Struct.Members {
+			decoded, err := member.Value.decode()
+			if err != nil {
+				return nil, err
+			}
+			members[member.Name] = decoded
+		}
+		return members, nil
+	case v.Nil != nil:
+		return nil, nil
+	case v.Base64 != nil:
+		return *v.Base64, nil
+	case v.Date != nil:
+		return *v.Date, nil
+	case len(v.Extra) > 0:
+		return nil, fmt.Errorf("unsupported xmlrpc value type %q", v.Extra[0].XMLName.Local)
+	default:
+		return v.Text, nil
+	}
+}
+
+func parseInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid xmlrpc integer %q: %w", s, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,109 @@
+package rtorrent
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeCall(t *testing.T) {
+	body, err := encodeCall("network.port_range.set", "", "51413-51413", 5, true)
+	if err != nil {
+		t.Fatalf("encodeCall() error = %v", err)
+	}
+
+	got := string(body)
+	for _, want := range []string{
+		"<methodName>network.port_range.set</methodName>",
+		"<param><value><string></string></value></param>",
+		"<param><value><string>51413-51413</string></value></param>",
+		"<param><value><i8>5</i8></value></param>",
+		"<param><value><boolean>1</boolean></value></param>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("encodeCall() = %s, want to contain %s", got, want)
+		}
+	}
+}
+
+func TestEncodeCall_EscapesStrings(t *testing.T) {
+	body, err := encodeCall("execute", "<a&b>")
+	if err != nil {
+		t.Fatalf("encodeCall() error = %v", err)
+	}
+	if !strings.Contains(string(body), "<string>&lt;a&amp;b&gt;</string>") {
+		t.Errorf("encodeCall() did not escape string: %s", body)
+	}
+}
+
+func TestEncodeCall_UnsupportedType(t *testing.T) {
+	if _, err := encodeCall("x", 1.5); err == nil {
+		t.Error("encodeCall() error = nil, want error for float parameter")
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want any
+	}{
+		{"string", `<methodResponse><params><param><value><string>6881-6999</string></value></param></params></methodResponse>`, "6881-6999"},
+		{"untyped string", `<methodResponse><params><param><value>0.9.8</value></param></params></methodResponse>`, "0.9.8"},
+		{"i8", `<methodResponse><params><param><value><i8>1</i8></value></param></params></methodResponse>`, int64(1)},
+		{"i4", `<methodResponse><params><param><value><i4>-7</i4></value></param></params></methodResponse>`, int64(-7)},
+		{"boolean", `<methodResponse><params><param><value><boolean>0</boolean></value></param></params></methodResponse>`, false},
+		{"double", `<methodResponse><params><param><value><double>1.5</double></value></param></params></methodResponse>`, 1.5},
+		{"array", `<methodResponse><params><param><value><array><data><value><i4>1</i4></value><value><string>a</string></value></data></array></value></param></params></methodResponse>`, []any{int64(1), "a"}},
+		{"struct", `<methodResponse><params><param><value><struct><member><name>port</name><value><int>51413</int></value></member></struct></value></param></params></methodResponse>`, map[string]any{"port": int64(51413)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeResponse(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("decodeResponse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeResponse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeResponse_Fault(t *testing.T) {
+	body := `<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><i4>-506</i4></value></member>
+<member><name>faultString</name><value><string>Method 'foo' not defined</string></value></member>
+</struct></value></fault></methodResponse>`
+
+	_, err := decodeResponse(strings.NewReader(body))
+	var fault *Fault
+	if !errors.As(err, &fault) {
+		t.Fatalf("decodeResponse() error = %v, want *Fault", err)
+	}
+	if fault.Code != -506 || fault.Message != "Method 'foo' not defined" {
+		t.Errorf("fault = %+v", fault)
+	}
+}
+
+func TestDecodeResponse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not xml", "garbage"},
+		{"no params", "<methodResponse><params></params></methodResponse>"},
+		{"bad integer", "<methodResponse><params><param><value><i4>abc</i4></value></param></params></methodResponse>"},
+		{"unknown type", "<methodResponse><params><param><value><bogus>1</bogus></value></param></params></methodResponse>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeResponse(strings.NewReader(tt.body)); err == nil {
+				t.Error("decodeResponse() error = nil, want error")
+			}
+		})
+	}
+}
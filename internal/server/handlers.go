@@ -4,10 +4,35 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/eslutz/forwardarr/internal/torrent"
 	"github.com/eslutz/forwardarr/pkg/version"
 )
 
+type targetStatus struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Reachable bool   `json:"reachable"`
+	// ErrorKind classifies the current ping failure when not reachable.
+	ErrorKind     string     `json:"error_kind,omitempty"`
+	Port          int        `json:"port"`
+	ExpectedPort  int        `json:"expected_port,omitempty"`
+	ActualPort    int        `json:"actual_port,omitempty"`
+	LastSync      *time.Time `json:"last_sync,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorKind string     `json:"last_error_kind,omitempty"`
+	// ConnectionStatus is the client's own reachability report, e.g.
+	// "firewalled", for backends that provide one.
+	ConnectionStatus string     `json:"connection_status,omitempty"`
+	DHTNodes         int        `json:"dht_nodes,omitempty"`
+	FirewalledSince  *time.Time `json:"firewalled_since,omitempty"`
+	PausedTorrents   int        `json:"paused_torrents,omitempty"`
+	Version          string     `json:"version,omitempty"`
+	APIVersion       string     `json:"api_version,omitempty"`
+}
+
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	if !s.isRunning {
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -19,11 +44,20 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("OK"))
 }
 
+// readyHandler reports ready only when every target answers a ping.
 func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
-	if err := s.qbitClient.Ping(); err != nil {
-		slog.Warn("readiness check failed", "error", err)
+	var unreachable []string
+	for _, target := range s.watcher.Targets() {
+		if err := target.Client.Ping(r.Context()); err != nil {
+			kind := torrent.KindOf(err)
+			slog.Warn("readiness check failed", "target", target.Name, "client", target.Client.Name(), "kind", kind, "error", err)
+			unreachable = append(unreachable, target.Name+" ("+string(kind)+")")
+		}
+	}
+
+	if len(unreachable) > 0 {
 		w.WriteHeader(http.StatusServiceUnavailable)
-		_, _ = w.Write([]byte("qBittorrent not reachable"))
+		_, _ = w.Write([]byte("Targets not reachable: " + strings.Join(unreachable, ", ")))
 		return
 	}
 
@@ -32,14 +66,66 @@ func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	pingErrors := make(map[string]error)
+	for _, target := range s.watcher.Targets() {
+		pingErrors[target.Name] = target.Client.Ping(r.Context())
+	}
+
+	allReachable := true
+	targets := make([]targetStatus, 0, len(pingErrors))
+	for _, st := range s.watcher.Status() {
+		pingErr := pingErrors[st.Name]
+		ts := targetStatus{
+			Name:             st.Name,
+			Type:             st.Type,
+			Reachable:        pingErr == nil,
+			ErrorKind:        string(torrent.KindOf(pingErr)),
+			Port:             st.Port,
+			ExpectedPort:     st.ExpectedPort,
+			ActualPort:       st.ActualPort,
+			LastError:        st.LastError,
+			LastErrorKind:    st.LastErrorKind,
+			ConnectionStatus: st.ConnectionStatus,
+			DHTNodes:         st.DHTNodes,
+			PausedTorrents:   st.PausedTorrents,
+			Version:          st.Version,
+			APIVersion:       st.APIVersion,
+		}
+		if !st.LastSync.IsZero() {
+			lastSync := st.LastSync.UTC()
+			ts.LastSync = &lastSync
+		}
+		if !st.FirewalledSince.IsZero() {
+			firewalledSince := st.FirewalledSince.UTC()
+			ts.FirewalledSince = &firewalledSince
+		}
+		allReachable = allReachable && ts.Reachable
+		targets = append(targets, ts)
+	}
+
 	status := struct {
-		Status               string `json:"status"`
-		Version              string `json:"version"`
-		QBittorrentReachable bool   `json:"qbittorrent_reachable"`
+		Status                 string `json:"status"`
+		Version                string `json:"version"`
+		TorrentClientReachable bool   `json:"torrent_client_reachable"`
+		// QBittorrentReachable is kept for existing dashboards; it mirrors
+		// TorrentClientReachable regardless of the configured backend.
+		QBittorrentReachable bool `json:"qbittorrent_reachable"`
+		// ForwardedPorts lists every port the source reported, in order.
+		ForwardedPorts []int `json:"forwarded_ports"`
+		// PortDetails holds extra fields read from a structured port file.
+		PortDetails map[string]string `json:"port_details,omitempty"`
+		Targets     []targetStatus    `json:"targets"`
 	}{
-		Status:               "running",
-		Version:              version.Version,
-		QBittorrentReachable: s.qbitClient.Ping() == nil,
+		Status:                 "running",
+		Version:                version.Version,
+		TorrentClientReachable: allReachable,
+		QBittorrentReachable:   allReachable,
+		ForwardedPorts:         s.watcher.ForwardedPorts(),
+		PortDetails:            s.watcher.PortDetails(),
+		Targets:                targets,
+	}
+	if status.ForwardedPorts == nil {
+		status.ForwardedPorts = []int{}
 	}
 
 	if !s.isRunning {
@@ -1,14 +1,40 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/eslutz/forwardarr/internal/qbit"
+	"github.com/eslutz/forwardarr/internal/sync"
+	"github.com/eslutz/forwardarr/internal/torrent"
 )
 
+type fakeWatcher struct {
+	targets  []sync.Target
+	statuses []sync.TargetStatus
+	ports    []int
+	details  map[string]string
+}
+
+func (f *fakeWatcher) Targets() []sync.Target         { return f.targets }
+func (f *fakeWatcher) Status() []sync.TargetStatus    { return f.statuses }
+func (f *fakeWatcher) ForwardedPorts() []int          { return f.ports }
+func (f *fakeWatcher) PortDetails() map[string]string { return f.details }
+
+func newFakeWatcher(client torrent.Client) *fakeWatcher {
+	return &fakeWatcher{
+		targets:  []sync.Target{{Name: "default", Client: client}},
+		statuses: []sync.TargetStatus{{Name: "default", Type: client.Name(), Port: 51413}},
+	}
+}
+
 func TestHealthHandler_Running(t *testing.T) {
 	server := &Server{
 		isRunning: true,
@@ -58,9 +84,9 @@ func TestReadyHandler_Success(t *testing.T) {
 	}))
 	defer qbitServer.Close()
 
-	client, _ := qbit.NewClient(qbitServer.URL, "admin", "admin")
+	client, _ := qbit.NewClient(context.Background(), qbitServer.URL, "admin", "admin")
 	server := &Server{
-		qbitClient: client,
+		watcher: newFakeWatcher(client),
 	}
 
 	req := httptest.NewRequest("GET", "/ready", nil)
@@ -88,9 +114,38 @@ func TestReadyHandler_Failure(t *testing.T) {
 	}))
 	defer qbitServer.Close()
 
-	client, _ := qbit.NewClient(qbitServer.URL, "admin", "admin")
+	client, _ := qbit.NewClient(context.Background(), qbitServer.URL, "admin", "admin")
+	server := &Server{
+		watcher: newFakeWatcher(client),
+	}
+
+	req := httptest.NewRequest("GET", "/ready", nil)
+	w := httptest.NewRecorder()
+
+	server.readyHandler(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyHandler() status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+type pingClient struct {
+	pingErr error
+}
+
+func (p *pingClient) Name() string                              { return "fake" }
+func (p *pingClient) GetPort(context.Context) (int, error)      { return 0, nil }
+func (p *pingClient) SetPort(_ context.Context, port int) error { return nil }
+func (p *pingClient) Ping(context.Context) error                { return p.pingErr }
+
+func TestReadyHandler_OneTargetUnreachable(t *testing.T) {
 	server := &Server{
-		qbitClient: client,
+		watcher: &fakeWatcher{
+			targets: []sync.Target{
+				{Name: "public", Client: &pingClient{}},
+				{Name: "private", Client: &pingClient{pingErr: torrent.NewError(torrent.KindUnreachable, errors.New("connection refused"))}},
+			},
+		},
 	}
 
 	req := httptest.NewRequest("GET", "/ready", nil)
@@ -101,6 +156,97 @@ func TestReadyHandler_Failure(t *testing.T) {
 	if w.Code != http.StatusServiceUnavailable {
 		t.Errorf("readyHandler() status = %d, want %d", w.Code, http.StatusServiceUnavailable)
 	}
+	if !strings.Contains(w.Body.String(), "private (unreachable)") || strings.Contains(w.Body.String(), "public") {
+		t.Errorf("readyHandler() body = %q, want only the unreachable target", w.Body.String())
+	}
+}
+
+func TestStatusHandler_MultipleTargets(t *testing.T) {
+	lastSync := time.Date(2026, 1, 8, 12, 0, 0, 0, time.UTC)
+	server := &Server{
+		isRunning: true,
+		watcher: &fakeWatcher{
+			targets: []sync.Target{
+				{Name: "public", Client: &pingClient{}},
+				{Name: "private", Client: &pingClient{pingErr: torrent.NewError(torrent.KindIPBanned, errors.New("banned"))}},
+			},
+			statuses: []sync.TargetStatus{
+				{Name: "public", Type: "fake", Port: 51413, LastSync: lastSync, ConnectionStatus: "firewalled", DHTNodes: 312, FirewalledSince: lastSync, Version: "v5.0.2", APIVersion: "2.11.2"},
+				{Name: "private", Type: "fake", PausedTorrents: 4, ExpectedPort: 51413, ActualPort: 6881, LastError: "port ignored", LastErrorKind: "verification_failed"},
+			},
+			ports:   []int{51413, 6881},
+			details: map[string]string{"expires": "2026-01-08T14:00:00Z"},
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	w := httptest.NewRecorder()
+
+	server.statusHandler(w, req)
+
+	var status struct {
+		TorrentClientReachable bool              `json:"torrent_client_reachable"`
+		ForwardedPorts         []int             `json:"forwarded_ports"`
+		PortDetails            map[string]string `json:"port_details"`
+		Targets                []struct {
+			Name             string     `json:"name"`
+			Reachable        bool       `json:"reachable"`
+			ErrorKind        string     `json:"error_kind"`
+			Port             int        `json:"port"`
+			ExpectedPort     int        `json:"expected_port"`
+			ActualPort       int        `json:"actual_port"`
+			LastSync         *time.Time `json:"last_sync"`
+			LastError        string     `json:"last_error"`
+			LastErrorKind    string     `json:"last_error_kind"`
+			ConnectionStatus string     `json:"connection_status"`
+			DHTNodes         int        `json:"dht_nodes"`
+			FirewalledSince  *time.Time `json:"firewalled_since"`
+			PausedTorrents   int        `json:"paused_torrents"`
+			Version          string     `json:"version"`
+			APIVersion       string     `json:"api_version"`
+		} `json:"targets"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status response: %v", err)
+	}
+
+	if status.TorrentClientReachable {
+		t.Error("status.TorrentClientReachable = true, want false with one target down")
+	}
+	if !slices.Equal(status.ForwardedPorts, []int{51413, 6881}) {
+		t.Errorf("status.ForwardedPorts = %v, want [51413 6881]", status.ForwardedPorts)
+	}
+	if status.PortDetails["expires"] != "2026-01-08T14:00:00Z" {
+		t.Errorf("status.PortDetails = %v, want the expiry", status.PortDetails)
+	}
+	if len(status.Targets) != 2 {
+		t.Fatalf("len(status.Targets) = %d, want 2", len(status.Targets))
+	}
+	public, private := status.Targets[0], status.Targets[1]
+	if public.Name != "public" || !public.Reachable || public.ErrorKind != "" || public.Port != 51413 || public.LastSync == nil || !public.LastSync.Equal(lastSync) {
+		t.Errorf("public target = %+v", public)
+	}
+	if private.Name != "private" || private.Reachable || private.LastSync != nil || private.LastError != "port ignored" {
+		t.Errorf("private target = %+v", private)
+	}
+	if private.ExpectedPort != 51413 || private.ActualPort != 6881 {
+		t.Errorf("private target expected/actual = %d/%d, want 51413/6881", private.ExpectedPort, private.ActualPort)
+	}
+	if public.ConnectionStatus != "firewalled" || public.DHTNodes != 312 || public.FirewalledSince == nil || !public.FirewalledSince.Equal(lastSync) {
+		t.Errorf("public target connection = %q/%d/%v", public.ConnectionStatus, public.DHTNodes, public.FirewalledSince)
+	}
+	if private.PausedTorrents != 4 || public.PausedTorrents != 0 {
+		t.Errorf("paused torrents = %d/%d, want 0/4", public.PausedTorrents, private.PausedTorrents)
+	}
+	if private.ConnectionStatus != "" || private.FirewalledSince != nil {
+		t.Errorf("private target connection = %q/%v, want empty", private.ConnectionStatus, private.FirewalledSince)
+	}
+	if public.Version != "v5.0.2" || public.APIVersion != "2.11.2" {
+		t.Errorf("public target versions = %q/%q, want v5.0.2/2.11.2", public.Version, public.APIVersion)
+	}
+	if private.ErrorKind != "ip_banned" || private.LastErrorKind != "verification_failed" {
+		t.Errorf("private target kinds = %q/%q, want ip_banned/verification_failed", private.ErrorKind, private.LastErrorKind)
+	}
 }
 
 func TestStatusHandler_Running(t *testing.T) {
@@ -118,10 +264,10 @@ func TestStatusHandler_Running(t *testing.T) {
 	}))
 	defer qbitServer.Close()
 
-	client, _ := qbit.NewClient(qbitServer.URL, "admin", "admin")
+	client, _ := qbit.NewClient(context.Background(), qbitServer.URL, "admin", "admin")
 	server := &Server{
-		qbitClient: client,
-		isRunning:  true,
+		watcher:   newFakeWatcher(client),
+		isRunning: true,
 	}
 
 	req := httptest.NewRequest("GET", "/status", nil)
@@ -134,9 +280,16 @@ func TestStatusHandler_Running(t *testing.T) {
 	}
 
 	var status struct {
-		Status               string `json:"status"`
-		Version              string `json:"version"`
-		QBittorrentReachable bool   `json:"qbittorrent_reachable"`
+		Status                 string `json:"status"`
+		Version                string `json:"version"`
+		TorrentClientReachable bool   `json:"torrent_client_reachable"`
+		QBittorrentReachable   bool   `json:"qbittorrent_reachable"`
+		Targets                []struct {
+			Name      string `json:"name"`
+			Type      string `json:"type"`
+			Reachable bool   `json:"reachable"`
+			Port      int    `json:"port"`
+		} `json:"targets"`
 	}
 
 	err := json.NewDecoder(w.Body).Decode(&status)
@@ -147,9 +300,19 @@ func TestStatusHandler_Running(t *testing.T) {
 	if status.Status != "running" {
 		t.Errorf("status.Status = %q, want %q", status.Status, "running")
 	}
+	if !status.TorrentClientReachable {
+		t.Error("status.TorrentClientReachable = false, want true")
+	}
 	if !status.QBittorrentReachable {
 		t.Error("status.QBittorrentReachable = false, want true")
 	}
+	if len(status.Targets) != 1 {
+		t.Fatalf("len(status.Targets) = %d, want 1", len(status.Targets))
+	}
+	target := status.Targets[0]
+	if target.Name != "default" || target.Type != "qbittorrent" || !target.Reachable || target.Port != 51413 {
+		t.Errorf("status.Targets[0] = %+v", target)
+	}
 }
 
 func TestStatusHandler_Stopping(t *testing.T) {
@@ -162,10 +325,10 @@ func TestStatusHandler_Stopping(t *testing.T) {
 	}))
 	defer qbitServer.Close()
 
-	client, _ := qbit.NewClient(qbitServer.URL, "admin", "admin")
+	client, _ := qbit.NewClient(context.Background(), qbitServer.URL, "admin", "admin")
 	server := &Server{
-		qbitClient: client,
-		isRunning:  false,
+		watcher:   newFakeWatcher(client),
+		isRunning: false,
 	}
 
 	req := httptest.NewRequest("GET", "/status", nil)
@@ -203,8 +366,9 @@ func TestNewServer(t *testing.T) {
 	}))
 	defer qbitServer.Close()
 
-	client, _ := qbit.NewClient(qbitServer.URL, "admin", "admin")
-	server := NewServer("9090", client)
+	client, _ := qbit.NewClient(context.Background(), qbitServer.URL, "admin", "admin")
+	watcher := newFakeWatcher(client)
+	server := NewServer("9090", watcher)
 
 	if server == nil {
 		t.Fatal("NewServer() returned nil")
@@ -215,8 +379,8 @@ func TestNewServer(t *testing.T) {
 	if !server.isRunning {
 		t.Error("server.isRunning = false, want true")
 	}
-	if server.qbitClient != client {
-		t.Error("server.qbitClient not set correctly")
+	if server.watcher != watcher {
+		t.Error("server.watcher not set correctly")
 	}
 }
 
@@ -7,21 +7,31 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
-	"github.com/eslutz/forwardarr/internal/qbit"
+	"github.com/eslutz/forwardarr/internal/sync"
 )
 
+// StatusProvider exposes the targets, their sync status and the forwarded
+// ports with any extra fields read next to them; it is implemented by
+// sync.Watcher.
+type StatusProvider interface {
+	Targets() []sync.Target
+	Status() []sync.TargetStatus
+	ForwardedPorts() []int
+	PortDetails() map[string]string
+}
+
 type Server struct {
-	port       string
-	qbitClient *qbit.Client
-	isRunning  bool
-	server     *http.Server
+	port      string
+	watcher   StatusProvider
+	isRunning bool
+	server    *http.Server
 }
 
-func NewServer(port string, qbitClient *qbit.Client) *Server {
+func NewServer(port string, watcher StatusProvider) *Server {
 	return &Server{
-		port:       port,
-		qbitClient: qbitClient,
-		isRunning:  true,
+		port:      port,
+		watcher:   watcher,
+		isRunning: true,
 	}
 }
 
@@ -0,0 +1,92 @@
+// Package shellcmd runs the user-supplied shell commands of the command port
+// source and the exec target.
+package shellcmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	DefaultShell   = "/bin/sh"
+	DefaultTimeout = 30 * time.Second
+
+	outputWaitDelay = time.Second
+)
+
+// Command is a command line run as "<Shell> -c <Line>".
+type Command struct {
+	Line    string
+	Shell   string
+	Timeout time.Duration
+	// Env is the whole environment of the command, usually built with
+	// Environ.
+	Env []string
+}
+
+// Output holds what the command wrote.
+type Output struct {
+	Stdout string
+	Stderr string
+}
+
+// CheckShell reports an error when shell cannot be found.
+func CheckShell(shell string) error {
+	if _, err := exec.LookPath(shell); err != nil {
+		return fmt.Errorf("shell %s not available: %w", shell, err)
+	}
+	return nil
+}
+
+// Environ returns PATH, HOME and the named variables from forwardarr's own
+// environment. Nothing else is inherited, so client passwords and API keys
+// stay out of the command's reach.
+func Environ(names ...string) []string {
+	var env []string
+	for _, name := range append([]string{"PATH", "HOME"}, names...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// Run runs the command and waits for it at most cmd.Timeout. A non-zero exit
+// is returned as *exec.ExitError; the output is captured either way.
+func Run(ctx context.Context, cmd Command) (Output, error) {
+	ctx, cancel := context.WithTimeout(ctx, cmd.Timeout)
+	defer cancel()
+
+	c := exec.CommandContext(ctx, cmd.Shell, "-c", cmd.Line)
+	c.Env = cmd.Env
+	// Background children may hold the output pipes open after the shell
+	// exits; stop waiting for them shortly after.
+	c.WaitDelay = outputWaitDelay
+
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+
+	err := c.Run()
+	output := Output{Stdout: stdout.String(), Stderr: stderr.String()}
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return output, fmt.Errorf("command timed out after %s", cmd.Timeout)
+	case context.Canceled:
+		return output, fmt.Errorf("command cancelled: %w", ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return output, err
+	}
+	if err != nil {
+		return output, fmt.Errorf("failed to run command: %w", err)
+	}
+	return output, nil
+}
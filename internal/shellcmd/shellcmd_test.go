@@ -0,0 +1,70 @@
+package shellcmd
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("HOME", "/config")
+	t.Setenv("QBIT_PASS", "secret")
+	t.Setenv("TZ", "UTC")
+
+	want := []string{"PATH=/usr/bin", "HOME=/config", "TZ=UTC"}
+	if got := Environ("TZ", "UNSET_VARIABLE"); !slices.Equal(got, want) {
+		t.Errorf("Environ() = %v, want %v", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	output, err := Run(context.Background(), Command{
+		Line:    `echo "$GREETING"; echo warn >&2`,
+		Shell:   DefaultShell,
+		Timeout: DefaultTimeout,
+		Env:     []string{"GREETING=hello"},
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if output.Stdout != "hello\n" || output.Stderr != "warn\n" {
+		t.Errorf("Run() output = %+v", output)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	_, err := Run(context.Background(), Command{Line: "echo bad >&2; exit 3", Shell: DefaultShell, Timeout: DefaultTimeout})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("Run() error = %v, want exit status 3", err)
+	}
+
+	start := time.Now()
+	_, err = Run(context.Background(), Command{Line: "sleep 5", Shell: DefaultShell, Timeout: 50 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Run() error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("Run() took %v, timeout not enforced", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Run(ctx, Command{Line: "true", Shell: DefaultShell, Timeout: DefaultTimeout}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context canceled", err)
+	}
+}
+
+func TestCheckShell(t *testing.T) {
+	if err := CheckShell(DefaultShell); err != nil {
+		t.Errorf("CheckShell(%q) error = %v", DefaultShell, err)
+	}
+	if err := CheckShell("/nonexistent/sh"); err == nil {
+		t.Error("CheckShell() error = nil, want error for a missing shell")
+	}
+}
@@ -0,0 +1,119 @@
+package sync
+
+import (
+	"context"
+	"log/slog"
+	gosync "sync"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// DefaultFirewalledTimeout is how long a target may report firewalled with a
+// matching port before a resync is forced.
+const DefaultFirewalledTimeout = 15 * time.Minute
+
+// DefaultConnectionCheckInterval is how often the connection status is read
+// between syncs.
+const DefaultConnectionCheckInterval = time.Minute
+
+// SetFirewalledTimeout changes how long a target may stay firewalled before a
+// resync is forced. Zero only records the status.
+func (w *Watcher) SetFirewalledTimeout(timeout time.Duration) {
+	w.firewalledTimeout = timeout
+}
+
+// SetConnectionCheckInterval changes how often the connection status is read
+// between syncs, so a firewalled target is noticed close to the timeout
+// rather than on the next sync. Zero only reads it during syncs.
+func (w *Watcher) SetConnectionCheckInterval(interval time.Duration) {
+	w.connectionCheckInterval = interval
+}
+
+// reportsConnection reports whether any target reports its connection status.
+func (w *Watcher) reportsConnection() bool {
+	for _, t := range w.targets {
+		if _, ok := t.Client.(torrent.ConnectionReporter); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConnections runs checkConnection for every target that reports its
+// connection status and currently has the forwarded port applied. Targets
+// whose last sync failed or that still have an older port are left to the
+// next sync.
+func (w *Watcher) checkConnections(ctx context.Context) {
+	ports := w.ForwardedPorts()
+	selected := w.portSelection.selectPort(ports)
+
+	var wg gosync.WaitGroup
+	for _, t := range w.targets {
+		if _, ok := t.Client.(torrent.ConnectionReporter); !ok {
+			continue
+		}
+		port := selected
+		if t.PortIndex > 0 {
+			port = portAt(ports, t.PortIndex)
+		}
+		if status := t.snapshot(); port == 0 || status.Port != port || status.LastError != "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.checkConnection(ctx, t, port)
+		}()
+	}
+	wg.Wait()
+}
+
+// checkConnection records the target's connection status after its port was
+// confirmed. A target that stays firewalled for firewalledTimeout gets a
+// webhook, its port re-applied and a reannounce, then the timer restarts.
+// Failing to read the status is logged but is not a sync error.
+func (w *Watcher) checkConnection(ctx context.Context, t *targetState, port int) {
+	reporter, ok := t.Client.(torrent.ConnectionReporter)
+	if !ok {
+		return
+	}
+
+	info, err := reporter.ConnectionStatus(ctx)
+	if err != nil {
+		slog.Warn("failed to read connection status", "target", t.Name, "client", t.Client.Name(), "error", err)
+		return
+	}
+	SetConnectionStatus(t.Name, info)
+
+	firewalledFor := t.recordConnection(info, time.Now())
+	if info.Status != torrent.ConnectionFirewalled {
+		return
+	}
+	slog.Debug("client reports firewalled", "target", t.Name, "port", port, "firewalled_for", firewalledFor)
+	if w.firewalledTimeout <= 0 || firewalledFor < w.firewalledTimeout {
+		return
+	}
+
+	slog.Warn("client still firewalled despite matching port, forcing resync",
+		"target", t.Name,
+		"port", port,
+		"firewalled_for", firewalledFor.Round(time.Second),
+		"dht_nodes", info.DHTNodes,
+	)
+	IncrementFirewalledResyncs(t.Name)
+	t.restartFirewalledTimer(time.Now())
+
+	if w.webhookClient != nil {
+		if err := w.webhookClient.SendFirewalled(ctx, t.Name, port, firewalledFor); err != nil {
+			slog.Warn("failed to send webhook notification", "target", t.Name, "error", err)
+		}
+	}
+
+	if err := w.setAndVerify(ctx, t, port, port); err != nil {
+		slog.Error("forced resync failed", "target", t.Name, "port", port, "error", err)
+		return
+	}
+	w.reannounce(ctx, t, port, port)
+}
@@ -0,0 +1,212 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
+	"github.com/eslutz/forwardarr/internal/webhook"
+)
+
+// connectionClient reports a fixed connection status.
+type connectionClient struct {
+	fakeClient
+	info torrent.ConnectionInfo
+}
+
+func (c *connectionClient) ConnectionStatus(context.Context) (torrent.ConnectionInfo, error) {
+	return c.info, nil
+}
+
+func TestCheckConnectionRecordsStatus(t *testing.T) {
+	client := &connectionClient{
+		fakeClient: fakeClient{port: 51413},
+		info:       torrent.ConnectionInfo{Status: torrent.ConnectionConnected, DHTNodes: 312},
+	}
+	watcher := newTestWatcher(writePortFile(t, "51413"), nil, client)
+	watcher.SetFirewalledTimeout(time.Minute)
+	targetName := watcher.targets[0].Name
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+
+	status := watcher.Status()[0]
+	if status.ConnectionStatus != torrent.ConnectionConnected || status.DHTNodes != 312 || !status.FirewalledSince.IsZero() {
+		t.Errorf("connection status = %q/%d/%v", status.ConnectionStatus, status.DHTNodes, status.FirewalledSince)
+	}
+	if got := testutil.ToFloat64(connectionStatus.WithLabelValues(targetName, torrent.ConnectionConnected)); got != 1 {
+		t.Errorf("connectionStatus{connected} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(connectionStatus.WithLabelValues(targetName, torrent.ConnectionFirewalled)); got != 0 {
+		t.Errorf("connectionStatus{firewalled} = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(dhtNodes.WithLabelValues(targetName)); got != 312 {
+		t.Errorf("dhtNodes = %v, want 312", got)
+	}
+}
+
+func TestCheckConnectionForcesResyncWhenFirewalled(t *testing.T) {
+	var received webhook.Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode webhook payload: %v", err)
+		}
+	}))
+	defer server.Close()
+	webhookClient := webhook.NewClient(server.URL, time.Second, webhook.TemplateJSON, []string{webhook.EventFirewalled})
+
+	client := &connectionClient{
+		fakeClient: fakeClient{port: 51413},
+		info:       torrent.ConnectionInfo{Status: torrent.ConnectionFirewalled},
+	}
+	watcher := newTestWatcher(writePortFile(t, "51413"), webhookClient, client)
+	watcher.SetFirewalledTimeout(time.Minute)
+	target := watcher.targets[0]
+	baseline := testutil.ToFloat64(firewalledResyncs.WithLabelValues(target.Name))
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	firstSeen := watcher.Status()[0].FirewalledSince
+	if firstSeen.IsZero() {
+		t.Fatal("FirewalledSince not set")
+	}
+	if client.setCalls != 0 {
+		t.Fatalf("SetPort calls = %d before the timeout, want 0", client.setCalls)
+	}
+
+	target.restartFirewalledTimer(time.Now().Add(-2 * time.Minute))
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+
+	if client.setCalls != 1 {
+		t.Errorf("SetPort calls = %d after the timeout, want 1", client.setCalls)
+	}
+	if got := testutil.ToFloat64(firewalledResyncs.WithLabelValues(target.Name)); got != baseline+1 {
+		t.Errorf("firewalledResyncs = %v, want %v", got, baseline+1)
+	}
+	if received.Event != webhook.EventFirewalled || received.NewPort != 51413 {
+		t.Errorf("webhook payload = %+v", received)
+	}
+	if since := watcher.Status()[0].FirewalledSince; time.Since(since) > time.Minute {
+		t.Errorf("FirewalledSince = %v, want the timer restarted after the resync", since)
+	}
+
+	client.info = torrent.ConnectionInfo{Status: torrent.ConnectionConnected}
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if since := watcher.Status()[0].FirewalledSince; !since.IsZero() {
+		t.Errorf("FirewalledSince = %v after reconnecting, want zero", since)
+	}
+}
+
+// firewalledReannouncer is a connectionClient that also reannounces and records
+// every port it is set to.
+type firewalledReannouncer struct {
+	connectionClient
+	setPorts        []int
+	reannounceCalls atomic.Int32
+}
+
+func (f *firewalledReannouncer) SetPort(ctx context.Context, port int) error {
+	f.setPorts = append(f.setPorts, port)
+	return f.connectionClient.SetPort(ctx, port)
+}
+
+func (f *firewalledReannouncer) ReannounceEnabled() bool { return true }
+
+func (f *firewalledReannouncer) Reannounce(context.Context) (int, error) {
+	f.reannounceCalls.Add(1)
+	return 1, nil
+}
+
+func TestCheckConnectionsRepushesMatchingPort(t *testing.T) {
+	client := &firewalledReannouncer{connectionClient: connectionClient{
+		fakeClient: fakeClient{port: 51413},
+		info:       torrent.ConnectionInfo{Status: torrent.ConnectionFirewalled},
+	}}
+	watcher := newTestWatcher(writePortFile(t, "51413"), nil, client)
+	watcher.SetFirewalledTimeout(time.Minute)
+
+	// The client already reports the forwarded port, so the sync sets
+	// nothing and only starts the firewalled timer.
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if len(client.setPorts) != 0 {
+		t.Fatalf("SetPort calls = %v during the sync, want none", client.setPorts)
+	}
+
+	// The check between syncs forces the resync once the timeout passed.
+	watcher.targets[0].restartFirewalledTimer(time.Now().Add(-2 * time.Minute))
+	watcher.checkConnections(context.Background())
+	watcher.background.Wait()
+
+	if !slices.Equal(client.setPorts, []int{51413}) {
+		t.Errorf("SetPort calls = %v, want the matching port 51413 pushed again", client.setPorts)
+	}
+	if got := client.reannounceCalls.Load(); got != 1 {
+		t.Errorf("Reannounce calls = %d, want 1", got)
+	}
+}
+
+func TestCheckConnectionsSkipsStaleTargets(t *testing.T) {
+	client := &connectionClient{
+		fakeClient: fakeClient{port: 51413},
+		info:       torrent.ConnectionInfo{Status: torrent.ConnectionFirewalled},
+	}
+	watcher := newTestWatcher(writePortFile(t, "51413"), nil, client)
+	watcher.SetFirewalledTimeout(time.Minute)
+
+	// Nothing was synced yet, so there is no confirmed port to check.
+	watcher.checkConnections(context.Background())
+	if status := watcher.Status()[0]; status.ConnectionStatus != "" {
+		t.Errorf("ConnectionStatus = %q before the first sync, want none", status.ConnectionStatus)
+	}
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	// The source moved on but the target was not synced to the new port.
+	watcher.setForwardedPorts([]int{6881}, nil)
+	watcher.targets[0].restartFirewalledTimer(time.Now().Add(-2 * time.Minute))
+	watcher.checkConnections(context.Background())
+	if client.setCalls != 0 {
+		t.Errorf("SetPort calls = %d for a target on an older port, want 0", client.setCalls)
+	}
+}
+
+func TestCheckConnectionDisabledTimeout(t *testing.T) {
+	client := &connectionClient{
+		fakeClient: fakeClient{port: 51413},
+		info:       torrent.ConnectionInfo{Status: torrent.ConnectionFirewalled},
+	}
+	watcher := newTestWatcher(writePortFile(t, "51413"), nil, client)
+	watcher.SetFirewalledTimeout(0)
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	watcher.targets[0].restartFirewalledTimer(time.Now().Add(-time.Hour))
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+
+	if client.setCalls != 0 {
+		t.Errorf("SetPort calls = %d with the resync disabled, want 0", client.setCalls)
+	}
+	if status := watcher.Status()[0]; status.ConnectionStatus != torrent.ConnectionFirewalled {
+		t.Errorf("ConnectionStatus = %q, want firewalled", status.ConnectionStatus)
+	}
+}
@@ -0,0 +1,231 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// killSwitchState is persisted so torrents paused before a restart are still
+// resumed afterwards.
+type killSwitchState struct {
+	// Paused maps target names to the torrents the kill switch paused.
+	Paused map[string][]string `json:"paused"`
+}
+
+// EnableKillSwitch pauses torrents on targets that opt in once the forwarded
+// port has been unavailable for delay, and records them in stateFile. Torrents
+// left paused by a previous run are resumed on the next successful sync, even
+// if no target opts in any more. An unreadable state file is only an error
+// when a target opts in; otherwise it is logged and ignored.
+func (w *Watcher) EnableKillSwitch(delay time.Duration, stateFile string) error {
+	enabled := false
+	for _, t := range w.targets {
+		if pauser, ok := t.Client.(torrent.Pauser); ok && pauser.KillSwitchEnabled() {
+			enabled = true
+		}
+	}
+
+	paused, err := loadKillSwitchState(stateFile)
+	if err != nil {
+		if enabled {
+			return err
+		}
+		slog.Warn("ignoring unreadable kill switch state, no target uses the kill switch", "file", stateFile, "error", err)
+		paused = make(map[string][]string)
+	}
+
+	w.killMu.Lock()
+	defer w.killMu.Unlock()
+	w.killSwitchStateFile = stateFile
+	w.paused = paused
+
+	for _, t := range w.targets {
+		if pauser, ok := t.Client.(torrent.Pauser); ok && pauser.KillSwitchEnabled() && w.killSwitchTimer == nil {
+			w.killSwitchDelay = delay
+			w.killSwitchTimer = time.NewTimer(delay)
+			w.killSwitchTimer.Stop()
+		}
+		w.publishPaused(t)
+		if n := len(paused[t.Name]); n > 0 {
+			slog.Info("torrents still paused from a previous run", "target", t.Name, "torrents", n)
+		}
+	}
+	return nil
+}
+
+// portUnavailable arms the kill switch on the first sync without a usable
+// port and engages it once the port has been missing for the delay. The
+// timer makes Start sync again when the delay ends, independent of the
+// sync interval.
+func (w *Watcher) portUnavailable(ctx context.Context) {
+	if w.killSwitchTimer == nil {
+		return
+	}
+
+	now := time.Now()
+	if w.portUnavailableSince.IsZero() {
+		w.portUnavailableSince = now
+		slog.Warn("forwarded port unavailable, kill switch armed", "delay", w.killSwitchDelay)
+	}
+	if remaining := w.killSwitchDelay - now.Sub(w.portUnavailableSince); remaining > 0 {
+		w.killSwitchTimer.Reset(remaining)
+		return
+	}
+
+	w.engageKillSwitch(ctx)
+}
+
+// portAvailable disarms the kill switch. Paused torrents are resumed per
+// target once their port is synced.
+func (w *Watcher) portAvailable() {
+	if w.killSwitchTimer == nil {
+		return
+	}
+	w.killSwitchTimer.Stop()
+	w.portUnavailableSince = time.Time{}
+}
+
+// engageKillSwitch pauses the running torrents of every opted-in target. It
+// runs on every sync while the port is missing, so torrents started in the
+// meantime are paused too.
+func (w *Watcher) engageKillSwitch(ctx context.Context) {
+	w.killMu.Lock()
+	defer w.killMu.Unlock()
+
+	changed := false
+	for _, t := range w.targets {
+		pauser, ok := t.Client.(torrent.Pauser)
+		if !ok || !pauser.KillSwitchEnabled() {
+			continue
+		}
+
+		ids, err := pauser.PauseTorrents(ctx)
+		if err != nil {
+			slog.Error("kill switch failed to pause torrents", "target", t.Name, "error", err)
+			continue
+		}
+		for _, id := range ids {
+			if !slices.Contains(w.paused[t.Name], id) {
+				w.paused[t.Name] = append(w.paused[t.Name], id)
+				changed = true
+			}
+		}
+		if len(ids) > 0 {
+			slog.Warn("kill switch paused torrents while no forwarded port is available",
+				"target", t.Name,
+				"torrents", len(ids),
+				"unavailable_for", time.Since(w.portUnavailableSince).Round(time.Second),
+			)
+		}
+		w.publishPaused(t)
+	}
+
+	if changed {
+		w.saveKillSwitchState()
+	}
+}
+
+// resumePaused resumes the torrents the kill switch paused on t. On failure
+// they stay recorded and the next sync tries again.
+func (w *Watcher) resumePaused(ctx context.Context, t *targetState) {
+	w.killMu.Lock()
+	defer w.killMu.Unlock()
+
+	ids := w.paused[t.Name]
+	if len(ids) == 0 {
+		return
+	}
+
+	if pauser, ok := t.Client.(torrent.Pauser); ok {
+		if err := pauser.ResumeTorrents(ctx, ids); err != nil {
+			slog.Error("failed to resume torrents paused by the kill switch", "target", t.Name, "torrents", len(ids), "error", err)
+			return
+		}
+		slog.Info("resumed torrents paused by the kill switch", "target", t.Name, "torrents", len(ids))
+	} else {
+		slog.Warn("target can no longer resume torrents, forgetting them", "target", t.Name, "torrents", len(ids))
+	}
+
+	delete(w.paused, t.Name)
+	w.publishPaused(t)
+	w.saveKillSwitchState()
+}
+
+// publishPaused updates the status and metric. The caller holds killMu.
+func (w *Watcher) publishPaused(t *targetState) {
+	n := len(w.paused[t.Name])
+	t.setPausedTorrents(n)
+	SetKillSwitchPaused(t.Name, n)
+}
+
+// saveKillSwitchState writes the paused set atomically, or removes the file
+// when nothing is paused. The caller holds killMu.
+func (w *Watcher) saveKillSwitchState() {
+	if len(w.paused) == 0 {
+		if err := os.Remove(w.killSwitchStateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed to remove kill switch state", "file", w.killSwitchStateFile, "error", err)
+		}
+		return
+	}
+
+	if err := writeKillSwitchState(w.killSwitchStateFile, killSwitchState{Paused: w.paused}); err != nil {
+		slog.Error("failed to save kill switch state, paused torrents will not be resumed after a restart",
+			"file", w.killSwitchStateFile,
+			"error", err,
+		)
+	}
+}
+
+func loadKillSwitchState(path string) (map[string][]string, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string][]string), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kill switch state: %w", err)
+	}
+
+	var state killSwitchState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode kill switch state %s: %w", path, err)
+	}
+	if state.Paused == nil {
+		state.Paused = make(map[string][]string)
+	}
+	return state.Paused, nil
+}
+
+func writeKillSwitchState(path string, state killSwitchState) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".kill-switch-*.json")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
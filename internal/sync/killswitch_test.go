@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pausingClient pauses the IDs in running and records what it resumes.
+type pausingClient struct {
+	fakeClient
+	running   []string
+	resumed   []string
+	resumeErr error
+}
+
+func (p *pausingClient) KillSwitchEnabled() bool { return true }
+
+func (p *pausingClient) PauseTorrents(context.Context) ([]string, error) {
+	paused := p.running
+	p.running = nil
+	return paused, nil
+}
+
+func (p *pausingClient) ResumeTorrents(_ context.Context, ids []string) error {
+	if p.resumeErr != nil {
+		return p.resumeErr
+	}
+	p.resumed = append(p.resumed, ids...)
+	return nil
+}
+
+func TestKillSwitchPausesAndResumesAcrossRestart(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state", "kill-switch.json")
+	portFile := writePortFile(t, "")
+
+	client := &pausingClient{fakeClient: fakeClient{port: 51413}, running: []string{"a", "b"}}
+	watcher := newTestWatcher(portFile, nil, client)
+	if err := watcher.EnableKillSwitch(0, stateFile); err != nil {
+		t.Fatalf("EnableKillSwitch() error = %v", err)
+	}
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	client.running = []string{"c"}
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if got := watcher.Status()[0].PausedTorrents; got != 3 {
+		t.Errorf("PausedTorrents = %d, want 3", got)
+	}
+
+	info, err := os.Stat(stateFile)
+	if err != nil {
+		t.Fatalf("state file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("state file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// A new watcher stands in for a restart and resumes from the state file.
+	if err := os.WriteFile(portFile, []byte("51413"), 0644); err != nil {
+		t.Fatalf("failed to write port file: %v", err)
+	}
+	restarted := &pausingClient{fakeClient: fakeClient{port: 51413}}
+	watcher = newTestWatcher(portFile, nil, restarted)
+	if err := watcher.EnableKillSwitch(time.Minute, stateFile); err != nil {
+		t.Fatalf("EnableKillSwitch() error = %v", err)
+	}
+	if got := watcher.Status()[0].PausedTorrents; got != 3 {
+		t.Errorf("PausedTorrents after restart = %d, want 3", got)
+	}
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(restarted.resumed, want) {
+		t.Errorf("resumed = %v, want %v", restarted.resumed, want)
+	}
+	if got := watcher.Status()[0].PausedTorrents; got != 0 {
+		t.Errorf("PausedTorrents after resume = %d, want 0", got)
+	}
+	if _, err := os.Stat(stateFile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state file still present after resume: %v", err)
+	}
+}
+
+func TestKillSwitchWaitsForDelay(t *testing.T) {
+	client := &pausingClient{fakeClient: fakeClient{port: 51413}, running: []string{"a"}}
+	watcher := newTestWatcher(filepath.Join(t.TempDir(), "missing"), nil, client)
+	if err := watcher.EnableKillSwitch(time.Hour, filepath.Join(t.TempDir(), "kill-switch.json")); err != nil {
+		t.Fatalf("EnableKillSwitch() error = %v", err)
+	}
+
+	if err := watcher.syncPort(context.Background()); err == nil {
+		t.Fatal("syncPort() error = nil, want missing port file error")
+	}
+	if len(client.running) != 1 || watcher.portUnavailableSince.IsZero() {
+		t.Errorf("torrents paused before the delay, running = %v", client.running)
+	}
+
+	watcher.portUnavailableSince = time.Now().Add(-2 * time.Hour)
+	_ = watcher.syncPort(context.Background())
+	if len(client.running) != 0 {
+		t.Errorf("running = %v after the delay, want all paused", client.running)
+	}
+}
+
+func TestKillSwitchKeepsTorrentsWhenResumeFails(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "kill-switch.json")
+	if err := writeKillSwitchState(stateFile, killSwitchState{Paused: map[string][]string{"target-0": {"a"}}}); err != nil {
+		t.Fatalf("writeKillSwitchState() error = %v", err)
+	}
+
+	client := &pausingClient{fakeClient: fakeClient{port: 51413}, resumeErr: errors.New("unreachable")}
+	watcher := newTestWatcher(writePortFile(t, "51413"), nil, client)
+	if err := watcher.EnableKillSwitch(time.Minute, stateFile); err != nil {
+		t.Fatalf("EnableKillSwitch() error = %v", err)
+	}
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if got := watcher.Status()[0].PausedTorrents; got != 1 {
+		t.Errorf("PausedTorrents = %d, want 1 kept for the next sync", got)
+	}
+
+	client.resumeErr = nil
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if !reflect.DeepEqual(client.resumed, []string{"a"}) {
+		t.Errorf("resumed = %v, want [a]", client.resumed)
+	}
+}
+
+func TestEnableKillSwitchInvalidState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "kill-switch.json")
+	if err := os.WriteFile(stateFile, []byte("{"), 0600); err != nil {
+		t.Fatalf("failed to write state file: %v", err)
+	}
+
+	watcher := newTestWatcher(writePortFile(t, "51413"), nil, &pausingClient{})
+	if err := watcher.EnableKillSwitch(time.Minute, stateFile); err == nil {
+		t.Error("EnableKillSwitch() error = nil, want decode error")
+	}
+
+	// Without a target using the kill switch a stale file must not stop
+	// startup.
+	watcher = newTestWatcher(writePortFile(t, "51413"), nil, &fakeClient{})
+	if err := watcher.EnableKillSwitch(time.Minute, stateFile); err != nil {
+		t.Errorf("EnableKillSwitch() error = %v, want nil when no target opts in", err)
+	}
+	if watcher.killSwitchTimer != nil {
+		t.Error("kill switch armed without an opted-in target")
+	}
+}
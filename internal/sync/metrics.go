@@ -1,10 +1,13 @@
 package sync
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
 )
 
 var (
@@ -13,34 +16,133 @@ var (
 		Help: "The current forwarded port being synchronized",
 	})
 
-	syncTotal = promauto.NewCounter(prometheus.CounterOpts{
+	forwardedPorts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forwardarr_forwarded_port",
+		Help: "Every port the source currently reports, by 1-based position",
+	}, []string{"position"})
+
+	targetPort = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forwardarr_target_port",
+		Help: "The listening port last confirmed on each target",
+	}, []string{"target"})
+
+	syncTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "forwardarr_sync_total",
 		Help: "Total number of successful port sync operations",
-	})
+	}, []string{"target"})
 
-	syncErrors = promauto.NewCounter(prometheus.CounterOpts{
+	syncErrors = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "forwardarr_sync_errors",
 		Help: "Total number of failed port sync operations",
-	})
+	}, []string{"target", "kind"})
 
-	lastSyncTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+	lastSyncTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "forwardarr_last_sync_timestamp",
 		Help: "Unix timestamp of the last successful sync",
-	})
+	}, []string{"target"})
+
+	clientInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forwardarr_client_info",
+		Help: "Torrent client type and detected versions for each target, always 1",
+	}, []string{"target", "type", "version", "api_version"})
+
+	connectionStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forwardarr_connection_status",
+		Help: "Connection status reported by each target, 1 for the current status and 0 for the others",
+	}, []string{"target", "status"})
+
+	dhtNodes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forwardarr_dht_nodes",
+		Help: "DHT nodes reported by each target",
+	}, []string{"target"})
+
+	firewalledResyncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forwardarr_firewalled_resyncs_total",
+		Help: "Total number of resyncs forced because a target stayed firewalled",
+	}, []string{"target"})
+
+	killSwitchPaused = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forwardarr_kill_switch_paused_torrents",
+		Help: "Torrents paused by the kill switch and not yet resumed",
+	}, []string{"target"})
+
+	reannounceTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forwardarr_reannounce_total",
+		Help: "Total number of tracker reannounce runs after a port change",
+	}, []string{"target", "result"})
+
+	reannouncedTorrents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forwardarr_reannounced_torrents_total",
+		Help: "Total number of torrents reannounced after a port change",
+	}, []string{"target"})
 )
 
 func SetCurrentPort(port int) {
 	currentPort.Set(float64(port))
 }
 
-func IncrementSyncTotal() {
-	syncTotal.Inc()
+// SetForwardedPorts replaces the per-position series so ports that are no
+// longer reported disappear.
+func SetForwardedPorts(ports []int) {
+	forwardedPorts.Reset()
+	for i, port := range ports {
+		forwardedPorts.WithLabelValues(strconv.Itoa(i + 1)).Set(float64(port))
+	}
+}
+
+func SetTargetPort(target string, port int) {
+	targetPort.WithLabelValues(target).Set(float64(port))
+}
+
+func IncrementSyncTotal(target string) {
+	syncTotal.WithLabelValues(target).Inc()
+}
+
+func IncrementSyncErrors(target, kind string) {
+	syncErrors.WithLabelValues(target, kind).Inc()
+}
+
+func UpdateLastSyncTimestamp(target string) {
+	lastSyncTimestamp.WithLabelValues(target).Set(float64(time.Now().Unix()))
+}
+
+// SetClientInfo replaces the target's info series so an upgraded client does
+// not leave the old version behind.
+func SetClientInfo(target, clientType, version, apiVersion string) {
+	clientInfo.DeletePartialMatch(prometheus.Labels{"target": target})
+	clientInfo.WithLabelValues(target, clientType, version, apiVersion).Set(1)
+}
+
+// connectionStatuses are always exported so a status that stops being
+// reported drops to 0 instead of keeping its last value.
+var connectionStatuses = []string{torrent.ConnectionConnected, torrent.ConnectionFirewalled, torrent.ConnectionDisconnected}
+
+func SetConnectionStatus(target string, info torrent.ConnectionInfo) {
+	for _, status := range connectionStatuses {
+		value := 0.0
+		if status == info.Status {
+			value = 1
+		}
+		connectionStatus.WithLabelValues(target, status).Set(value)
+	}
+	dhtNodes.WithLabelValues(target).Set(float64(info.DHTNodes))
+}
+
+func IncrementFirewalledResyncs(target string) {
+	firewalledResyncs.WithLabelValues(target).Inc()
 }
 
-func IncrementSyncErrors() {
-	syncErrors.Inc()
+func SetKillSwitchPaused(target string, torrents int) {
+	killSwitchPaused.WithLabelValues(target).Set(float64(torrents))
 }
 
-func UpdateLastSyncTimestamp() {
-	lastSyncTimestamp.Set(float64(time.Now().Unix()))
+// RecordReannounce counts a reannounce run as "success" or "failure" and adds
+// the torrents that were reannounced before it finished or failed.
+func RecordReannounce(target string, torrents int, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	reannounceTotal.WithLabelValues(target, result).Inc()
+	reannouncedTorrents.WithLabelValues(target).Add(float64(torrents))
 }
@@ -1,6 +1,7 @@
 package sync
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -13,20 +14,48 @@ func TestMetricsHelpers(t *testing.T) {
 		t.Fatalf("currentPort = %v, want 4242", got)
 	}
 
-	baselineTotal := testutil.ToFloat64(syncTotal)
-	IncrementSyncTotal()
-	if got := testutil.ToFloat64(syncTotal); got != baselineTotal+1 {
+	SetForwardedPorts([]int{4242, 4243})
+	SetForwardedPorts([]int{4244})
+	if got := testutil.ToFloat64(forwardedPorts.WithLabelValues("1")); got != 4244 {
+		t.Fatalf("forwardedPorts[1] = %v, want 4244", got)
+	}
+	if got := testutil.CollectAndCount(forwardedPorts); got != 1 {
+		t.Fatalf("forwardedPorts series = %d, want 1 after the second port went away", got)
+	}
+
+	SetTargetPort("metrics-test", 4343)
+	if got := testutil.ToFloat64(targetPort.WithLabelValues("metrics-test")); got != 4343 {
+		t.Fatalf("targetPort = %v, want 4343", got)
+	}
+
+	baselineTotal := testutil.ToFloat64(syncTotal.WithLabelValues("metrics-test"))
+	IncrementSyncTotal("metrics-test")
+	if got := testutil.ToFloat64(syncTotal.WithLabelValues("metrics-test")); got != baselineTotal+1 {
 		t.Fatalf("syncTotal = %v, want %v", got, baselineTotal+1)
 	}
 
-	baselineErrors := testutil.ToFloat64(syncErrors)
-	IncrementSyncErrors()
-	if got := testutil.ToFloat64(syncErrors); got != baselineErrors+1 {
+	baselineErrors := testutil.ToFloat64(syncErrors.WithLabelValues("metrics-test", "unreachable"))
+	IncrementSyncErrors("metrics-test", "unreachable")
+	if got := testutil.ToFloat64(syncErrors.WithLabelValues("metrics-test", "unreachable")); got != baselineErrors+1 {
 		t.Fatalf("syncErrors = %v, want %v", got, baselineErrors+1)
 	}
 
-	UpdateLastSyncTimestamp()
-	if got := testutil.ToFloat64(lastSyncTimestamp); got <= float64(time.Now().Add(-1*time.Second).Unix()) {
+	UpdateLastSyncTimestamp("metrics-test")
+	if got := testutil.ToFloat64(lastSyncTimestamp.WithLabelValues("metrics-test")); got <= float64(time.Now().Add(-1*time.Second).Unix()) {
 		t.Fatalf("lastSyncTimestamp not updated, got %v", got)
 	}
+
+	baselineSuccess := testutil.ToFloat64(reannounceTotal.WithLabelValues("metrics-test", "success"))
+	baselineTorrents := testutil.ToFloat64(reannouncedTorrents.WithLabelValues("metrics-test"))
+	RecordReannounce("metrics-test", 5, nil)
+	RecordReannounce("metrics-test", 2, errors.New("failed"))
+	if got := testutil.ToFloat64(reannounceTotal.WithLabelValues("metrics-test", "success")); got != baselineSuccess+1 {
+		t.Fatalf("reannounceTotal success = %v, want %v", got, baselineSuccess+1)
+	}
+	if got := testutil.ToFloat64(reannounceTotal.WithLabelValues("metrics-test", "failure")); got < 1 {
+		t.Fatalf("reannounceTotal failure = %v, want at least 1", got)
+	}
+	if got := testutil.ToFloat64(reannouncedTorrents.WithLabelValues("metrics-test")); got != baselineTorrents+7 {
+		t.Fatalf("reannouncedTorrents = %v, want %v", got, baselineTorrents+7)
+	}
 }
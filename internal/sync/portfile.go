@@ -0,0 +1,258 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/eslutz/forwardarr/internal/jsonpath"
+	"github.com/eslutz/forwardarr/internal/portlist"
+)
+
+// Port file formats accepted by NewPortFileParser.
+const (
+	PortFileFormatPlain = "plain"
+	PortFileFormatJSON  = "json"
+	PortFileFormatEnv   = "env"
+	PortFileFormatRegex = "regex"
+)
+
+// PortFileParser extracts the ports and any extra fields, such as an expiry
+// or the public IP, from the port file.
+type PortFileParser struct {
+	format string
+	// field is the dotted JSON path or the env key holding the port.
+	field string
+	regex *regexp.Regexp
+}
+
+// NewPortFileParser validates a port file format. field defaults to "port"
+// for JSON and "PORT" for env files; pattern is required for the regex
+// format, which takes the port from a group named "port" or else the first
+// capture group.
+func NewPortFileParser(format, field, pattern string) (*PortFileParser, error) {
+	p := &PortFileParser{format: strings.ToLower(strings.TrimSpace(format)), field: strings.TrimSpace(field)}
+	switch p.format {
+	case "", PortFileFormatPlain:
+		p.format = PortFileFormatPlain
+	case PortFileFormatJSON:
+		if p.field == "" {
+			p.field = "port"
+		}
+		p.field = jsonpath.Normalize(p.field)
+	case PortFileFormatEnv:
+		if p.field == "" {
+			p.field = "PORT"
+		}
+	case PortFileFormatRegex:
+		if pattern == "" {
+			return nil, fmt.Errorf("port file format %s requires a regex", p.format)
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port file regex: %w", err)
+		}
+		if regex.NumSubexp() == 0 {
+			return nil, fmt.Errorf("port file regex %q has no capture group", pattern)
+		}
+		p.regex = regex
+	default:
+		return nil, fmt.Errorf("unknown port file format %q, want plain, json, env or regex", format)
+	}
+	return p, nil
+}
+
+// Format returns the normalized format name.
+func (p *PortFileParser) Format() string {
+	return p.format
+}
+
+// parse returns the ports and the extra fields found next to them. Content
+// without a valid port is logged and yields no ports, like an invalid plain
+// port file.
+func (p *PortFileParser) parse(content string) ([]int, map[string]string) {
+	switch p.format {
+	case PortFileFormatJSON:
+		return p.parseJSON(content)
+	case PortFileFormatEnv:
+		return p.parseEnv(content)
+	case PortFileFormatRegex:
+		return p.parseRegex(content)
+	default:
+		ports := portlist.Parse(content)
+		if len(ports) == 0 {
+			slog.Warn("no valid port in file, skipping sync", "value", strings.TrimSpace(content))
+		}
+		return ports, nil
+	}
+}
+
+// parseJSON reads the port at the field path. The value may be a number, a
+// numeric string or an array of either. The other top-level fields become
+// details.
+func (p *PortFileParser) parseJSON(content string) ([]int, map[string]string) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		slog.Warn("invalid JSON in port file, skipping sync", "error", err)
+		return nil, nil
+	}
+
+	value, err := jsonpath.Lookup(document, p.field)
+	if err != nil {
+		slog.Warn("port not found in port file, skipping sync", "field", p.field, "error", err)
+		return nil, nil
+	}
+
+	var ports []int
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			ports = append(ports, portlist.Parse(jsonScalar(item))...)
+		}
+	default:
+		ports = portlist.Parse(jsonScalar(v))
+	}
+
+	details := make(map[string]string)
+	p.collectJSONDetails(document, "", details)
+	if len(details) == 0 {
+		details = nil
+	}
+	return ports, details
+}
+
+// collectJSONDetails adds every value except the port to details under its
+// dotted path. Objects and arrays on the way to the port are flattened so the
+// port's siblings, such as data.expires next to data.port, are kept; others
+// are kept whole.
+func (p *PortFileParser) collectJSONDetails(value any, path string, details map[string]string) {
+	if path == p.field {
+		return
+	}
+	if path != "" && !strings.HasPrefix(p.field, path+".") {
+		details[path] = jsonScalar(value)
+		return
+	}
+
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch node := value.(type) {
+	case map[string]any:
+		for key, item := range node {
+			p.collectJSONDetails(item, join(key), details)
+		}
+	case []any:
+		for i, item := range node {
+			p.collectJSONDetails(item, join(strconv.Itoa(i)), details)
+		}
+	}
+}
+
+// parseEnv reads KEY=VALUE lines as written for docker env files or shell
+// sourcing: blank lines, comments and an "export " prefix are allowed and
+// values may be quoted. The other keys become details.
+func (p *PortFileParser) parseEnv(content string) ([]int, map[string]string) {
+	var ports []int
+	found := false
+	var details map[string]string
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = unquote(strings.TrimSpace(value))
+		if key == p.field {
+			ports, found = portlist.Parse(value), true
+			continue
+		}
+		if details == nil {
+			details = make(map[string]string)
+		}
+		details[key] = value
+	}
+
+	if !found {
+		slog.Warn("port key not found in port file, skipping sync", "key", p.field)
+		return nil, nil
+	}
+	return ports, details
+}
+
+// parseRegex reads a port from every match. Other named groups of the first
+// match become details.
+func (p *PortFileParser) parseRegex(content string) ([]int, map[string]string) {
+	matches := p.regex.FindAllStringSubmatch(content, -1)
+	if matches == nil {
+		slog.Warn("port file does not match regex, skipping sync", "regex", p.regex.String())
+		return nil, nil
+	}
+
+	portGroup := p.regex.SubexpIndex("port")
+	if portGroup < 0 {
+		portGroup = 1
+	}
+
+	var ports []int
+	for _, match := range matches {
+		ports = append(ports, portlist.Parse(match[portGroup])...)
+	}
+
+	var details map[string]string
+	for i, name := range p.regex.SubexpNames() {
+		if name == "" || i == portGroup || matches[0][i] == "" {
+			continue
+		}
+		if details == nil {
+			details = make(map[string]string)
+		}
+		details[name] = matches[0][i]
+	}
+	return ports, details
+}
+
+// jsonScalar renders a decoded JSON value as text. Strings are returned as
+// is; objects and arrays are re-encoded.
+func jsonScalar(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// unquote strips one pair of matching single or double quotes.
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,196 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/webhook"
+)
+
+func TestNewPortFileParser_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		pattern string
+	}{
+		{name: "unknown format", format: "yaml"},
+		{name: "regex without pattern", format: "regex"},
+		{name: "invalid regex", format: "regex", pattern: "("},
+		{name: "regex without group", format: "regex", pattern: `\d+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPortFileParser(tt.format, "", tt.pattern); err == nil {
+				t.Error("NewPortFileParser() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestPortFileParser_Parse(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		field       string
+		pattern     string
+		content     string
+		wantPorts   []int
+		wantDetails map[string]string
+	}{
+		{
+			name:      "plain",
+			format:    "",
+			content:   "51413\n",
+			wantPorts: []int{51413},
+		},
+		{
+			name:        "json default field",
+			format:      "json",
+			content:     `{"port":51413,"expires":"2026-01-08T14:00:00Z","public_ip":"203.0.113.7"}`,
+			wantPorts:   []int{51413},
+			wantDetails: map[string]string{"expires": "2026-01-08T14:00:00Z", "public_ip": "203.0.113.7"},
+		},
+		{
+			name:        "json nested path",
+			format:      "json",
+			field:       "$.data.port",
+			content:     `{"data":{"port":"6881"},"lifetime":60}`,
+			wantPorts:   []int{6881},
+			wantDetails: map[string]string{"lifetime": "60"},
+		},
+		{
+			name:        "json nested siblings",
+			format:      "json",
+			field:       "data.port",
+			content:     `{"data":{"port":6881,"expires":"2026-01-08T14:00:00Z","server":{"ip":"203.0.113.7"}},"peers":[1,2]}`,
+			wantPorts:   []int{6881},
+			wantDetails: map[string]string{"data.expires": "2026-01-08T14:00:00Z", "data.server": `{"ip":"203.0.113.7"}`, "peers": "[1,2]"},
+		},
+		{
+			name:      "json port list",
+			format:    "json",
+			field:     "ports",
+			content:   `{"ports":[51413,6881]}`,
+			wantPorts: []int{51413, 6881},
+		},
+		{
+			name:    "json missing field",
+			format:  "json",
+			content: `{"expires":"soon"}`,
+		},
+		{
+			name:    "invalid json",
+			format:  "json",
+			content: `51413,`,
+		},
+		{
+			name:        "env file",
+			format:      "env",
+			content:     "# written by the VPN\nexport PORT=\"51413\"\nPUBLIC_IP='203.0.113.7'\n\n",
+			wantPorts:   []int{51413},
+			wantDetails: map[string]string{"PUBLIC_IP": "203.0.113.7"},
+		},
+		{
+			name:        "env custom key",
+			format:      "env",
+			field:       "VPN_PORT",
+			content:     "VPN_PORT=6881\nEXPIRES=1767880800\n",
+			wantPorts:   []int{6881},
+			wantDetails: map[string]string{"EXPIRES": "1767880800"},
+		},
+		{
+			name:    "env missing key",
+			format:  "env",
+			content: "EXPIRES=1767880800\n",
+		},
+		{
+			name:        "regex named groups",
+			format:      "regex",
+			pattern:     `port (?P<port>\d+) expires (?P<expires>\S+)`,
+			content:     "port 51413 expires 14:00\n",
+			wantPorts:   []int{51413},
+			wantDetails: map[string]string{"expires": "14:00"},
+		},
+		{
+			name:      "regex every match",
+			format:    "regex",
+			pattern:   `port=(\d+)`,
+			content:   "port=51413\nport=6881\n",
+			wantPorts: []int{51413, 6881},
+		},
+		{
+			name:    "regex no match",
+			format:  "regex",
+			pattern: `port=(\d+)`,
+			content: "waiting\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewPortFileParser(tt.format, tt.field, tt.pattern)
+			if err != nil {
+				t.Fatalf("NewPortFileParser() error = %v", err)
+			}
+			ports, details := parser.parse(tt.content)
+			if !slices.Equal(ports, tt.wantPorts) {
+				t.Errorf("parse() ports = %v, want %v", ports, tt.wantPorts)
+			}
+			if !maps.Equal(details, tt.wantDetails) {
+				t.Errorf("parse() details = %v, want %v", details, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestSyncPort_PortFileDetails(t *testing.T) {
+	portFile := filepath.Join(t.TempDir(), "forwarded_port")
+	content := `{"port":51413,"expires":"2026-01-08T14:00:00Z"}`
+	if err := os.WriteFile(portFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	var payload webhook.Payload
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode webhook payload: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhookServer.Close()
+
+	parser, err := NewPortFileParser("json", "", "")
+	if err != nil {
+		t.Fatalf("NewPortFileParser() error = %v", err)
+	}
+
+	client := &fakeClient{port: 1}
+	w := &Watcher{
+		portFile:      portFile,
+		targets:       newTargetStates([]Target{{Name: "a", Client: client}}),
+		webhookClient: webhook.NewClient(webhookServer.URL, time.Second, webhook.TemplateJSON, []string{webhook.EventPortChanged}),
+	}
+	w.SetPortFileParser(parser)
+
+	if err := w.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if client.port != 51413 {
+		t.Errorf("client port = %d, want 51413", client.port)
+	}
+	if got := w.PortDetails()["expires"]; got != "2026-01-08T14:00:00Z" {
+		t.Errorf("PortDetails() = %v, want the expiry", w.PortDetails())
+	}
+	if payload.Details["expires"] != "2026-01-08T14:00:00Z" {
+		t.Errorf("webhook details = %v, want the expiry", payload.Details)
+	}
+}
@@ -0,0 +1,71 @@
+package sync
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// errorKindPortIndex labels targets whose PortIndex is beyond the ports the
+// source currently reports.
+const errorKindPortIndex = "port_index"
+
+// PortSelection chooses the port pushed to targets without their own
+// PortIndex when the source reports several: the first one, the lowest one or
+// the one at a 1-based position.
+type PortSelection struct {
+	lowest   bool
+	position int
+}
+
+// ParsePortSelection accepts "first", "lowest" or a position such as "2".
+// An empty value selects the first port.
+func ParsePortSelection(value string) (PortSelection, error) {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "", "first":
+		return PortSelection{}, nil
+	case "lowest":
+		return PortSelection{lowest: true}, nil
+	}
+
+	position, err := strconv.Atoi(value)
+	if err != nil || position < 1 {
+		return PortSelection{}, fmt.Errorf("invalid port selection %q, want first, lowest or a position starting at 1", value)
+	}
+	return PortSelection{position: position}, nil
+}
+
+func (p PortSelection) String() string {
+	switch {
+	case p.lowest:
+		return "lowest"
+	case p.position > 0:
+		return strconv.Itoa(p.position)
+	default:
+		return "first"
+	}
+}
+
+// selectPort returns the selected port, or 0 when ports is empty or shorter
+// than the selected position.
+func (p PortSelection) selectPort(ports []int) int {
+	switch {
+	case len(ports) == 0:
+		return 0
+	case p.lowest:
+		return slices.Min(ports)
+	case p.position > 0:
+		return portAt(ports, p.position)
+	default:
+		return ports[0]
+	}
+}
+
+// portAt returns the port at a 1-based position, or 0 when there is none.
+func portAt(ports []int, position int) int {
+	if position < 1 || position > len(ports) {
+		return 0
+	}
+	return ports[position-1]
+}
@@ -0,0 +1,127 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePortSelection(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: "first"},
+		{value: "first", want: "first"},
+		{value: " Lowest ", want: "lowest"},
+		{value: "2", want: "2"},
+		{value: "0", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "highest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			selection, err := ParsePortSelection(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePortSelection(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if err == nil && selection.String() != tt.want {
+				t.Errorf("ParsePortSelection(%q) = %s, want %s", tt.value, selection, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortSelection_SelectPort(t *testing.T) {
+	ports := []int{51413, 6881, 40000}
+	tests := []struct {
+		selection string
+		ports     []int
+		want      int
+	}{
+		{selection: "first", ports: ports, want: 51413},
+		{selection: "lowest", ports: ports, want: 6881},
+		{selection: "3", ports: ports, want: 40000},
+		{selection: "4", ports: ports, want: 0},
+		{selection: "first", ports: nil, want: 0},
+		{selection: "lowest", ports: nil, want: 0},
+	}
+
+	for _, tt := range tests {
+		selection, err := ParsePortSelection(tt.selection)
+		if err != nil {
+			t.Fatalf("ParsePortSelection(%q) error = %v", tt.selection, err)
+		}
+		if got := selection.selectPort(tt.ports); got != tt.want {
+			t.Errorf("%s.selectPort(%v) = %d, want %d", tt.selection, tt.ports, got, tt.want)
+		}
+	}
+}
+
+func TestSyncPort_MultiplePorts(t *testing.T) {
+	portFile := filepath.Join(t.TempDir(), "forwarded_port")
+	if err := os.WriteFile(portFile, []byte("51413,6881\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	selected := &fakeClient{port: 1}
+	second := &fakeClient{port: 1}
+	w := &Watcher{
+		portFile: portFile,
+		targets: newTargetStates([]Target{
+			{Name: "selected", Client: selected},
+			{Name: "second", Client: second, PortIndex: 2},
+		}),
+	}
+	selection, _ := ParsePortSelection("lowest")
+	w.SetPortSelection(selection)
+
+	if err := w.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if selected.port != 6881 {
+		t.Errorf("selected target port = %d, want the lowest port 6881", selected.port)
+	}
+	if second.port != 6881 {
+		t.Errorf("second target port = %d, want the port at position 2", second.port)
+	}
+	if got := w.ForwardedPorts(); !slices.Equal(got, []int{51413, 6881}) {
+		t.Errorf("ForwardedPorts() = %v, want [51413 6881]", got)
+	}
+}
+
+func TestSyncPort_PortIndexUnavailable(t *testing.T) {
+	source := &fakeSource{ports: []int{51413}}
+	first := &fakeClient{port: 1}
+	extra := &fakeClient{port: 1}
+	w, err := NewSourceWatcher(source, time.Second, []Target{
+		{Name: "first", Client: first},
+		{Name: "extra", Client: extra, PortIndex: 2},
+	}, nil, 0)
+	if err != nil {
+		t.Fatalf("NewSourceWatcher() error = %v", err)
+	}
+
+	err = w.syncPort(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "target extra") {
+		t.Fatalf("syncPort() error = %v, want error for target extra", err)
+	}
+	if first.port != 51413 {
+		t.Errorf("first target port = %d, want 51413", first.port)
+	}
+	if extra.setCalls != 0 {
+		t.Errorf("extra target SetPort calls = %d, want 0", extra.setCalls)
+	}
+
+	for _, status := range w.Status() {
+		if status.Name == "extra" && status.LastErrorKind != errorKindPortIndex {
+			t.Errorf("extra LastErrorKind = %q, want %q", status.LastErrorKind, errorKindPortIndex)
+		}
+	}
+}
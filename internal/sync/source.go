@@ -0,0 +1,112 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/portlist"
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/webhook"
+)
+
+// errorKindPortSource labels failures to read a polled port source.
+const errorKindPortSource = "port_source"
+
+// DefaultPollInterval is how often a polled port source is read.
+const DefaultPollInterval = 30 * time.Second
+
+// PortSource supplies the forwarded ports when they do not come from the port
+// file. ReadPorts returns no ports and no error when none is currently
+// available, which skips the sync the same way an empty port file does.
+type PortSource interface {
+	Name() string
+	ReadPorts(ctx context.Context) ([]int, error)
+}
+
+// renewingSource is a PortSource holding a lease that is only renewed while
+// it is read; RenewInterval is the longest it may go unread.
+type renewingSource interface {
+	RenewInterval() time.Duration
+}
+
+// NewSourceWatcher creates a watcher that polls source every pollInterval
+// instead of watching the port file. Targets are only contacted when the
+// polled port changes or on the sync interval.
+func NewSourceWatcher(source PortSource, pollInterval time.Duration, targets []Target, webhookClient *webhook.Client, syncInterval time.Duration) (*Watcher, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("at least one target is required")
+	}
+	if source == nil {
+		return nil, errors.New("port source is required")
+	}
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+
+	slog.Info("polling port source", "source", source.Name(), "interval", pollInterval)
+	return &Watcher{
+		source:                  source,
+		pollInterval:            pollInterval,
+		targets:                 newTargetStates(targets),
+		webhookClient:           webhookClient,
+		syncInterval:            syncInterval,
+		firewalledTimeout:       DefaultFirewalledTimeout,
+		connectionCheckInterval: DefaultConnectionCheckInterval,
+		verifyRetry:             retry.DefaultPolicy(),
+	}, nil
+}
+
+// readPorts reads the forwarded ports from the configured source, or from the
+// port file when there is none, along with any extra fields the port file
+// carries. The third result labels read failures.
+func (w *Watcher) readPorts(ctx context.Context) ([]int, map[string]string, string, error) {
+	if w.source == nil {
+		ports, details, err := w.readPortsFromFile()
+		return ports, details, errorKindPortFile, err
+	}
+
+	ports, err := w.source.ReadPorts(ctx)
+	if err != nil {
+		return nil, nil, errorKindPortSource, err
+	}
+	valid := ports[:0:0]
+	for _, port := range ports {
+		if !portlist.Valid(port) {
+			slog.Warn("port out of valid range, ignoring", "source", w.source.Name(), "port", port)
+			continue
+		}
+		valid = append(valid, port)
+	}
+	return valid, nil, errorKindPortSource, nil
+}
+
+// sourcePollInterval is the poll interval, shortened to the source's renewal
+// interval when that is shorter. It is checked after every poll because the
+// renewal interval follows the lease the source was last granted.
+func (w *Watcher) sourcePollInterval() time.Duration {
+	if renewer, ok := w.source.(renewingSource); ok {
+		if renew := renewer.RenewInterval(); renew > 0 && renew < w.pollInterval {
+			return renew
+		}
+	}
+	return w.pollInterval
+}
+
+// pollSource syncs when the polled ports differ from the ones last seen, so
+// unchanged ports do not query every target. The ports read here are the ones
+// synced, so the source is read once per poll. Read failures are recorded
+// against the targets and arm the kill switch.
+func (w *Watcher) pollSource(ctx context.Context) error {
+	ports, details, errKind, err := w.readPorts(ctx)
+	if err != nil {
+		return w.readFailed(ctx, errKind, err)
+	}
+	if slices.Equal(ports, w.lastPolledPorts) {
+		slog.Debug("polled ports unchanged", "source", w.source.Name(), "ports", ports)
+		return nil
+	}
+	return w.syncPorts(ctx, ports, details)
+}
@@ -0,0 +1,194 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	gosync "sync"
+	"testing"
+	"time"
+)
+
+// fakeSource is an in-memory PortSource.
+type fakeSource struct {
+	mu    gosync.Mutex
+	ports []int
+	err   error
+	reads int
+}
+
+func (f *fakeSource) Name() string { return "fake" }
+
+func (f *fakeSource) ReadPorts(context.Context) ([]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	return f.ports, f.err
+}
+
+func (f *fakeSource) set(err error, ports ...int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ports = ports
+	f.err = err
+}
+
+func TestNewSourceWatcher_Invalid(t *testing.T) {
+	if _, err := NewSourceWatcher(&fakeSource{}, time.Second, nil, nil, 0); err == nil {
+		t.Error("NewSourceWatcher() error = nil, want error without targets")
+	}
+	if _, err := NewSourceWatcher(nil, time.Second, []Target{{Name: "a", Client: &fakeClient{}}}, nil, 0); err == nil {
+		t.Error("NewSourceWatcher() error = nil, want error without source")
+	}
+}
+
+func TestPollSource_SyncsOnlyOnChange(t *testing.T) {
+	source := &fakeSource{ports: []int{51413}}
+	client := &fakeClient{port: 1}
+	watcher, err := NewSourceWatcher(source, time.Second, []Target{{Name: "a", Client: client}}, nil, 0)
+	if err != nil {
+		t.Fatalf("NewSourceWatcher() error = %v", err)
+	}
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if client.port != 51413 {
+		t.Fatalf("client port = %d, want 51413", client.port)
+	}
+
+	getCalls := client.getCalls
+	if err := watcher.pollSource(context.Background()); err != nil {
+		t.Fatalf("pollSource() error = %v", err)
+	}
+	if client.getCalls != getCalls {
+		t.Errorf("GetPort calls = %d, want %d for an unchanged port", client.getCalls, getCalls)
+	}
+
+	source.set(nil, 6881)
+	if err := watcher.pollSource(context.Background()); err != nil {
+		t.Fatalf("pollSource() error = %v", err)
+	}
+	if client.port != 6881 {
+		t.Errorf("client port = %d, want 6881 after the source changed", client.port)
+	}
+}
+
+func TestPollSource_ReadsOncePerPoll(t *testing.T) {
+	// The out-of-range entry is dropped before the comparison, so it does
+	// not make every poll look like a change.
+	source := &fakeSource{ports: []int{70000, 51413}}
+	client := &fakeClient{port: 1}
+	watcher, err := NewSourceWatcher(source, time.Second, []Target{{Name: "a", Client: client}}, nil, 0)
+	if err != nil {
+		t.Fatalf("NewSourceWatcher() error = %v", err)
+	}
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	getCalls := client.getCalls
+	if err := watcher.pollSource(context.Background()); err != nil {
+		t.Fatalf("pollSource() error = %v", err)
+	}
+	if client.getCalls != getCalls {
+		t.Errorf("GetPort calls = %d, want %d for unchanged valid ports", client.getCalls, getCalls)
+	}
+
+	source.set(nil, 70000, 6881)
+	if err := watcher.pollSource(context.Background()); err != nil {
+		t.Fatalf("pollSource() error = %v", err)
+	}
+	if client.port != 6881 {
+		t.Errorf("client port = %d, want 6881", client.port)
+	}
+	if source.reads != 3 {
+		t.Errorf("ReadPorts calls = %d, want 3, one per sync or poll", source.reads)
+	}
+}
+
+func TestSyncPort_SourceError(t *testing.T) {
+	source := &fakeSource{err: errors.New("connection refused")}
+	client := &fakeClient{port: 1}
+	watcher, err := NewSourceWatcher(source, time.Second, []Target{{Name: "a", Client: client}}, nil, 0)
+	if err != nil {
+		t.Fatalf("NewSourceWatcher() error = %v", err)
+	}
+
+	if err := watcher.syncPort(context.Background()); err == nil {
+		t.Fatal("syncPort() error = nil, want error")
+	}
+	status := watcher.Status()[0]
+	if status.LastErrorKind != errorKindPortSource {
+		t.Errorf("LastErrorKind = %q, want %q", status.LastErrorKind, errorKindPortSource)
+	}
+	if client.getCalls != 0 {
+		t.Errorf("GetPort calls = %d, want 0", client.getCalls)
+	}
+}
+
+func TestSyncPort_SourceWithoutPort(t *testing.T) {
+	for _, ports := range [][]int{nil, {0}, {70000}} {
+		client := &fakeClient{port: 1}
+		watcher, err := NewSourceWatcher(&fakeSource{ports: ports}, time.Second, []Target{{Name: "a", Client: client}}, nil, 0)
+		if err != nil {
+			t.Fatalf("NewSourceWatcher() error = %v", err)
+		}
+		if err := watcher.syncPort(context.Background()); err != nil {
+			t.Errorf("syncPort() with ports %v error = %v, want nil", ports, err)
+		}
+		if client.setCalls != 0 {
+			t.Errorf("SetPort calls with ports %v = %d, want 0", ports, client.setCalls)
+		}
+	}
+}
+
+func TestWatcherStartPollsSource(t *testing.T) {
+	source := &fakeSource{ports: []int{51413}}
+	client := &lockedClient{port: 1}
+	watcher, err := NewSourceWatcher(source, 10*time.Millisecond, []Target{{Name: "a", Client: client}}, nil, 0)
+	if err != nil {
+		t.Fatalf("NewSourceWatcher() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Start(ctx) }()
+
+	source.set(nil, 6881)
+	deadline := time.Now().Add(2 * time.Second)
+	for client.current() != 6881 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	if got := client.current(); got != 6881 {
+		t.Errorf("client port = %d, want 6881", got)
+	}
+}
+
+// lockedClient is a fakeClient safe to read while Start runs.
+type lockedClient struct {
+	mu   gosync.Mutex
+	port int
+}
+
+func (c *lockedClient) Name() string { return "fake" }
+
+func (c *lockedClient) GetPort(context.Context) (int, error) { return c.current(), nil }
+
+func (c *lockedClient) SetPort(_ context.Context, port int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.port = port
+	return nil
+}
+
+func (c *lockedClient) Ping(context.Context) error { return nil }
+
+func (c *lockedClient) current() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.port
+}
@@ -0,0 +1,157 @@
+package sync
+
+import (
+	gosync "sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// Target is a named torrent client the forwarded port is pushed to.
+type Target struct {
+	Name   string
+	Client torrent.Client
+	// PortIndex is the 1-based position of the port this target receives
+	// when the source reports several; zero uses the watcher's
+	// PortSelection.
+	PortIndex int
+}
+
+// TargetStatus is a snapshot of the last sync outcome for one target.
+type TargetStatus struct {
+	Name string
+	Type string
+	Port int
+	// ExpectedPort is the forwarded port last pushed to the target and
+	// ActualPort the port the target last reported.
+	ExpectedPort int
+	ActualPort   int
+	LastSync     time.Time
+	LastError    string
+	// LastErrorKind classifies LastError, e.g. "bad_credentials".
+	LastErrorKind string
+	// ConnectionStatus and DHTNodes are the client's last reported
+	// reachability; FirewalledSince is set while it reports firewalled.
+	ConnectionStatus string
+	DHTNodes         int
+	FirewalledSince  time.Time
+	// PausedTorrents counts torrents the kill switch paused and has not
+	// resumed yet.
+	PausedTorrents int
+	// Version and APIVersion are reported by backends that detect them.
+	Version    string
+	APIVersion string
+}
+
+// targetState pairs a target with its status. Targets sync concurrently, so
+// the status is guarded by its own mutex.
+type targetState struct {
+	Target
+
+	mu     gosync.Mutex
+	status TargetStatus
+
+	// reannouncing is set while a background reannounce is running.
+	reannouncing atomic.Bool
+}
+
+func newTargetStates(targets []Target) []*targetState {
+	states := make([]*targetState, 0, len(targets))
+	for _, target := range targets {
+		state := &targetState{
+			Target: target,
+			status: TargetStatus{Name: target.Name, Type: target.Client.Name()},
+		}
+		state.refreshVersion()
+		state.publishClientInfo()
+		states = append(states, state)
+	}
+	return states
+}
+
+// refreshVersion copies the client's detected versions into the status and
+// reports whether they changed, e.g. after the client was upgraded.
+func (t *targetState) refreshVersion() bool {
+	reporter, ok := t.Client.(torrent.VersionReporter)
+	if !ok {
+		return false
+	}
+	app, api := reporter.Version()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status.Version == app && t.status.APIVersion == api {
+		return false
+	}
+	t.status.Version = app
+	t.status.APIVersion = api
+	return true
+}
+
+func (t *targetState) publishClientInfo() {
+	status := t.snapshot()
+	SetClientInfo(t.Name, status.Type, status.Version, status.APIVersion)
+}
+
+func (t *targetState) recordSuccess(port int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Port = port
+	t.status.LastSync = time.Now()
+	t.status.LastError = ""
+	t.status.LastErrorKind = ""
+}
+
+// recordObserved stores the port the target reported alongside the one it
+// was expected to have.
+func (t *targetState) recordObserved(expected, actual int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.ExpectedPort = expected
+	t.status.ActualPort = actual
+}
+
+// recordConnection stores the connection status and returns how long the
+// target has been firewalled, zero when it is not.
+func (t *targetState) recordConnection(info torrent.ConnectionInfo, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.ConnectionStatus = info.Status
+	t.status.DHTNodes = info.DHTNodes
+
+	if info.Status != torrent.ConnectionFirewalled {
+		t.status.FirewalledSince = time.Time{}
+		return 0
+	}
+	if t.status.FirewalledSince.IsZero() {
+		t.status.FirewalledSince = now
+	}
+	return now.Sub(t.status.FirewalledSince)
+}
+
+// restartFirewalledTimer gives a forced resync a full timeout to take effect.
+func (t *targetState) restartFirewalledTimer(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.FirewalledSince = now
+}
+
+func (t *targetState) setPausedTorrents(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.PausedTorrents = n
+}
+
+func (t *targetState) recordError(err error, kind string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastError = err.Error()
+	t.status.LastErrorKind = kind
+}
+
+func (t *targetState) snapshot() TargetStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
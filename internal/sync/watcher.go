@@ -1,41 +1,93 @@
 package sync
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
+	gosync "sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 
-	"github.com/eslutz/forwardarr/internal/qbit"
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
 	"github.com/eslutz/forwardarr/internal/webhook"
 )
 
+// errorKindPortFile labels failures to read the Gluetun port file, which are
+// not specific to any client.
+const errorKindPortFile = "port_file"
+
 type Watcher struct {
-	portFile      string
-	qbitClient    *qbit.Client
+	portFile string
+	// portFileParser reads the port file; nil reads a plain port list.
+	portFileParser *PortFileParser
+	// source replaces the port file when set; it is read every
+	// pollInterval and lastPolledPorts are the ports it returned last.
+	source          PortSource
+	pollInterval    time.Duration
+	lastPolledPorts []int
+	// portSelection picks the port for targets without a PortIndex.
+	portSelection PortSelection
+
+	// portsMu guards forwardedPorts and portDetails, the ports and extra
+	// fields last read, which the status endpoint reads concurrently.
+	portsMu        gosync.Mutex
+	forwardedPorts []int
+	portDetails    map[string]string
+
+	targets       []*targetState
 	webhookClient *webhook.Client
 	syncInterval  time.Duration
-	lastPort      int
 	watcher       *fsnotify.Watcher
+	// firewalledTimeout bounds how long a target may report firewalled
+	// before a resync is forced; connectionCheckInterval is how often that
+	// is checked between syncs.
+	firewalledTimeout       time.Duration
+	connectionCheckInterval time.Duration
+	// verifyRetry decides how often a port that does not read back is set
+	// again before the mismatch is reported.
+	verifyRetry retry.Policy
+
+	// The kill switch is armed when killSwitchTimer is set. The port
+	// availability fields are only touched from the sync loop; paused is
+	// guarded by killMu because targets resume concurrently.
+	killSwitchDelay      time.Duration
+	killSwitchStateFile  string
+	killSwitchTimer      *time.Timer
+	portUnavailableSince time.Time
+	killMu               gosync.Mutex
+	paused               map[string][]string
+
+	// background tracks post-change work such as reannounces.
+	background gosync.WaitGroup
 }
 
-func NewWatcher(portFile string, qbitClient *qbit.Client, webhookClient *webhook.Client, syncInterval time.Duration) (*Watcher, error) {
+func NewWatcher(portFile string, targets []Target, webhookClient *webhook.Client, syncInterval time.Duration) (*Watcher, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("at least one target is required")
+	}
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file watcher: %w", err)
 	}
 
 	w := &Watcher{
-		portFile:      portFile,
-		qbitClient:    qbitClient,
-		webhookClient: webhookClient,
-		syncInterval:  syncInterval,
-		watcher:       watcher,
+		portFile:                portFile,
+		targets:                 newTargetStates(targets),
+		webhookClient:           webhookClient,
+		syncInterval:            syncInterval,
+		watcher:                 watcher,
+		firewalledTimeout:       DefaultFirewalledTimeout,
+		connectionCheckInterval: DefaultConnectionCheckInterval,
+		verifyRetry:             retry.DefaultPolicy(),
 	}
 
 	dir := filepath.Dir(portFile)
@@ -48,7 +100,12 @@ func NewWatcher(portFile string, qbitClient *qbit.Client, webhookClient *webhook
 	return w, nil
 }
 
-func (w *Watcher) Start() error {
+// Start syncs once and then on every port file change or polled port change,
+// tick and kill switch deadline until ctx is cancelled. Between syncs it reads
+// the connection status of targets that report one. In-flight requests are
+// cancelled with ctx and Start waits for background work to finish before
+// returning.
+func (w *Watcher) Start(ctx context.Context) error {
 	var ticker *time.Ticker
 	var tickerC <-chan time.Time
 	if w.syncInterval > 0 {
@@ -56,113 +113,415 @@ func (w *Watcher) Start() error {
 		defer ticker.Stop()
 		tickerC = ticker.C
 	}
-	defer func() {
-		if err := w.watcher.Close(); err != nil {
-			slog.Warn("failed to close watcher", "error", err)
-		}
-	}()
+	var connectionC <-chan time.Time
+	if w.connectionCheckInterval > 0 && w.reportsConnection() {
+		connection := time.NewTicker(w.connectionCheckInterval)
+		defer connection.Stop()
+		connectionC = connection.C
+	}
+	var killSwitchC <-chan time.Time
+	if w.killSwitchTimer != nil {
+		defer w.killSwitchTimer.Stop()
+		killSwitchC = w.killSwitchTimer.C
+	}
+	var fileEvents <-chan fsnotify.Event
+	var fileErrors <-chan error
+	if w.watcher != nil {
+		fileEvents = w.watcher.Events
+		fileErrors = w.watcher.Errors
+		defer func() {
+			if err := w.watcher.Close(); err != nil {
+				slog.Warn("failed to close watcher", "error", err)
+			}
+		}()
+	}
+	defer w.background.Wait()
 
-	if err := w.syncPort(); err != nil {
+	if err := w.syncPort(ctx); err != nil {
 		slog.Warn("initial sync failed", "error", err)
 	}
 
+	// The poll ticker starts after the initial sync so its ticks line up
+	// with the lease a renewing source was just granted.
+	var poll *time.Ticker
+	var pollC <-chan time.Time
+	var pollInterval time.Duration
+	if w.source != nil {
+		pollInterval = w.sourcePollInterval()
+		poll = time.NewTicker(pollInterval)
+		defer poll.Stop()
+		pollC = poll.C
+	}
+
 	for {
 		select {
-		case event, ok := <-w.watcher.Events:
+		case <-ctx.Done():
+			slog.Debug("watcher stopping")
+			return nil
+
+		case event, ok := <-fileEvents:
 			if !ok {
 				return fmt.Errorf("watcher channel closed")
 			}
 
 			if event.Name == w.portFile && (event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create) {
 				slog.Debug("port file changed", "event", event.Op.String())
-				if err := w.syncPort(); err != nil {
+				if err := w.syncPort(ctx); err != nil {
 					slog.Error("failed to sync port after file change", "error", err)
-					IncrementSyncErrors()
 				}
 			}
 
-		case err, ok := <-w.watcher.Errors:
+		case err, ok := <-fileErrors:
 			if !ok {
 				return fmt.Errorf("watcher error channel closed")
 			}
 			slog.Error("file watcher error", "error", err)
 
+		case <-pollC:
+			if err := w.pollSource(ctx); err != nil {
+				slog.Warn("failed to sync polled port", "error", err)
+			}
+			if next := w.sourcePollInterval(); next != pollInterval {
+				slog.Info("adjusting port source poll interval", "source", w.source.Name(), "interval", next)
+				pollInterval = next
+				poll.Reset(next)
+			}
+
 		case <-tickerC:
 			slog.Debug("periodic sync triggered")
-			if err := w.syncPort(); err != nil {
+			if err := w.syncPort(ctx); err != nil {
 				slog.Warn("periodic sync failed", "error", err)
 			}
+
+		case <-connectionC:
+			w.checkConnections(ctx)
+
+		case <-killSwitchC:
+			slog.Debug("kill switch delay elapsed, checking port")
+			if err := w.syncPort(ctx); err != nil {
+				slog.Warn("kill switch sync failed", "error", err)
+			}
 		}
 	}
 }
 
-func (w *Watcher) syncPort() error {
-	gluetunPort, err := w.readPortFromFile()
+// Targets returns the configured targets.
+func (w *Watcher) Targets() []Target {
+	targets := make([]Target, 0, len(w.targets))
+	for _, t := range w.targets {
+		targets = append(targets, t.Target)
+	}
+	return targets
+}
+
+// SetPortSelection sets how the port is chosen when the source reports
+// several. The first port is used by default.
+func (w *Watcher) SetPortSelection(selection PortSelection) {
+	w.portSelection = selection
+}
+
+// SetRetryPolicy sets how often a port that does not read back is set again.
+// retry.DefaultPolicy is used by default.
+func (w *Watcher) SetRetryPolicy(policy retry.Policy) {
+	w.verifyRetry = policy
+}
+
+// SetPortFileParser sets the format the port file is read in. A plain port
+// list is read by default.
+func (w *Watcher) SetPortFileParser(parser *PortFileParser) {
+	w.portFileParser = parser
+}
+
+// ForwardedPorts returns every port the source reported on the last read.
+func (w *Watcher) ForwardedPorts() []int {
+	w.portsMu.Lock()
+	defer w.portsMu.Unlock()
+	return slices.Clone(w.forwardedPorts)
+}
+
+// PortDetails returns the extra fields, such as an expiry or the public IP,
+// read next to the port on the last read.
+func (w *Watcher) PortDetails() map[string]string {
+	w.portsMu.Lock()
+	defer w.portsMu.Unlock()
+	return maps.Clone(w.portDetails)
+}
+
+func (w *Watcher) setForwardedPorts(ports []int, details map[string]string) {
+	w.portsMu.Lock()
+	w.forwardedPorts = slices.Clone(ports)
+	w.portDetails = maps.Clone(details)
+	w.portsMu.Unlock()
+	SetForwardedPorts(ports)
+}
+
+// Status returns the latest sync status of every target.
+func (w *Watcher) Status() []TargetStatus {
+	statuses := make([]TargetStatus, 0, len(w.targets))
+	for _, t := range w.targets {
+		statuses = append(statuses, t.snapshot())
+	}
+	return statuses
+}
+
+// syncPort reads the forwarded ports and pushes them to the targets.
+func (w *Watcher) syncPort(ctx context.Context) error {
+	ports, details, errKind, err := w.readPorts(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read Gluetun port: %w", err)
+		return w.readFailed(ctx, errKind, err)
 	}
+	return w.syncPorts(ctx, ports, details)
+}
+
+// readFailed records a failure to read the ports against every target, since
+// none of them can be synced without a port.
+func (w *Watcher) readFailed(ctx context.Context, errKind string, err error) error {
+	for _, t := range w.targets {
+		t.recordError(err, errKind)
+		IncrementSyncErrors(t.Name, errKind)
+	}
+	w.lastPolledPorts = nil
+	w.setForwardedPorts(nil, nil)
+	w.portUnavailable(ctx)
+	return fmt.Errorf("failed to read Gluetun port: %w", err)
+}
 
-	// If port is 0, it means we should skip this sync (invalid/empty port file)
+// syncPorts pushes the selected port to every target concurrently, so a slow
+// or failing target does not hold up the others.
+func (w *Watcher) syncPorts(ctx context.Context, ports []int, details map[string]string) error {
+	w.lastPolledPorts = ports
+	w.setForwardedPorts(ports, details)
+
+	// Without a selected port (invalid/empty port file) the sync is skipped
+	gluetunPort := w.portSelection.selectPort(ports)
 	if gluetunPort == 0 {
+		if len(ports) > 0 {
+			slog.Warn("no port at the selected position, skipping sync", "selection", w.portSelection, "ports", ports)
+		}
+		w.portUnavailable(ctx)
 		return nil
 	}
+	w.portAvailable()
+
+	SetCurrentPort(gluetunPort)
+
+	errs := make([]error, len(w.targets))
+	var wg gosync.WaitGroup
+	for i, t := range w.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			port := gluetunPort
+			if t.PortIndex > 0 {
+				if port = portAt(ports, t.PortIndex); port == 0 {
+					err := fmt.Errorf("no forwarded port at position %d, the source reports %d", t.PortIndex, len(ports))
+					t.recordError(err, errorKindPortIndex)
+					IncrementSyncErrors(t.Name, errorKindPortIndex)
+					errs[i] = fmt.Errorf("target %s: %w", t.Name, err)
+					return
+				}
+			}
+
+			if err := w.syncTarget(ctx, t, port); err != nil {
+				// A sync cut short by shutdown says nothing about the target.
+				if ctx.Err() != nil {
+					errs[i] = err
+					return
+				}
+				kind := string(torrent.KindOf(err))
+				t.recordError(err, kind)
+				IncrementSyncErrors(t.Name, kind)
+				errs[i] = fmt.Errorf("target %s: %w", t.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// syncTarget enforces any pinned backend settings and then syncs the port. A
+// settings failure is reported but does not block the port update.
+func (w *Watcher) syncTarget(ctx context.Context, t *targetState, gluetunPort int) error {
+	if t.refreshVersion() {
+		t.publishClientInfo()
+	}
+
+	var enforceErr error
+	if enforcer, ok := t.Client.(torrent.SettingsEnforcer); ok {
+		if err := enforcer.EnforceSettings(ctx); err != nil {
+			slog.Warn("failed to enforce client settings", "target", t.Name, "client", t.Client.Name(), "error", err)
+			enforceErr = fmt.Errorf("failed to enforce %s settings: %w", t.Client.Name(), err)
+		}
+	}
+
+	if err := w.syncTargetPort(ctx, t, gluetunPort); err != nil {
+		return err
+	}
+	w.resumePaused(ctx, t)
+	w.checkConnection(ctx, t, gluetunPort)
+	return enforceErr
+}
 
-	qbitPort, err := w.qbitClient.GetPort()
+func (w *Watcher) syncTargetPort(ctx context.Context, t *targetState, gluetunPort int) error {
+	clientName := t.Client.Name()
+	clientPort, err := t.Client.GetPort(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get qBittorrent port: %w", err)
+		return fmt.Errorf("failed to get %s port: %w", clientName, err)
 	}
 
-	slog.Debug("port status", "gluetun_port", gluetunPort, "qbit_port", qbitPort)
+	t.recordObserved(gluetunPort, clientPort)
 
-	if gluetunPort != qbitPort {
-		slog.Info("port mismatch detected, updating...", "old_port", qbitPort, "new_port", gluetunPort)
-		if err := w.qbitClient.SetPort(gluetunPort); err != nil {
-			IncrementSyncErrors()
-			return fmt.Errorf("failed to set qBittorrent port: %w", err)
+	slog.Debug("port status", "target", t.Name, "gluetun_port", gluetunPort, "client_port", clientPort, "client", clientName)
+
+	if gluetunPort == clientPort {
+		slog.Debug("ports are in sync", "target", t.Name, "port", gluetunPort)
+		t.recordSuccess(clientPort)
+		SetTargetPort(t.Name, clientPort)
+		return nil
+	}
+
+	slog.Info("port mismatch detected, updating...", "target", t.Name, "old_port", clientPort, "new_port", gluetunPort, "client", clientName)
+	if err := w.setAndVerify(ctx, t, clientPort, gluetunPort); err != nil {
+		return err
+	}
+
+	t.recordSuccess(gluetunPort)
+	SetTargetPort(t.Name, gluetunPort)
+	IncrementSyncTotal(t.Name)
+	UpdateLastSyncTimestamp(t.Name)
+
+	// Send webhook notification if webhook client is configured
+	if w.webhookClient != nil {
+		if err := w.webhookClient.SendPortChange(ctx, t.Name, clientPort, gluetunPort, w.PortDetails()); err != nil {
+			slog.Warn("failed to send webhook notification", "target", t.Name, "error", err)
 		}
+	}
 
-		w.lastPort = gluetunPort
-		SetCurrentPort(gluetunPort)
-		IncrementSyncTotal()
-		UpdateLastSyncTimestamp()
+	w.reannounce(ctx, t, clientPort, gluetunPort)
+	w.testPort(ctx, t, gluetunPort)
+
+	return nil
+}
+
+// setAndVerify sets the port and reads it back, because some clients answer
+// success while ignoring an invalid or conflicting port. A mismatch is retried
+// and then reported as verification_failed.
+func (w *Watcher) setAndVerify(ctx context.Context, t *targetState, oldPort, port int) error {
+	clientName := t.Client.Name()
+	// Failures to set or read the port were already retried by the client;
+	// only a port that does not read back is tried again here.
+	policy := w.verifyRetry
+	policy.Retryable = func(err error) bool {
+		return torrent.KindOf(err) == torrent.KindVerificationFailed
+	}
+
+	actual := 0
+	attempts, err := policy.Do(ctx, "port verification for "+t.Name, func(ctx context.Context) error {
+		if err := t.Client.SetPort(ctx, port); err != nil {
+			return fmt.Errorf("failed to set %s port: %w", clientName, err)
+		}
+
+		var err error
+		actual, err = t.Client.GetPort(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read back %s port: %w", clientName, err)
+		}
+		t.recordObserved(port, actual)
+		if actual != port {
+			return torrent.NewError(torrent.KindVerificationFailed,
+				fmt.Errorf("%s reports port %d after it was set to %d", clientName, actual, port))
+		}
+		return nil
+	})
+	if err == nil || torrent.KindOf(err) != torrent.KindVerificationFailed {
+		return err
+	}
+
+	err = fmt.Errorf("port verification failed after %d attempts: %w", attempts, err)
+	if w.webhookClient != nil {
+		if sendErr := w.webhookClient.SendVerificationFailed(ctx, t.Name, oldPort, port, actual, err); sendErr != nil {
+			slog.Warn("failed to send webhook notification", "target", t.Name, "error", sendErr)
+		}
+	}
+	return err
+}
+
+// reannounce asks the target's trackers to pick up the new port. It runs in
+// the background because rate-limited batches can take a while; a change that
+// arrives while one is still running does not start a second one.
+func (w *Watcher) reannounce(ctx context.Context, t *targetState, oldPort, newPort int) {
+	reannouncer, ok := t.Client.(torrent.Reannouncer)
+	if !ok || !reannouncer.ReannounceEnabled() {
+		return
+	}
+	if !t.reannouncing.CompareAndSwap(false, true) {
+		slog.Warn("reannounce already in progress, skipping", "target", t.Name, "port", newPort)
+		return
+	}
+
+	w.background.Add(1)
+	go func() {
+		defer w.background.Done()
+		defer t.reannouncing.Store(false)
+
+		count, err := reannouncer.Reannounce(ctx)
+		RecordReannounce(t.Name, count, err)
+		if err != nil {
+			slog.Error("tracker reannounce failed", "target", t.Name, "port", newPort, "reannounced", count, "error", err)
+		} else {
+			slog.Info("reannounced torrents to trackers", "target", t.Name, "port", newPort, "torrents", count)
+		}
 
-		// Send webhook notification if webhook client is configured
 		if w.webhookClient != nil {
-			if err := w.webhookClient.SendPortChange(qbitPort, gluetunPort); err != nil {
-				slog.Warn("failed to send webhook notification", "error", err)
+			if err := w.webhookClient.SendReannounce(ctx, t.Name, oldPort, newPort, count, err); err != nil {
+				slog.Warn("failed to send webhook notification", "target", t.Name, "error", err)
 			}
 		}
-	} else {
-		slog.Debug("ports are in sync", "port", gluetunPort)
+	}()
+}
+
+// testPort asks the target to check from outside whether the new port is
+// reachable. It runs in the background so the external round-trip stays off
+// the sync path; the result is only logged, since a freshly forwarded port may
+// take a moment to become reachable.
+func (w *Watcher) testPort(ctx context.Context, t *targetState, port int) {
+	tester, ok := t.Client.(torrent.PortTester)
+	if !ok {
+		return
 	}
 
-	return nil
+	w.background.Add(1)
+	go func() {
+		defer w.background.Done()
+
+		open, err := tester.PortTest(ctx)
+		if err != nil {
+			slog.Warn("port test failed", "target", t.Name, "port", port, "error", err)
+			return
+		}
+		slog.Info("port test completed", "target", t.Name, "port", port, "port_is_open", open)
+	}()
 }
 
-func (w *Watcher) readPortFromFile() (int, error) {
+// readPortsFromFile returns the ports in the port file and the extra fields
+// its format carries next to them.
+func (w *Watcher) readPortsFromFile() ([]int, map[string]string, error) {
 	content, err := os.ReadFile(w.portFile)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read port file: %w", err)
+		return nil, nil, fmt.Errorf("failed to read port file: %w", err)
 	}
 
-	portStr := strings.TrimSpace(string(content))
-
 	// Handle empty file gracefully (common during Gluetun restart)
-	if portStr == "" {
+	if strings.TrimSpace(string(content)) == "" {
 		slog.Warn("port file is empty, skipping sync (Gluetun may be restarting)")
-		return 0, nil
-	}
-
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		slog.Warn("invalid port value in file, skipping sync", "value", portStr, "error", err)
-		return 0, nil
+		return nil, nil, nil
 	}
 
-	if port < 1 || port > 65535 {
-		slog.Warn("port out of valid range, skipping sync", "port", port)
-		return 0, nil
+	parser := w.portFileParser
+	if parser == nil {
+		parser = &PortFileParser{format: PortFileFormatPlain}
 	}
-
-	return port, nil
+	ports, details := parser.parse(string(content))
+	return ports, details, nil
 }
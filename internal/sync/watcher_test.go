@@ -1,19 +1,31 @@
 package sync
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
 	"github.com/eslutz/forwardarr/internal/qbit"
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
 	"github.com/eslutz/forwardarr/internal/webhook"
 )
 
-func TestReadPortFromFile_Success(t *testing.T) {
+func TestReadPortsFromFile_Success(t *testing.T) {
 	// Create a temporary directory
 	tmpDir := t.TempDir()
 	portFile := filepath.Join(tmpDir, "forwarded_port")
@@ -25,12 +37,456 @@ func TestReadPortFromFile_Success(t *testing.T) {
 	}
 
 	w := &Watcher{portFile: portFile}
-	port, err := w.readPortFromFile()
+	ports, _, err := w.readPortsFromFile()
 	if err != nil {
-		t.Fatalf("readPortFromFile() error = %v, want nil", err)
+		t.Fatalf("readPortsFromFile() error = %v, want nil", err)
+	}
+	if !slices.Equal(ports, []int{12345}) {
+		t.Errorf("readPortsFromFile() = %v, want [12345]", ports)
+	}
+}
+
+// fakeClient is an in-memory torrent.Client for watcher tests.
+type fakeClient struct {
+	port     int
+	getErr   error
+	setErr   error
+	getCalls int
+	setCalls int
+	// ignoreSet accepts SetPort without changing the port.
+	ignoreSet bool
+}
+
+func (f *fakeClient) Name() string { return "fake" }
+
+func (f *fakeClient) GetPort(context.Context) (int, error) {
+	f.getCalls++
+	if f.getErr != nil {
+		return 0, f.getErr
+	}
+	return f.port, nil
+}
+
+func (f *fakeClient) SetPort(_ context.Context, port int) error {
+	f.setCalls++
+	if f.setErr != nil {
+		return f.setErr
+	}
+	if f.ignoreSet {
+		return nil
+	}
+	f.port = port
+	return nil
+}
+
+func (f *fakeClient) Ping(context.Context) error { return nil }
+
+// newTestWatcher builds a watcher with one target per client, named
+// "target-0", "target-1" and so on.
+func newTestWatcher(portFile string, webhookClient *webhook.Client, clients ...torrent.Client) *Watcher {
+	targets := make([]Target, 0, len(clients))
+	for i, client := range clients {
+		targets = append(targets, Target{Name: fmt.Sprintf("target-%d", i), Client: client})
+	}
+	return &Watcher{portFile: portFile, targets: newTargetStates(targets), webhookClient: webhookClient}
+}
+
+func writePortFile(t *testing.T, content string) string {
+	t.Helper()
+	portFile := filepath.Join(t.TempDir(), "forwarded_port")
+	if err := os.WriteFile(portFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write port file: %v", err)
+	}
+	return portFile
+}
+
+func TestWatcherSyncPortWithFakeClient(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		client       *fakeClient
+		wantErr      bool
+		wantPort     int
+		wantGetCalls int
+		wantSetCalls int
+	}{
+		{
+			name:         "updates mismatched port",
+			content:      "51413",
+			client:       &fakeClient{port: 6881},
+			wantPort:     51413,
+			wantGetCalls: 2,
+			wantSetCalls: 1,
+		},
+		{
+			name:         "leaves matching port alone",
+			content:      "51413",
+			client:       &fakeClient{port: 51413},
+			wantPort:     51413,
+			wantGetCalls: 1,
+		},
+		{
+			name:     "skips empty port file",
+			content:  "",
+			client:   &fakeClient{port: 6881},
+			wantPort: 6881,
+		},
+		{
+			name:         "get port error",
+			content:      "51413",
+			client:       &fakeClient{port: 6881, getErr: errors.New("unreachable")},
+			wantErr:      true,
+			wantPort:     6881,
+			wantGetCalls: 1,
+		},
+		{
+			name:         "set port error",
+			content:      "51413",
+			client:       &fakeClient{port: 6881, setErr: errors.New("rejected")},
+			wantErr:      true,
+			wantPort:     6881,
+			wantGetCalls: 1,
+			wantSetCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watcher := newTestWatcher(writePortFile(t, tt.content), nil, tt.client)
+			err := watcher.syncPort(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("syncPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.client.port != tt.wantPort {
+				t.Errorf("client port = %d, want %d", tt.client.port, tt.wantPort)
+			}
+			if tt.client.getCalls != tt.wantGetCalls {
+				t.Errorf("GetPort calls = %d, want %d", tt.client.getCalls, tt.wantGetCalls)
+			}
+			if tt.client.setCalls != tt.wantSetCalls {
+				t.Errorf("SetPort calls = %d, want %d", tt.client.setCalls, tt.wantSetCalls)
+			}
+		})
+	}
+}
+
+func TestWatcherSyncPortFanOut(t *testing.T) {
+	public := &fakeClient{port: 6881}
+	private := &fakeClient{port: 6881, setErr: errors.New("rejected")}
+	watcher := newTestWatcher(writePortFile(t, "51413"), nil, public, private)
+
+	err := watcher.syncPort(context.Background())
+	if err == nil {
+		t.Fatal("syncPort() error = nil, want error from failing target")
+	}
+	if !strings.Contains(err.Error(), "target-1") {
+		t.Errorf("syncPort() error = %v, want it to name target-1", err)
+	}
+
+	if public.port != 51413 {
+		t.Errorf("healthy target port = %d, want 51413", public.port)
+	}
+
+	statuses := watcher.Status()
+	if len(statuses) != 2 {
+		t.Fatalf("Status() returned %d entries, want 2", len(statuses))
+	}
+	if statuses[0].Name != "target-0" || statuses[0].Type != "fake" || statuses[0].Port != 51413 || statuses[0].LastError != "" {
+		t.Errorf("healthy target status = %+v", statuses[0])
+	}
+	if statuses[0].LastSync.IsZero() {
+		t.Error("healthy target LastSync is zero, want timestamp")
+	}
+	if statuses[1].LastError == "" {
+		t.Errorf("failing target status = %+v, want LastError", statuses[1])
+	}
+}
+
+func TestWatcherSyncPortFanOutWebhookTarget(t *testing.T) {
+	var mu gosync.Mutex
+	targets := map[string]int{}
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhook.Payload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode webhook payload: %v", err)
+		}
+		mu.Lock()
+		targets[payload.Target] = payload.NewPort
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhookServer.Close()
+
+	webhookClient := webhook.NewClient(webhookServer.URL, 5*time.Second, webhook.TemplateJSON, []string{"port_changed"})
+	watcher := newTestWatcher(writePortFile(t, "51413"), webhookClient, &fakeClient{port: 1}, &fakeClient{port: 2})
+
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+	if targets["target-0"] != 51413 || targets["target-1"] != 51413 {
+		t.Errorf("webhook targets = %v, want both targets at 51413", targets)
+	}
+}
+
+// enforcingClient is a fakeClient that also implements torrent.SettingsEnforcer.
+type enforcingClient struct {
+	fakeClient
+	enforceErr   error
+	enforceCalls int
+}
+
+func (e *enforcingClient) EnforceSettings(context.Context) error {
+	e.enforceCalls++
+	return e.enforceErr
+}
+
+func TestWatcherSyncPortEnforcesSettings(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientPort int
+		enforceErr error
+		wantErr    bool
+	}{
+		{name: "in sync", clientPort: 51413},
+		{name: "port changed", clientPort: 6881},
+		{name: "enforcement fails", clientPort: 6881, enforceErr: errors.New("rejected"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &enforcingClient{fakeClient: fakeClient{port: tt.clientPort}, enforceErr: tt.enforceErr}
+			watcher := newTestWatcher(writePortFile(t, "51413"), nil, client)
+
+			err := watcher.syncPort(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("syncPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if client.enforceCalls != 1 {
+				t.Errorf("EnforceSettings calls = %d, want 1", client.enforceCalls)
+			}
+			// A settings failure must not block the port update.
+			if client.port != 51413 {
+				t.Errorf("client port = %d, want 51413", client.port)
+			}
+		})
+	}
+}
+
+// reannouncingClient is a fakeClient that also implements torrent.Reannouncer.
+type reannouncingClient struct {
+	fakeClient
+	count           int
+	err             error
+	reannounceCalls atomic.Int32
+}
+
+func (r *reannouncingClient) ReannounceEnabled() bool { return true }
+
+func (r *reannouncingClient) Reannounce(context.Context) (int, error) {
+	r.reannounceCalls.Add(1)
+	return r.count, r.err
+}
+
+func TestWatcherSyncPortReannounces(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientPort int
+		err        error
+		wantCalls  int32
+		wantEvent  string
+	}{
+		{name: "after port change", clientPort: 6881, wantCalls: 1, wantEvent: webhook.EventReannounceComplete},
+		{name: "failure is reported", clientPort: 6881, err: errors.New("tracker down"), wantCalls: 1, wantEvent: webhook.EventReannounceFailed},
+		{name: "not when in sync", clientPort: 51413, wantCalls: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu gosync.Mutex
+			var events []string
+			webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var payload webhook.Payload
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("failed to decode webhook payload: %v", err)
+				}
+				mu.Lock()
+				events = append(events, payload.Event)
+				mu.Unlock()
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer webhookServer.Close()
+
+			webhookClient := webhook.NewClient(webhookServer.URL, time.Second, webhook.TemplateJSON, nil)
+			client := &reannouncingClient{fakeClient: fakeClient{port: tt.clientPort}, count: 3, err: tt.err}
+			watcher := newTestWatcher(writePortFile(t, "51413"), webhookClient, client)
+
+			if err := watcher.syncPort(context.Background()); err != nil {
+				t.Fatalf("syncPort() error = %v", err)
+			}
+			watcher.background.Wait()
+
+			if got := client.reannounceCalls.Load(); got != tt.wantCalls {
+				t.Errorf("Reannounce calls = %d, want %d", got, tt.wantCalls)
+			}
+			if tt.wantEvent != "" && !slices.Contains(events, tt.wantEvent) {
+				t.Errorf("webhook events = %v, want %s", events, tt.wantEvent)
+			}
+		})
+	}
+}
+
+// portTestingClient is a fakeClient that also implements torrent.PortTester.
+type portTestingClient struct {
+	fakeClient
+	portTests atomic.Int32
+}
+
+func (p *portTestingClient) PortTest(context.Context) (bool, error) {
+	p.portTests.Add(1)
+	return true, nil
+}
+
+func TestWatcherSyncPortTestsPort(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientPort int
+		ignoreSet  bool
+		wantTests  int32
+	}{
+		{name: "once after a verified change", clientPort: 6881, wantTests: 1},
+		{name: "not when in sync", clientPort: 51413, wantTests: 0},
+		{name: "not when verification fails", clientPort: 6881, ignoreSet: true, wantTests: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &portTestingClient{fakeClient: fakeClient{port: tt.clientPort, ignoreSet: tt.ignoreSet}}
+			watcher := newTestWatcher(writePortFile(t, "51413"), nil, client)
+			watcher.SetRetryPolicy(retry.Policy{Attempts: 3})
+
+			_ = watcher.syncPort(context.Background())
+			watcher.background.Wait()
+
+			if got := client.portTests.Load(); got != tt.wantTests {
+				t.Errorf("PortTest calls = %d, want %d", got, tt.wantTests)
+			}
+		})
+	}
+}
+
+func TestWatcherSyncPortRecordsErrorKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   *fakeClient
+		portFile string
+		want     string
+	}{
+		{
+			name:   "typed client error",
+			client: &fakeClient{getErr: torrent.NewError(torrent.KindBadCredentials, errors.New("Fails."))},
+			want:   string(torrent.KindBadCredentials),
+		},
+		{name: "unclassified client error", client: &fakeClient{getErr: errors.New("boom")}, want: string(torrent.KindOther)},
+		{name: "missing port file", client: &fakeClient{}, portFile: "/nonexistent/forwarded_port", want: errorKindPortFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portFile := tt.portFile
+			if portFile == "" {
+				portFile = writePortFile(t, "51413")
+			}
+			watcher := newTestWatcher(portFile, nil, tt.client)
+			targetName := watcher.targets[0].Name
+			baseline := testutil.ToFloat64(syncErrors.WithLabelValues(targetName, tt.want))
+
+			if err := watcher.syncPort(context.Background()); err == nil {
+				t.Fatal("syncPort() error = nil, want error")
+			}
+
+			status := watcher.Status()[0]
+			if status.LastErrorKind != tt.want {
+				t.Errorf("LastErrorKind = %q, want %q", status.LastErrorKind, tt.want)
+			}
+			if got := testutil.ToFloat64(syncErrors.WithLabelValues(targetName, tt.want)); got != baseline+1 {
+				t.Errorf("syncErrors{kind=%q} = %v, want %v", tt.want, got, baseline+1)
+			}
+		})
+	}
+}
+
+// versionedClient reports a version that can change between syncs.
+type versionedClient struct {
+	fakeClient
+	app, api string
+}
+
+func (v *versionedClient) Version() (string, string) { return v.app, v.api }
+
+func TestWatcherSyncPortReportsClientVersion(t *testing.T) {
+	client := &versionedClient{fakeClient: fakeClient{port: 51413}, app: "v4.6.3", api: "2.9.3"}
+	watcher := newTestWatcher(writePortFile(t, "51413"), nil, client)
+	targetName := watcher.targets[0].Name
+
+	status := watcher.Status()[0]
+	if status.Version != "v4.6.3" || status.APIVersion != "2.9.3" {
+		t.Errorf("initial versions = %q/%q, want v4.6.3/2.9.3", status.Version, status.APIVersion)
+	}
+	if got := testutil.ToFloat64(clientInfo.WithLabelValues(targetName, "fake", "v4.6.3", "2.9.3")); got != 1 {
+		t.Errorf("clientInfo = %v, want 1", got)
+	}
+
+	client.app, client.api = "v5.0.2", "2.11.2"
+	if err := watcher.syncPort(context.Background()); err != nil {
+		t.Fatalf("syncPort() error = %v", err)
+	}
+
+	status = watcher.Status()[0]
+	if status.Version != "v5.0.2" || status.APIVersion != "2.11.2" {
+		t.Errorf("versions after upgrade = %q/%q, want v5.0.2/2.11.2", status.Version, status.APIVersion)
+	}
+	if got := clientInfo.DeletePartialMatch(prometheus.Labels{"target": targetName}); got != 1 {
+		t.Errorf("clientInfo series = %d, want 1 after the old version is replaced", got)
+	}
+}
+
+func TestWatcherSyncPortVerificationFailed(t *testing.T) {
+	var received webhook.Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode webhook payload: %v", err)
+		}
+	}))
+	defer server.Close()
+	webhookClient := webhook.NewClient(server.URL, time.Second, webhook.TemplateJSON, []string{webhook.EventPortChanged, webhook.EventVerificationFailed})
+
+	client := &fakeClient{port: 6881, ignoreSet: true}
+	watcher := newTestWatcher(writePortFile(t, "51413"), webhookClient, client)
+	watcher.SetRetryPolicy(retry.Policy{Attempts: 3})
+
+	err := watcher.syncPort(context.Background())
+	if torrent.KindOf(err) != torrent.KindVerificationFailed {
+		t.Fatalf("syncPort() error = %v, want verification_failed", err)
+	}
+	if client.setCalls != 3 || client.getCalls != 4 {
+		t.Errorf("SetPort/GetPort calls = %d/%d, want 3/4", client.setCalls, client.getCalls)
 	}
-	if port != 12345 {
-		t.Errorf("readPortFromFile() = %d, want 12345", port)
+
+	status := watcher.Status()[0]
+	if status.ExpectedPort != 51413 || status.ActualPort != 6881 {
+		t.Errorf("expected/actual ports = %d/%d, want 51413/6881", status.ExpectedPort, status.ActualPort)
+	}
+	if status.LastErrorKind != string(torrent.KindVerificationFailed) {
+		t.Errorf("LastErrorKind = %q, want verification_failed", status.LastErrorKind)
+	}
+	if received.Event != webhook.EventVerificationFailed || received.NewPort != 51413 || received.ActualPort != 6881 {
+		t.Errorf("webhook payload = %+v", received)
+	}
+}
+
+func TestNewWatcherRequiresTargets(t *testing.T) {
+	if _, err := NewWatcher(writePortFile(t, "1"), nil, nil, 0); err == nil {
+		t.Error("NewWatcher() error = nil, want error without targets")
 	}
 }
 
@@ -110,13 +566,13 @@ func TestWatcherSyncPortUpdatesPort(t *testing.T) {
 	server, port, _, setPortCalls := newTestQbitServer(t, 8080, 0, 0)
 	defer server.Close()
 
-	client, err := qbit.NewClient(server.URL, "user", "pass")
+	client, err := qbit.NewClient(context.Background(), server.URL, "user", "pass")
 	if err != nil {
 		t.Fatalf("NewClient() error = %v", err)
 	}
 
-	watcher := &Watcher{portFile: portFile, qbitClient: client, webhookClient: nil}
-	if err := watcher.syncPort(); err != nil {
+	watcher := newTestWatcher(portFile, nil, client)
+	if err := watcher.syncPort(context.Background()); err != nil {
 		t.Fatalf("syncPort() error = %v", err)
 	}
 
@@ -126,8 +582,8 @@ func TestWatcherSyncPortUpdatesPort(t *testing.T) {
 	if *setPortCalls != 1 {
 		t.Fatalf("SetPreferences call count = %d, want 1", *setPortCalls)
 	}
-	if watcher.lastPort != 9090 {
-		t.Fatalf("watcher.lastPort = %d, want 9090", watcher.lastPort)
+	if status := watcher.Status()[0]; status.Port != 9090 || status.LastError != "" {
+		t.Fatalf("target status = %+v, want port 9090 without error", status)
 	}
 }
 
@@ -141,13 +597,13 @@ func TestWatcherSyncPortAlreadyInSync(t *testing.T) {
 	server, port, _, setPortCalls := newTestQbitServer(t, 1234, 0, 0)
 	defer server.Close()
 
-	client, err := qbit.NewClient(server.URL, "user", "pass")
+	client, err := qbit.NewClient(context.Background(), server.URL, "user", "pass")
 	if err != nil {
 		t.Fatalf("NewClient() error = %v", err)
 	}
 
-	watcher := &Watcher{portFile: portFile, qbitClient: client, webhookClient: nil}
-	if err := watcher.syncPort(); err != nil {
+	watcher := newTestWatcher(portFile, nil, client)
+	if err := watcher.syncPort(context.Background()); err != nil {
 		t.Fatalf("syncPort() error = %v", err)
 	}
 
@@ -169,13 +625,14 @@ func TestWatcherSyncPortGetPortError(t *testing.T) {
 	server, _, _, setPortCalls := newTestQbitServer(t, 1111, http.StatusInternalServerError, 0)
 	defer server.Close()
 
-	client, err := qbit.NewClient(server.URL, "user", "pass")
+	client, err := qbit.NewClient(context.Background(), server.URL, "user", "pass")
 	if err != nil {
 		t.Fatalf("NewClient() error = %v", err)
 	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3})
 
-	watcher := &Watcher{portFile: portFile, qbitClient: client, webhookClient: nil}
-	if err := watcher.syncPort(); err == nil {
+	watcher := newTestWatcher(portFile, nil, client)
+	if err := watcher.syncPort(context.Background()); err == nil {
 		t.Fatal("syncPort() error = nil, want error")
 	}
 	if *setPortCalls != 0 {
@@ -193,13 +650,14 @@ func TestWatcherSyncPortSetPortError(t *testing.T) {
 	server, port, _, setPortCalls := newTestQbitServer(t, 4000, 0, http.StatusInternalServerError)
 	defer server.Close()
 
-	client, err := qbit.NewClient(server.URL, "user", "pass")
+	client, err := qbit.NewClient(context.Background(), server.URL, "user", "pass")
 	if err != nil {
 		t.Fatalf("NewClient() error = %v", err)
 	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3})
 
-	watcher := &Watcher{portFile: portFile, qbitClient: client, webhookClient: nil}
-	if err := watcher.syncPort(); err == nil {
+	watcher := newTestWatcher(portFile, nil, client)
+	if err := watcher.syncPort(context.Background()); err == nil {
 		t.Fatal("syncPort() error = nil, want error")
 	}
 
@@ -211,7 +669,7 @@ func TestWatcherSyncPortSetPortError(t *testing.T) {
 	}
 }
 
-func TestReadPortFromFile_WithWhitespace(t *testing.T) {
+func TestReadPortsFromFile_WithWhitespace(t *testing.T) {
 	tmpDir := t.TempDir()
 	portFile := filepath.Join(tmpDir, "forwarded_port")
 
@@ -222,24 +680,24 @@ func TestReadPortFromFile_WithWhitespace(t *testing.T) {
 	}
 
 	w := &Watcher{portFile: portFile}
-	port, err := w.readPortFromFile()
+	ports, _, err := w.readPortsFromFile()
 	if err != nil {
-		t.Fatalf("readPortFromFile() error = %v, want nil", err)
+		t.Fatalf("readPortsFromFile() error = %v, want nil", err)
 	}
-	if port != 54321 {
-		t.Errorf("readPortFromFile() = %d, want 54321", port)
+	if !slices.Equal(ports, []int{54321}) {
+		t.Errorf("readPortsFromFile() = %v, want [54321]", ports)
 	}
 }
 
-func TestReadPortFromFile_FileNotFound(t *testing.T) {
+func TestReadPortsFromFile_FileNotFound(t *testing.T) {
 	w := &Watcher{portFile: "/nonexistent/path/port"}
-	_, err := w.readPortFromFile()
+	_, _, err := w.readPortsFromFile()
 	if err == nil {
-		t.Error("readPortFromFile() error = nil, want error")
+		t.Error("readPortsFromFile() error = nil, want error")
 	}
 }
 
-func TestReadPortFromFile_InvalidPort(t *testing.T) {
+func TestReadPortsFromFile_InvalidPort(t *testing.T) {
 	tmpDir := t.TempDir()
 	portFile := filepath.Join(tmpDir, "forwarded_port")
 
@@ -250,16 +708,16 @@ func TestReadPortFromFile_InvalidPort(t *testing.T) {
 	}
 
 	w := &Watcher{portFile: portFile}
-	port, err := w.readPortFromFile()
+	ports, _, err := w.readPortsFromFile()
 	if err != nil {
-		t.Errorf("readPortFromFile() error = %v, want nil (graceful handling)", err)
+		t.Errorf("readPortsFromFile() error = %v, want nil (graceful handling)", err)
 	}
-	if port != 0 {
-		t.Errorf("readPortFromFile() = %d, want 0", port)
+	if len(ports) != 0 {
+		t.Errorf("readPortsFromFile() = %v, want none", ports)
 	}
 }
 
-func TestReadPortFromFile_EmptyFile(t *testing.T) {
+func TestReadPortsFromFile_EmptyFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	portFile := filepath.Join(tmpDir, "forwarded_port")
 
@@ -270,16 +728,16 @@ func TestReadPortFromFile_EmptyFile(t *testing.T) {
 	}
 
 	w := &Watcher{portFile: portFile}
-	port, err := w.readPortFromFile()
+	ports, _, err := w.readPortsFromFile()
 	if err != nil {
-		t.Errorf("readPortFromFile() error = %v, want nil (graceful handling)", err)
+		t.Errorf("readPortsFromFile() error = %v, want nil (graceful handling)", err)
 	}
-	if port != 0 {
-		t.Errorf("readPortFromFile() = %d, want 0", port)
+	if len(ports) != 0 {
+		t.Errorf("readPortsFromFile() = %v, want none", ports)
 	}
 }
 
-func TestReadPortFromFile_PortOutOfRange(t *testing.T) {
+func TestReadPortsFromFile_PortOutOfRange(t *testing.T) {
 	tests := []struct {
 		name string
 		port string
@@ -301,18 +759,18 @@ func TestReadPortFromFile_PortOutOfRange(t *testing.T) {
 			}
 
 			w := &Watcher{portFile: portFile}
-			port, err := w.readPortFromFile()
+			ports, _, err := w.readPortsFromFile()
 			if err != nil {
-				t.Errorf("readPortFromFile() with port %s: error = %v, want nil (graceful handling)", tt.port, err)
+				t.Errorf("readPortsFromFile() with port %s: error = %v, want nil (graceful handling)", tt.port, err)
 			}
-			if port != 0 {
-				t.Errorf("readPortFromFile() with port %s: port = %d, want 0", tt.port, port)
+			if len(ports) != 0 {
+				t.Errorf("readPortsFromFile() with port %s: ports = %v, want none", tt.port, ports)
 			}
 		})
 	}
 }
 
-func TestReadPortFromFile_ValidEdgeCases(t *testing.T) {
+func TestReadPortsFromFile_ValidEdgeCases(t *testing.T) {
 	tests := []struct {
 		name     string
 		port     string
@@ -334,12 +792,12 @@ func TestReadPortFromFile_ValidEdgeCases(t *testing.T) {
 			}
 
 			w := &Watcher{portFile: portFile}
-			port, err := w.readPortFromFile()
+			ports, _, err := w.readPortsFromFile()
 			if err != nil {
-				t.Errorf("readPortFromFile() error = %v, want nil", err)
+				t.Errorf("readPortsFromFile() error = %v, want nil", err)
 			}
-			if port != tt.expected {
-				t.Errorf("readPortFromFile() = %d, want %d", port, tt.expected)
+			if !slices.Equal(ports, []int{tt.expected}) {
+				t.Errorf("readPortsFromFile() = %v, want [%d]", ports, tt.expected)
 			}
 		})
 	}
@@ -356,7 +814,7 @@ func TestWatcherSyncPortWithWebhook(t *testing.T) {
 	qbitServer, port, _, setPortCalls := newTestQbitServer(t, 5050, 0, 0)
 	defer qbitServer.Close()
 
-	qbitClient, err := qbit.NewClient(qbitServer.URL, "user", "pass")
+	qbitClient, err := qbit.NewClient(context.Background(), qbitServer.URL, "user", "pass")
 	if err != nil {
 		t.Fatalf("NewClient() error = %v", err)
 	}
@@ -383,8 +841,8 @@ func TestWatcherSyncPortWithWebhook(t *testing.T) {
 	// Create webhook client
 	webhookClient := webhook.NewClient(webhookServer.URL, 5*time.Second, webhook.TemplateJSON, []string{"port_changed"})
 
-	watcher := &Watcher{portFile: portFile, qbitClient: qbitClient, webhookClient: webhookClient}
-	if err := watcher.syncPort(); err != nil {
+	watcher := newTestWatcher(portFile, webhookClient, qbitClient)
+	if err := watcher.syncPort(context.Background()); err != nil {
 		t.Fatalf("syncPort() error = %v", err)
 	}
 
@@ -428,13 +886,13 @@ func TestWatcherSyncPortSkipsInvalidPort(t *testing.T) {
 			server, port, getPortCalls, setPortCalls := newTestQbitServer(t, 8080, 0, 0)
 			defer server.Close()
 
-			client, err := qbit.NewClient(server.URL, "user", "pass")
+			client, err := qbit.NewClient(context.Background(), server.URL, "user", "pass")
 			if err != nil {
 				t.Fatalf("NewClient() error = %v", err)
 			}
 
-			watcher := &Watcher{portFile: portFile, qbitClient: client, webhookClient: nil}
-			if err := watcher.syncPort(); err != nil {
+			watcher := newTestWatcher(portFile, nil, client)
+			if err := watcher.syncPort(context.Background()); err != nil {
 				t.Fatalf("syncPort() error = %v, want nil (graceful handling)", err)
 			}
 
@@ -453,3 +911,34 @@ func TestWatcherSyncPortSkipsInvalidPort(t *testing.T) {
 		})
 	}
 }
+
+func TestWatcherStartStopsOnCancel(t *testing.T) {
+	// The client never applies the port, so the first sync waits in the
+	// verification retry until the context is cancelled.
+	client := &fakeClient{port: 6881, ignoreSet: true}
+	portFile := writePortFile(t, "51413")
+	watcher, err := NewWatcher(portFile, []Target{{Name: "target-0", Client: client}}, nil, 0)
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	watcher.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Start(ctx) }()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start() error = %v, want nil after cancel", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() did not return after cancel")
+	}
+	if client.setCalls != 1 {
+		t.Errorf("SetPort calls = %d, want 1", client.setCalls)
+	}
+}
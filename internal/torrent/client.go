@@ -0,0 +1,155 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	gosync "sync"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+)
+
+// Client is the backend-neutral interface the watcher and server use to drive
+// a torrent client's listening port. Cancelling ctx aborts in-flight requests
+// and retry waits.
+type Client interface {
+	// Name identifies the backend, e.g. "qbittorrent".
+	Name() string
+	GetPort(ctx context.Context) (int, error)
+	SetPort(ctx context.Context, port int) error
+	Ping(ctx context.Context) error
+}
+
+// SettingsEnforcer is implemented by backends that keep additional settings
+// pinned alongside the listening port. The watcher calls EnforceSettings on
+// every sync so drift is corrected even when the port itself is unchanged.
+type SettingsEnforcer interface {
+	EnforceSettings(ctx context.Context) error
+}
+
+// Reannouncer is implemented by backends that can ask trackers to pick up a
+// new port immediately instead of waiting for the next scheduled announce.
+type Reannouncer interface {
+	// ReannounceEnabled reports whether reannouncing is configured.
+	ReannounceEnabled() bool
+	// Reannounce returns the number of torrents that were reannounced.
+	Reannounce(ctx context.Context) (int, error)
+}
+
+// VersionReporter is implemented by backends that detect the client's
+// application and API versions when connecting.
+type VersionReporter interface {
+	// Version returns empty strings for versions that could not be detected.
+	Version() (app string, api string)
+}
+
+// Pauser is implemented by backends that can stop torrents while no
+// forwarded port is available, so they do not keep seeding unconnectable.
+type Pauser interface {
+	// KillSwitchEnabled reports whether pausing is configured.
+	KillSwitchEnabled() bool
+	// PauseTorrents pauses the matching running torrents and returns their
+	// IDs. Torrents that were already paused are left out.
+	PauseTorrents(ctx context.Context) ([]string, error)
+	// ResumeTorrents resumes exactly the given torrents.
+	ResumeTorrents(ctx context.Context, ids []string) error
+}
+
+// Connection statuses reported by ConnectionReporter.
+const (
+	ConnectionConnected    = "connected"
+	ConnectionFirewalled   = "firewalled"
+	ConnectionDisconnected = "disconnected"
+)
+
+// ConnectionInfo is the client's own view of its reachability.
+type ConnectionInfo struct {
+	// Status is one of the Connection* constants.
+	Status   string
+	DHTNodes int
+}
+
+// ConnectionReporter is implemented by backends that report whether peers can
+// reach them, the only end-to-end check that port forwarding works.
+type ConnectionReporter interface {
+	ConnectionStatus(ctx context.Context) (ConnectionInfo, error)
+}
+
+// PortTester is implemented by backends that can ask an outside service
+// whether the listening port is reachable. The watcher runs the test once
+// after a verified port change; the result is informational only.
+type PortTester interface {
+	PortTest(ctx context.Context) (bool, error)
+}
+
+// Options holds the connection settings shared by all backends.
+type Options struct {
+	// Name is the target name the client is created for.
+	Name     string
+	URL      string
+	Username string
+	Password string
+	// Settings carries backend-specific options keyed by upper-case name.
+	Settings map[string]string
+	// Retry is the policy for port requests. A zero Attempts keeps the
+	// backend default.
+	Retry retry.Policy
+}
+
+// Factory creates a connected Client from the given options.
+type Factory func(ctx context.Context, opts Options) (Client, error)
+
+var (
+	registryMu gosync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a backend available under the given type name. It panics if
+// the name is empty, the factory is nil or the name is registered twice.
+func Register(clientType string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	clientType = normalizeType(clientType)
+	if clientType == "" {
+		panic("torrent: Register called with empty client type")
+	}
+	if factory == nil {
+		panic("torrent: Register factory is nil for " + clientType)
+	}
+	if _, dup := registry[clientType]; dup {
+		panic("torrent: Register called twice for " + clientType)
+	}
+	registry[clientType] = factory
+}
+
+// New creates a client for the registered backend matching clientType.
+func New(ctx context.Context, clientType string, opts Options) (Client, error) {
+	registryMu.RLock()
+	factory, ok := registry[normalizeType(clientType)]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown torrent client type %q (available: %s)", clientType, strings.Join(Types(), ", "))
+	}
+
+	return factory(ctx, opts)
+}
+
+// Types returns the sorted names of all registered backends.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for clientType := range registry {
+		types = append(types, clientType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func normalizeType(clientType string) string {
+	return strings.ToLower(strings.TrimSpace(clientType))
+}
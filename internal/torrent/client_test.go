@@ -0,0 +1,82 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+type stubClient struct {
+	opts Options
+}
+
+func (s *stubClient) Name() string                                { return "stub" }
+func (s *stubClient) GetPort(ctx context.Context) (int, error)    { return 0, nil }
+func (s *stubClient) SetPort(ctx context.Context, port int) error { return nil }
+func (s *stubClient) Ping(ctx context.Context) error              { return nil }
+
+func TestRegisterAndNew(t *testing.T) {
+	Register("Stub-Registry", func(ctx context.Context, opts Options) (Client, error) {
+		return &stubClient{opts: opts}, nil
+	})
+
+	client, err := New(context.Background(), "  stub-registry ", Options{URL: "http://example", Username: "user", Password: "pass"})
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+
+	stub, ok := client.(*stubClient)
+	if !ok {
+		t.Fatalf("New() returned %T, want *stubClient", client)
+	}
+	if stub.opts.URL != "http://example" || stub.opts.Username != "user" || stub.opts.Password != "pass" {
+		t.Errorf("factory received options %+v", stub.opts)
+	}
+	if !slices.Contains(Types(), "stub-registry") {
+		t.Errorf("Types() = %v, want to contain stub-registry", Types())
+	}
+}
+
+func TestNew_FactoryError(t *testing.T) {
+	wantErr := errors.New("boom")
+	Register("stub-error", func(ctx context.Context, opts Options) (Client, error) {
+		return nil, wantErr
+	})
+
+	if _, err := New(context.Background(), "stub-error", Options{}); !errors.Is(err, wantErr) {
+		t.Errorf("New() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestNew_UnknownType(t *testing.T) {
+	if _, err := New(context.Background(), "does-not-exist", Options{}); err == nil {
+		t.Error("New() error = nil, want error for unknown type")
+	}
+}
+
+func TestRegister_Panics(t *testing.T) {
+	factory := func(ctx context.Context, opts Options) (Client, error) { return &stubClient{}, nil }
+	Register("stub-dup", factory)
+
+	tests := []struct {
+		name       string
+		clientType string
+		factory    Factory
+	}{
+		{"duplicate", "stub-dup", factory},
+		{"empty type", "  ", factory},
+		{"nil factory", "stub-nil", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Register() did not panic")
+				}
+			}()
+			Register(tt.clientType, tt.factory)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package torrent
+
+import (
+	"errors"
+	"net"
+	"net/url"
+)
+
+// ErrorKind classifies client failures for status reporting and metrics.
+type ErrorKind string
+
+const (
+	KindBadCredentials     ErrorKind = "bad_credentials"
+	KindIPBanned           ErrorKind = "ip_banned"
+	KindUnreachable        ErrorKind = "unreachable"
+	KindUnexpectedResponse ErrorKind = "unexpected_response"
+	// KindVerificationFailed means the client accepted a port change but
+	// reported a different port when read back.
+	KindVerificationFailed ErrorKind = "verification_failed"
+	// KindOther covers errors no backend classified.
+	KindOther ErrorKind = "other"
+)
+
+// Error wraps a backend error with its kind.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// NewError wraps err with the given kind.
+func NewError(kind ErrorKind, err error) *Error {
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Permanent reports whether the kind is one IsPermanent refuses to retry. The
+// retry package uses it to stop early.
+func (e *Error) Permanent() bool {
+	return e.Kind == KindBadCredentials || e.Kind == KindIPBanned
+}
+
+// KindOf returns the kind of the first *Error in err's chain. Unclassified
+// network failures are reported as unreachable, anything else as other. It
+// returns "" for a nil error.
+func KindOf(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Kind
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return KindUnreachable
+	}
+
+	return KindOther
+}
+
+// IsPermanent reports whether retrying err without a configuration change or
+// a long wait is pointless (bad credentials or a banned IP).
+func IsPermanent(err error) bool {
+	kind := KindOf(err)
+	return kind == KindBadCredentials || kind == KindIPBanned
+}
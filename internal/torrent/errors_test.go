@@ -0,0 +1,66 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "typed", err: NewError(KindIPBanned, errors.New("banned")), want: KindIPBanned},
+		{
+			name: "wrapped typed",
+			err:  fmt.Errorf("failed to get port: %w", NewError(KindBadCredentials, errors.New("Fails."))),
+			want: KindBadCredentials,
+		},
+		{
+			name: "url error",
+			err:  fmt.Errorf("request failed: %w", &url.Error{Op: "Get", URL: "http://x", Err: errors.New("refused")}),
+			want: KindUnreachable,
+		},
+		{name: "net error", err: &net.OpError{Op: "dial", Err: errors.New("refused")}, want: KindUnreachable},
+		{name: "unclassified", err: errors.New("boom"), want: KindOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("KindOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	if !IsPermanent(NewError(KindBadCredentials, errors.New("x"))) {
+		t.Error("bad credentials should be permanent")
+	}
+	if !IsPermanent(fmt.Errorf("wrapped: %w", NewError(KindIPBanned, errors.New("x")))) {
+		t.Error("banned IP should be permanent")
+	}
+	if IsPermanent(NewError(KindUnreachable, errors.New("x"))) {
+		t.Error("unreachable should not be permanent")
+	}
+	if IsPermanent(nil) {
+		t.Error("nil should not be permanent")
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	base := errors.New("base")
+	err := NewError(KindUnexpectedResponse, base)
+	if !errors.Is(err, base) {
+		t.Error("errors.Is should find the wrapped error")
+	}
+	if err.Error() != "base" {
+		t.Errorf("Error() = %q, want base", err.Error())
+	}
+}
@@ -0,0 +1,18 @@
+package torrent
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// CloseResponseBody closes resp's body, logging instead of returning a close
+// error since the response has already been read. It is shared by the HTTP
+// based backends.
+func CloseResponseBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	if err := resp.Body.Close(); err != nil {
+		slog.Warn("failed to close response body", "error", err)
+	}
+}
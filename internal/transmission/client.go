@@ -0,0 +1,254 @@
+package transmission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+// ClientType selects the Transmission RPC backend.
+const ClientType = "transmission"
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+	defaultRPCPath     = "/transmission/rpc"
+	sessionIDHeader    = "X-Transmission-Session-Id"
+)
+
+// Client talks to the Transmission RPC interface.
+type Client struct {
+	rpcURL string
+	user   string
+	pass   string
+	client *http.Client
+	retry  retry.Policy
+
+	mu        gosync.Mutex
+	sessionID string
+}
+
+type rpcRequest struct {
+	Method    string `json:"method"`
+	Arguments any    `json:"arguments,omitempty"`
+}
+
+type rpcResponse struct {
+	Result    string          `json:"result"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type sessionArguments struct {
+	PeerPort int `json:"peer-port"`
+}
+
+type portTestArguments struct {
+	PortIsOpen bool `json:"port-is-open"`
+}
+
+var (
+	_ torrent.Client     = (*Client)(nil)
+	_ torrent.PortTester = (*Client)(nil)
+)
+
+func init() {
+	torrent.Register(ClientType, func(ctx context.Context, opts torrent.Options) (torrent.Client, error) {
+		client, err := NewClient(ctx, opts.URL, opts.Username, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Retry.Attempts > 0 {
+			client.SetRetryPolicy(opts.Retry)
+		}
+		return client, nil
+	})
+}
+
+// NewClient creates a Transmission client and performs the session handshake.
+// baseURL may point at the web UI root or directly at the RPC endpoint.
+func NewClient(ctx context.Context, baseURL, user, pass string) (*Client, error) {
+	rpcURL, err := resolveRPCURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{
+		rpcURL: rpcURL,
+		user:   user,
+		pass:   pass,
+		client: &http.Client{
+			Timeout: defaultHTTPTimeout,
+		},
+		retry: retry.DefaultPolicy(),
+	}
+
+	if err := client.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("initial handshake failed: %w", err)
+	}
+
+	return client, nil
+}
+
+func (c *Client) Name() string {
+	return ClientType
+}
+
+// SetRetryPolicy replaces the policy for the session-get and session-set
+// calls behind GetPort and SetPort. Refreshing the session id after a 409 does
+// not use up an attempt.
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retry = policy
+}
+
+func (c *Client) GetPort(ctx context.Context) (int, error) {
+	var args sessionArguments
+	attempts, err := c.retry.Do(ctx, "get port", func(ctx context.Context) error {
+		if err := c.call(ctx, "session-get", map[string][]string{"fields": {"peer-port"}}, &args); err != nil {
+			return fmt.Errorf("failed to get session: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get session after %d attempts: %w", attempts, err)
+	}
+	return args.PeerPort, nil
+}
+
+func (c *Client) SetPort(ctx context.Context, port int) error {
+	attempts, err := c.retry.Do(ctx, "set port", func(ctx context.Context) error {
+		if err := c.call(ctx, "session-set", map[string]int{"peer-port": port}, nil); err != nil {
+			return fmt.Errorf("failed to set session: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set Transmission port after %d attempts: %w", attempts, err)
+	}
+
+	slog.Info("successfully updated Transmission peer port", "port", port)
+	return nil
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.call(ctx, "session-get", map[string][]string{"fields": {"version"}}, nil); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
+// PortTest asks Transmission to check whether the peer port is reachable from
+// the internet. It implements torrent.PortTester.
+func (c *Client) PortTest(ctx context.Context) (bool, error) {
+	var args portTestArguments
+	if err := c.call(ctx, "port-test", nil, &args); err != nil {
+		return false, fmt.Errorf("port test failed: %w", err)
+	}
+	return args.PortIsOpen, nil
+}
+
+func (c *Client) call(ctx context.Context, method string, arguments, result any) error {
+	body, err := json.Marshal(rpcRequest{Method: method, Arguments: arguments})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", method, err)
+	}
+
+	resp, err := c.doPost(ctx, body)
+	if err != nil {
+		return err
+	}
+	defer torrent.CloseResponseBody(resp)
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return torrent.NewError(torrent.KindBadCredentials, errors.New("Transmission rejected credentials (401)"))
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &retry.StatusError{Code: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var rpcResp rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if rpcResp.Result != "success" {
+		return fmt.Errorf("%s returned %q", method, rpcResp.Result)
+	}
+
+	if result != nil && len(rpcResp.Arguments) > 0 {
+		if err := json.Unmarshal(rpcResp.Arguments, result); err != nil {
+			return fmt.Errorf("failed to decode %s arguments: %w", method, err)
+		}
+	}
+
+	return nil
+}
+
+// doPost sends an RPC request, repeating it once with a fresh session id when
+// Transmission answers 409 Conflict.
+func (c *Client) doPost(ctx context.Context, body []byte) (*http.Response, error) {
+	resp, err := c.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusConflict {
+		return resp, nil
+	}
+
+	sessionID := resp.Header.Get(sessionIDHeader)
+	torrent.CloseResponseBody(resp)
+	if sessionID == "" {
+		return nil, fmt.Errorf("received 409 without %s header", sessionIDHeader)
+	}
+
+	slog.Debug("received 409 from Transmission, refreshing session id")
+	c.mu.Lock()
+	c.sessionID = sessionID
+	c.mu.Unlock()
+
+	return c.post(ctx, body)
+}
+
+func (c *Client) post(ctx context.Context, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.rpcURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	c.mu.Lock()
+	if c.sessionID != "" {
+		req.Header.Set(sessionIDHeader, c.sessionID)
+	}
+	c.mu.Unlock()
+	if c.user != "" || c.pass != "" {
+		req.SetBasicAuth(c.user, c.pass)
+	}
+
+	return c.client.Do(req)
+}
+
+func resolveRPCURL(baseURL string) (string, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid Transmission URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid Transmission URL %q: scheme and host are required", baseURL)
+	}
+	if u.Path == "" {
+		u.Path = defaultRPCPath
+	}
+	return u.String(), nil
+}
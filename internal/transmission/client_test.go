@@ -0,0 +1,274 @@
+package transmission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
+	"github.com/eslutz/forwardarr/internal/torrent"
+)
+
+type testServer struct {
+	server      *httptest.Server
+	port        int
+	sessionID   string
+	conflicts   int
+	setCalls    int
+	portTests   int
+	failMethods map[string]int
+}
+
+func newTestServer(t *testing.T, user, pass string) *testServer {
+	t.Helper()
+
+	ts := &testServer{port: 51413, sessionID: "session-1", failMethods: map[string]int{}}
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultRPCPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if user != "" {
+			gotUser, gotPass, ok := r.BasicAuth()
+			if !ok || gotUser != user || gotPass != pass {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		if r.Header.Get(sessionIDHeader) != ts.sessionID {
+			ts.conflicts++
+			w.Header().Set(sessionIDHeader, ts.sessionID)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		var req struct {
+			Method    string          `json:"method"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if ts.failMethods[req.Method] > 0 {
+			ts.failMethods[req.Method]--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		resp := map[string]any{"result": "success", "arguments": map[string]any{}}
+		switch req.Method {
+		case "session-get":
+			resp["arguments"] = map[string]any{"peer-port": ts.port, "version": "4.0.5"}
+		case "session-set":
+			ts.setCalls++
+			var args sessionArguments
+			if err := json.Unmarshal(req.Arguments, &args); err != nil {
+				t.Errorf("failed to decode session-set arguments: %v", err)
+			}
+			ts.port = args.PeerPort
+		case "port-test":
+			ts.portTests++
+			resp["arguments"] = map[string]any{"port-is-open": true}
+		default:
+			resp["result"] = "method name not recognized"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+
+	return ts
+}
+
+func TestNewClient_Handshake(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v, want nil", err)
+	}
+	if client.sessionID != "session-1" {
+		t.Errorf("sessionID = %q, want %q", client.sessionID, "session-1")
+	}
+	if ts.conflicts != 1 {
+		t.Errorf("409 responses = %d, want 1", ts.conflicts)
+	}
+	if client.Name() != ClientType {
+		t.Errorf("Name() = %q, want %q", client.Name(), ClientType)
+	}
+}
+
+func TestNewClient_BasicAuth(t *testing.T) {
+	ts := newTestServer(t, "admin", "secret")
+	defer ts.server.Close()
+
+	if _, err := NewClient(context.Background(), ts.server.URL, "admin", "secret"); err != nil {
+		t.Fatalf("NewClient() error = %v, want nil", err)
+	}
+	_, err := NewClient(context.Background(), ts.server.URL, "admin", "wrong")
+	if err == nil {
+		t.Fatal("NewClient() error = nil, want error for bad credentials")
+	}
+	if kind := torrent.KindOf(err); kind != torrent.KindBadCredentials {
+		t.Errorf("KindOf() = %q, want %q", kind, torrent.KindBadCredentials)
+	}
+	if !torrent.IsPermanent(err) {
+		t.Error("IsPermanent() = false, want true for rejected credentials")
+	}
+}
+
+func TestGetPort_Success(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	port, err := client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v, want nil", err)
+	}
+	if port != 51413 {
+		t.Errorf("GetPort() = %d, want 51413", port)
+	}
+}
+
+func TestGetPort_SessionRotation(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	ts.sessionID = "session-2"
+	if _, err := client.GetPort(context.Background()); err != nil {
+		t.Fatalf("GetPort() error = %v, want nil", err)
+	}
+	if client.sessionID != "session-2" {
+		t.Errorf("sessionID = %q, want %q", client.sessionID, "session-2")
+	}
+}
+
+func TestGetPort_RetryOnServerError(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+
+	ts.failMethods["session-get"] = 1
+	port, err := client.GetPort(context.Background())
+	if err != nil {
+		t.Fatalf("GetPort() error = %v, want nil", err)
+	}
+	if port != 51413 {
+		t.Errorf("GetPort() = %d, want 51413", port)
+	}
+}
+
+func TestSetPort(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.SetPort(context.Background(), 60000); err != nil {
+		t.Fatalf("SetPort() error = %v, want nil", err)
+	}
+	if ts.port != 60000 {
+		t.Errorf("peer-port = %d, want 60000", ts.port)
+	}
+	if ts.setCalls != 1 {
+		t.Errorf("session-set calls = %d, want 1", ts.setCalls)
+	}
+	// The watcher runs the port test once the change is verified.
+	if ts.portTests != 0 {
+		t.Errorf("port-test calls = %d, want 0", ts.portTests)
+	}
+}
+
+func TestPortTest(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	open, err := client.PortTest(context.Background())
+	if err != nil {
+		t.Fatalf("PortTest() error = %v", err)
+	}
+	if !open {
+		t.Error("PortTest() = false, want true")
+	}
+	if ts.portTests != 1 {
+		t.Errorf("port-test calls = %d, want 1", ts.portTests)
+	}
+}
+
+func TestSetPort_Failure(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	defer ts.server.Close()
+
+	client, err := NewClient(context.Background(), ts.server.URL, "", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: 10 * time.Millisecond})
+
+	ts.failMethods["session-set"] = 3
+	if err := client.SetPort(context.Background(), 60000); err == nil {
+		t.Fatal("SetPort() error = nil, want error")
+	}
+	if ts.port != 51413 {
+		t.Errorf("peer-port = %d, want 51413 (unchanged)", ts.port)
+	}
+	if ts.portTests != 0 {
+		t.Errorf("port-test calls = %d, want 0", ts.portTests)
+	}
+}
+
+func TestResolveRPCURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		want    string
+		wantErr bool
+	}{
+		{"root URL", "http://transmission:9091", "http://transmission:9091/transmission/rpc", false},
+		{"trailing slash", "http://transmission:9091/", "http://transmission:9091/transmission/rpc", false},
+		{"explicit RPC path", "https://host/custom/rpc", "https://host/custom/rpc", false},
+		{"missing scheme", "transmission:9091", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveRPCURL(tt.baseURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveRPCURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveRPCURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
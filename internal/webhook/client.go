@@ -6,14 +6,31 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
 )
 
 // Template represents the webhook payload format
 type Template string
 
+// Event names that can be listed in WEBHOOK_EVENTS
+const (
+	EventPortChanged        = "port_changed"
+	EventReannounceComplete = "reannounce_completed"
+	EventReannounceFailed   = "reannounce_failed"
+	// EventVerificationFailed fires when a target reports a different port
+	// than the one just set.
+	EventVerificationFailed = "port_verification_failed"
+	// EventFirewalled fires when a target keeps reporting firewalled with
+	// the forwarded port applied and a resync is forced.
+	EventFirewalled = "firewalled"
+)
+
 const (
 	TemplateJSON    Template = "json"
 	TemplateDiscord Template = "discord"
@@ -28,18 +45,28 @@ type Client struct {
 	template Template
 	events   map[string]bool
 	client   *http.Client
+	retry    retry.Policy
 }
 
 // Payload represents the webhook notification payload
 type Payload struct {
 	Event     string    `json:"event"`
 	Timestamp time.Time `json:"timestamp"`
+	Target    string    `json:"target,omitempty"`
 	OldPort   int       `json:"old_port"`
 	NewPort   int       `json:"new_port"`
-	Message   string    `json:"message"`
+	// ActualPort is the port the target reported after a failed verification.
+	ActualPort int    `json:"actual_port,omitempty"`
+	Torrents   int    `json:"torrents,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Message    string `json:"message"`
+	// Details holds extra fields read next to the port, such as an expiry
+	// or the public IP.
+	Details map[string]string `json:"details,omitempty"`
 }
 
-// NewClient creates a new webhook client
+// NewClient creates a new webhook client. Each notification is attempted once
+// until SetRetryPolicy enables retries.
 func NewClient(url string, timeout time.Duration, template Template, events []string) *Client {
 	eventMap := make(map[string]bool)
 	for _, event := range events {
@@ -52,32 +79,140 @@ func NewClient(url string, timeout time.Duration, template Template, events []st
 		template: template,
 		events:   eventMap,
 		client:   &http.Client{},
+		retry:    retry.Policy{Attempts: 1},
 	}
 }
 
-// SendPortChange sends a port change notification
-func (c *Client) SendPortChange(oldPort, newPort int) error {
-	event := "port_changed"
+// SetRetryPolicy sets how failed deliveries are retried. timeout still
+// applies to each attempt.
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retry = policy
+}
 
-	// Check if this event is enabled
-	if len(c.events) > 0 && !c.events[event] {
-		slog.Debug("webhook event filtered out", "event", event)
+// SendPortChange sends a port change notification for the named target.
+// details are the extra fields read next to the port and may be nil.
+func (c *Client) SendPortChange(ctx context.Context, target string, oldPort, newPort int, details map[string]string) error {
+	event := EventPortChanged
+	if !c.enabled(event) {
+		return nil
+	}
+
+	message := fmt.Sprintf("Port changed from %d to %d", oldPort, newPort)
+	if target != "" {
+		message += " on " + target
+	}
+
+	payload := Payload{
+		Event:     event,
+		Timestamp: time.Now().UTC(),
+		Target:    target,
+		OldPort:   oldPort,
+		NewPort:   newPort,
+		Message:   message,
+		Details:   details,
+	}
+
+	return c.send(ctx, payload)
+}
+
+// SendReannounce reports the outcome of a tracker reannounce that followed a
+// port change. err is nil on success.
+func (c *Client) SendReannounce(ctx context.Context, target string, oldPort, newPort, torrents int, err error) error {
+	event := EventReannounceComplete
+	message := fmt.Sprintf("Reannounced %d torrents after port change to %d", torrents, newPort)
+	errText := ""
+	if err != nil {
+		event = EventReannounceFailed
+		errText = err.Error()
+		message = fmt.Sprintf("Reannounce after port change to %d failed after %d torrents", newPort, torrents)
+	}
+	if !c.enabled(event) {
 		return nil
 	}
+	if target != "" {
+		message += " on " + target
+	}
 
 	payload := Payload{
 		Event:     event,
 		Timestamp: time.Now().UTC(),
+		Target:    target,
 		OldPort:   oldPort,
 		NewPort:   newPort,
-		Message:   fmt.Sprintf("Port changed from %d to %d", oldPort, newPort),
+		Torrents:  torrents,
+		Error:     errText,
+		Message:   message,
+	}
+
+	return c.send(ctx, payload)
+}
+
+// SendVerificationFailed reports that a target still reports actualPort after
+// being set to newPort.
+func (c *Client) SendVerificationFailed(ctx context.Context, target string, oldPort, newPort, actualPort int, err error) error {
+	event := EventVerificationFailed
+	if !c.enabled(event) {
+		return nil
+	}
+
+	message := fmt.Sprintf("Port change to %d did not take effect, client reports %d", newPort, actualPort)
+	if target != "" {
+		message += " on " + target
+	}
+
+	payload := Payload{
+		Event:      event,
+		Timestamp:  time.Now().UTC(),
+		Target:     target,
+		OldPort:    oldPort,
+		NewPort:    newPort,
+		ActualPort: actualPort,
+		Message:    message,
+	}
+	if err != nil {
+		payload.Error = err.Error()
+	}
+
+	return c.send(ctx, payload)
+}
+
+// SendFirewalled reports that a target has been firewalled for the given time
+// despite using the forwarded port.
+func (c *Client) SendFirewalled(ctx context.Context, target string, port int, firewalledFor time.Duration) error {
+	event := EventFirewalled
+	if !c.enabled(event) {
+		return nil
+	}
+
+	message := fmt.Sprintf("Client firewalled for %s despite port %d, forcing resync", firewalledFor.Round(time.Second), port)
+	if target != "" {
+		message += " on " + target
+	}
+
+	payload := Payload{
+		Event:     event,
+		Timestamp: time.Now().UTC(),
+		Target:    target,
+		OldPort:   port,
+		NewPort:   port,
+		Message:   message,
 	}
 
-	return c.send(payload)
+	return c.send(ctx, payload)
 }
 
-// send sends the webhook payload to the configured URL
-func (c *Client) send(payload Payload) error {
+// enabled reports whether the event passes the WEBHOOK_EVENTS filter
+func (c *Client) enabled(event string) bool {
+	if len(c.events) > 0 && !c.events[event] {
+		slog.Debug("webhook event filtered out", "event", event)
+		return false
+	}
+	return true
+}
+
+// send sends the webhook payload to the configured URL, retrying failed
+// deliveries according to the retry policy
+func (c *Client) send(ctx context.Context, payload Payload) error {
 	var jsonData []byte
 	var err error
 
@@ -97,7 +232,21 @@ func (c *Client) send(payload Payload) error {
 		return fmt.Errorf("failed to marshal webhook payload: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	attempts, err := c.retry.Do(ctx, "send webhook", func(ctx context.Context) error {
+		return c.post(ctx, payload.Event, jsonData)
+	})
+	if err != nil {
+		if attempts > 1 {
+			return fmt.Errorf("webhook delivery failed after %d attempts: %w", attempts, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// post makes a single delivery attempt bounded by the client timeout
+func (c *Client) post(ctx context.Context, event string, jsonData []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewBuffer(jsonData))
@@ -108,7 +257,7 @@ func (c *Client) send(payload Payload) error {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Forwardarr-Webhook/1.0")
 
-	slog.Debug("sending webhook", "url", c.url, "event", payload.Event, "template", c.template)
+	slog.Debug("sending webhook", "url", c.url, "event", event, "template", c.template)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -121,7 +270,7 @@ func (c *Client) send(payload Payload) error {
 	}()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook returned non-2xx status: %d", resp.StatusCode)
+		return fmt.Errorf("webhook returned non-2xx status: %w", &retry.StatusError{Code: resp.StatusCode})
 	}
 
 	slog.Info("webhook sent successfully", "url", c.url, "status", resp.StatusCode)
@@ -130,31 +279,73 @@ func (c *Client) send(payload Payload) error {
 
 // formatDiscord formats payload for Discord webhook
 func (c *Client) formatDiscord(payload Payload) ([]byte, error) {
+	fields := []map[string]interface{}{
+		{
+			"name":   "Event",
+			"value":  payload.Event,
+			"inline": true,
+		},
+		{
+			"name":   "Old Port",
+			"value":  fmt.Sprintf("%d", payload.OldPort),
+			"inline": true,
+		},
+		{
+			"name":   "New Port",
+			"value":  fmt.Sprintf("%d", payload.NewPort),
+			"inline": true,
+		},
+	}
+	if payload.Target != "" {
+		fields = append(fields, map[string]interface{}{
+			"name":   "Target",
+			"value":  payload.Target,
+			"inline": true,
+		})
+	}
+	if payload.ActualPort > 0 {
+		fields = append(fields, map[string]interface{}{
+			"name":   "Actual Port",
+			"value":  fmt.Sprintf("%d", payload.ActualPort),
+			"inline": true,
+		})
+	}
+	if payload.Torrents > 0 {
+		fields = append(fields, map[string]interface{}{
+			"name":   "Torrents",
+			"value":  fmt.Sprintf("%d", payload.Torrents),
+			"inline": true,
+		})
+	}
+	for _, key := range slices.Sorted(maps.Keys(payload.Details)) {
+		fields = append(fields, map[string]interface{}{
+			"name":   key,
+			"value":  payload.Details[key],
+			"inline": true,
+		})
+	}
+	if payload.Error != "" {
+		fields = append(fields, map[string]interface{}{
+			"name":   "Error",
+			"value":  payload.Error,
+			"inline": false,
+		})
+	}
+
+	color := 3447003 // Blue color
+	if payload.Error != "" {
+		color = 15158332 // Red color
+	}
+
 	discord := map[string]interface{}{
 		"content": payload.Message,
 		"embeds": []map[string]interface{}{
 			{
-				"title":       "Port Change Notification",
+				"title":       title(payload),
 				"description": payload.Message,
-				"color":       3447003, // Blue color
-				"fields": []map[string]interface{}{
-					{
-						"name":   "Event",
-						"value":  payload.Event,
-						"inline": true,
-					},
-					{
-						"name":   "Old Port",
-						"value":  fmt.Sprintf("%d", payload.OldPort),
-						"inline": true,
-					},
-					{
-						"name":   "New Port",
-						"value":  fmt.Sprintf("%d", payload.NewPort),
-						"inline": true,
-					},
-				},
-				"timestamp": payload.Timestamp.Format(time.RFC3339),
+				"color":       color,
+				"fields":      fields,
+				"timestamp":   payload.Timestamp.Format(time.RFC3339),
 			},
 		},
 	}
@@ -163,6 +354,55 @@ func (c *Client) formatDiscord(payload Payload) ([]byte, error) {
 
 // formatSlack formats payload for Slack webhook
 func (c *Client) formatSlack(payload Payload) ([]byte, error) {
+	fields := []map[string]string{
+		{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*Event:*\n%s", payload.Event),
+		},
+		{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*Old Port:*\n%d", payload.OldPort),
+		},
+		{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*New Port:*\n%d", payload.NewPort),
+		},
+		{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*Time:*\n%s", payload.Timestamp.Format(time.RFC3339)),
+		},
+	}
+	if payload.Target != "" {
+		fields = append(fields, map[string]string{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*Target:*\n%s", payload.Target),
+		})
+	}
+	if payload.ActualPort > 0 {
+		fields = append(fields, map[string]string{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*Actual Port:*\n%d", payload.ActualPort),
+		})
+	}
+	if payload.Torrents > 0 {
+		fields = append(fields, map[string]string{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*Torrents:*\n%d", payload.Torrents),
+		})
+	}
+	for _, key := range slices.Sorted(maps.Keys(payload.Details)) {
+		fields = append(fields, map[string]string{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*%s:*\n%s", key, payload.Details[key]),
+		})
+	}
+	if payload.Error != "" {
+		fields = append(fields, map[string]string{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*Error:*\n%s", payload.Error),
+		})
+	}
+
 	slack := map[string]interface{}{
 		"text": payload.Message,
 		"blocks": []map[string]interface{}{
@@ -170,29 +410,12 @@ func (c *Client) formatSlack(payload Payload) ([]byte, error) {
 				"type": "section",
 				"text": map[string]string{
 					"type": "mrkdwn",
-					"text": fmt.Sprintf("*%s*\n%s", "Port Change Notification", payload.Message),
+					"text": fmt.Sprintf("*%s*\n%s", title(payload), payload.Message),
 				},
 			},
 			{
-				"type": "section",
-				"fields": []map[string]string{
-					{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("*Event:*\n%s", payload.Event),
-					},
-					{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("*Old Port:*\n%d", payload.OldPort),
-					},
-					{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("*New Port:*\n%d", payload.NewPort),
-					},
-					{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("*Time:*\n%s", payload.Timestamp.Format(time.RFC3339)),
-					},
-				},
+				"type":   "section",
+				"fields": fields,
 			},
 		},
 	}
@@ -201,16 +424,45 @@ func (c *Client) formatSlack(payload Payload) ([]byte, error) {
 
 // formatGotify formats payload for Gotify webhook
 func (c *Client) formatGotify(payload Payload) ([]byte, error) {
+	extras := map[string]interface{}{
+		"event":     payload.Event,
+		"target":    payload.Target,
+		"old_port":  payload.OldPort,
+		"new_port":  payload.NewPort,
+		"timestamp": payload.Timestamp.Format(time.RFC3339),
+	}
+	if payload.ActualPort > 0 {
+		extras["actual_port"] = payload.ActualPort
+	}
+	if payload.Torrents > 0 {
+		extras["torrents"] = payload.Torrents
+	}
+	if payload.Error != "" {
+		extras["error"] = payload.Error
+	}
+	if len(payload.Details) > 0 {
+		extras["details"] = payload.Details
+	}
+
 	gotify := map[string]interface{}{
-		"title":    "Port Change Notification",
+		"title":    title(payload),
 		"message":  payload.Message,
 		"priority": 5,
-		"extras": map[string]interface{}{
-			"event":     payload.Event,
-			"old_port":  payload.OldPort,
-			"new_port":  payload.NewPort,
-			"timestamp": payload.Timestamp.Format(time.RFC3339),
-		},
+		"extras":   extras,
 	}
 	return json.Marshal(gotify)
 }
+
+// title returns the notification title for the payload's event
+func title(payload Payload) string {
+	switch payload.Event {
+	case EventReannounceComplete, EventReannounceFailed:
+		return "Tracker Reannounce Notification"
+	case EventVerificationFailed:
+		return "Port Verification Notification"
+	case EventFirewalled:
+		return "Connection Status Notification"
+	default:
+		return "Port Change Notification"
+	}
+}
@@ -1,11 +1,15 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/eslutz/forwardarr/internal/retry"
 )
 
 func TestNewClient(t *testing.T) {
@@ -55,7 +59,7 @@ func TestSendPortChange_Success(t *testing.T) {
 	defer server.Close()
 
 	client := NewClient(server.URL, 5*time.Second, TemplateJSON, []string{"port_changed"})
-	err := client.SendPortChange(8080, 9090)
+	err := client.SendPortChange(context.Background(), "", 8080, 9090, nil)
 
 	if err != nil {
 		t.Errorf("SendPortChange() error = %v, want nil", err)
@@ -78,6 +82,133 @@ func TestSendPortChange_Success(t *testing.T) {
 	}
 }
 
+func TestSendPortChange_WithTarget(t *testing.T) {
+	var receivedPayload Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&receivedPayload); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5*time.Second, TemplateJSON, []string{"port_changed"})
+	if err := client.SendPortChange(context.Background(), "private", 8080, 9090, map[string]string{"public_ip": "203.0.113.7"}); err != nil {
+		t.Fatalf("SendPortChange() error = %v, want nil", err)
+	}
+
+	if receivedPayload.Target != "private" {
+		t.Errorf("payload.Target = %q, want private", receivedPayload.Target)
+	}
+	if receivedPayload.Message != "Port changed from 8080 to 9090 on private" {
+		t.Errorf("payload.Message = %q, want 'Port changed from 8080 to 9090 on private'", receivedPayload.Message)
+	}
+	if receivedPayload.Details["public_ip"] != "203.0.113.7" {
+		t.Errorf("payload.Details = %v, want public_ip 203.0.113.7", receivedPayload.Details)
+	}
+}
+
+func TestSendReannounce(t *testing.T) {
+	tests := []struct {
+		name         string
+		events       []string
+		err          error
+		wantSent     bool
+		wantEvent    string
+		wantError    string
+		wantTorrents int
+	}{
+		{
+			name:         "success",
+			events:       []string{EventReannounceComplete},
+			wantSent:     true,
+			wantEvent:    EventReannounceComplete,
+			wantTorrents: 42,
+		},
+		{
+			name:         "failure",
+			events:       []string{EventReannounceFailed},
+			err:          errors.New("tracker unreachable"),
+			wantSent:     true,
+			wantEvent:    EventReannounceFailed,
+			wantError:    "tracker unreachable",
+			wantTorrents: 42,
+		},
+		{
+			name:   "filtered out by default events",
+			events: []string{EventPortChanged},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent bool
+			var receivedPayload Payload
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent = true
+				if err := json.NewDecoder(r.Body).Decode(&receivedPayload); err != nil {
+					t.Errorf("failed to decode request body: %v", err)
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, 5*time.Second, TemplateJSON, tt.events)
+			if err := client.SendReannounce(context.Background(), "public", 8080, 9090, 42, tt.err); err != nil {
+				t.Fatalf("SendReannounce() error = %v, want nil", err)
+			}
+
+			if sent != tt.wantSent {
+				t.Fatalf("webhook sent = %v, want %v", sent, tt.wantSent)
+			}
+			if !tt.wantSent {
+				return
+			}
+			if receivedPayload.Event != tt.wantEvent {
+				t.Errorf("payload.Event = %q, want %q", receivedPayload.Event, tt.wantEvent)
+			}
+			if receivedPayload.Error != tt.wantError {
+				t.Errorf("payload.Error = %q, want %q", receivedPayload.Error, tt.wantError)
+			}
+			if receivedPayload.Torrents != tt.wantTorrents || receivedPayload.Target != "public" || receivedPayload.NewPort != 9090 {
+				t.Errorf("payload = %+v", receivedPayload)
+			}
+		})
+	}
+}
+
+func TestSendVerificationFailed(t *testing.T) {
+	var receivedPayload Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&receivedPayload); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5*time.Second, TemplateJSON, []string{EventVerificationFailed})
+	if err := client.SendVerificationFailed(context.Background(), "public", 8080, 9090, 8080, errors.New("port ignored")); err != nil {
+		t.Fatalf("SendVerificationFailed() error = %v, want nil", err)
+	}
+
+	if receivedPayload.Event != EventVerificationFailed {
+		t.Errorf("payload.Event = %q, want %q", receivedPayload.Event, EventVerificationFailed)
+	}
+	if receivedPayload.NewPort != 9090 || receivedPayload.ActualPort != 8080 || receivedPayload.Error != "port ignored" {
+		t.Errorf("payload = %+v", receivedPayload)
+	}
+
+	filtered := NewClient(server.URL, 5*time.Second, TemplateJSON, []string{EventPortChanged})
+	receivedPayload = Payload{}
+	if err := filtered.SendVerificationFailed(context.Background(), "public", 8080, 9090, 8080, nil); err != nil {
+		t.Fatalf("SendVerificationFailed() error = %v, want nil", err)
+	}
+	if receivedPayload.Event != "" {
+		t.Errorf("filtered event was sent: %+v", receivedPayload)
+	}
+}
+
 func TestSendPortChange_ServerError(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -85,13 +216,44 @@ func TestSendPortChange_ServerError(t *testing.T) {
 	defer server.Close()
 
 	client := NewClient(server.URL, 5*time.Second, TemplateJSON, []string{"port_changed"})
-	err := client.SendPortChange(8080, 9090)
+	err := client.SendPortChange(context.Background(), "", 8080, 9090, nil)
 
 	if err == nil {
 		t.Error("SendPortChange() error = nil, want error")
 	}
 }
 
+func TestSendPortChange_RetryPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		wantCalls  int
+	}{
+		{"server error is retried", http.StatusBadGateway, 3},
+		{"client error is not retried", http.StatusBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, 5*time.Second, TemplateJSON, []string{"port_changed"})
+			client.SetRetryPolicy(retry.Policy{Attempts: 3, BaseDelay: time.Millisecond})
+			if err := client.SendPortChange(context.Background(), "", 8080, 9090, nil); err == nil {
+				t.Error("SendPortChange() error = nil, want error")
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
 func TestSendPortChange_Timeout(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(100 * time.Millisecond)
@@ -100,7 +262,7 @@ func TestSendPortChange_Timeout(t *testing.T) {
 	defer server.Close()
 
 	client := NewClient(server.URL, 10*time.Millisecond, TemplateJSON, []string{"port_changed"})
-	err := client.SendPortChange(8080, 9090)
+	err := client.SendPortChange(context.Background(), "", 8080, 9090, nil)
 
 	if err == nil {
 		t.Error("SendPortChange() error = nil, want timeout error")
@@ -109,7 +271,7 @@ func TestSendPortChange_Timeout(t *testing.T) {
 
 func TestSendPortChange_InvalidURL(t *testing.T) {
 	client := NewClient("http://[::1]:namedport", 5*time.Second, TemplateJSON, []string{"port_changed"})
-	err := client.SendPortChange(8080, 9090)
+	err := client.SendPortChange(context.Background(), "", 8080, 9090, nil)
 
 	if err == nil {
 		t.Error("SendPortChange() error = nil, want error")
@@ -136,7 +298,7 @@ func TestSendPortChange_NonOKStatusCodes(t *testing.T) {
 			defer server.Close()
 
 			client := NewClient(server.URL, 5*time.Second, TemplateJSON, []string{"port_changed"})
-			err := client.SendPortChange(8080, 9090)
+			err := client.SendPortChange(context.Background(), "", 8080, 9090, nil)
 
 			if err == nil {
 				t.Errorf("SendPortChange() error = nil, want error for status %d", tt.statusCode)
@@ -164,7 +326,7 @@ func TestSendPortChange_SuccessStatusCodes(t *testing.T) {
 			defer server.Close()
 
 			client := NewClient(server.URL, 5*time.Second, TemplateJSON, []string{"port_changed"})
-			err := client.SendPortChange(8080, 9090)
+			err := client.SendPortChange(context.Background(), "", 8080, 9090, nil)
 
 			if err != nil {
 				t.Errorf("SendPortChange() error = %v, want nil for status %d", err, tt.statusCode)
@@ -247,7 +409,7 @@ w.WriteHeader(http.StatusOK)
 defer server.Close()
 
 client := NewClient(server.URL, 5*time.Second, tt.template, []string{"port_changed"})
-err := client.SendPortChange(8080, 9090)
+err := client.SendPortChange(context.Background(), "", 8080, 9090, nil)
 
 if err != nil {
 t.Errorf("SendPortChange() error = %v, want nil", err)
@@ -296,7 +458,7 @@ w.WriteHeader(http.StatusOK)
 defer server.Close()
 
 client := NewClient(server.URL, 5*time.Second, TemplateJSON, tt.events)
-err := client.SendPortChange(8080, 9090)
+err := client.SendPortChange(context.Background(), "", 8080, 9090, nil)
 
 if err != nil {
 t.Errorf("SendPortChange() error = %v, want nil", err)